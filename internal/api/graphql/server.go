@@ -2,7 +2,7 @@ package graphql
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
@@ -14,11 +14,12 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 const defaultPort = "8080"
 
-func ServeGraphql(ctx context.Context) error {
+func ServeGraphql(ctx context.Context, logger *slog.Logger) error {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
@@ -40,9 +41,9 @@ func ServeGraphql(ctx context.Context) error {
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
 	http.Handle("/query", srv)
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
+	logger.Info("connect for GraphQL playground", "url", "http://localhost:"+port+"/")
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := http.ListenAndServe(":"+port, otelhttp.NewHandler(http.DefaultServeMux, "graphql")); err != nil {
 		return err
 	}
 
@@ -4,37 +4,47 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"time"
 
 	pb "github.com/lzf-12/go-example-collections/internal/api/grpc/hello"
+	"github.com/lzf-12/go-example-collections/internal/health"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
 	port = flag.Int("port", 50051, "The server port")
 )
 
+const healthSyncInterval = 5 * time.Second
+
 // server is used to implement helloworld.GreeterServer.
 type server struct {
 	pb.UnimplementedHelloServiceServer
+	logger *slog.Logger
 }
 
 // SayHello implements helloworld.GreeterServer
-func (s *server) SayHello(_ context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
-	log.Printf("Received: %v", in.GetName())
+func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloResponse, error) {
+	s.logger.InfoContext(ctx, "received hello", "name", in.GetName())
 	return &pb.HelloResponse{Message: "Hello " + in.GetName()}, nil
 }
 
-func ServeGrpc(ctx context.Context) error {
+func ServeGrpc(ctx context.Context, logger *slog.Logger, healthRegistry *health.Registry) error {
 	flag.Parse()
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logger.Error("failed to listen", "port", *port, logging.Err(err))
+		return err
 	}
-	s := grpc.NewServer()
-	pb.RegisterHelloServiceServer(s, &server{})
-	log.Printf("server listening at %v", lis.Addr())
+	s := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	pb.RegisterHelloServiceServer(s, &server{logger: logger})
+	healthpb.RegisterHealthServer(s, healthRegistry.GRPCServer(ctx, healthSyncInterval))
+	logger.Info("grpc server listening", "addr", lis.Addr().String())
 
 	if err := s.Serve(lis); err != nil {
 		return err
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/internal/health"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	brokermetrics "github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// ServeMetrics exposes prometheus default registry on addr at /metrics until ctx is done,
+// with liveness and readiness probes of healthRegistry at /healthz and /readyz when not nil
+func ServeMetrics(ctx context.Context, logger *slog.Logger, addr string, healthRegistry *health.Registry) error {
+
+	if err := brokermetrics.Register(prometheus.DefaultRegisterer); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if healthRegistry != nil {
+		healthRegistry.RegisterHTTP(mux)
+	}
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("metrics server shutdown error", logging.Err(err))
+		}
+	}()
+
+	logger.Info("metrics server running", "addr", addr, "path", "/metrics")
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -2,16 +2,19 @@ package rest
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-func ServeRestHttp(ctx context.Context) error {
+func ServeRestHttp(ctx context.Context, logger *slog.Logger) error {
 
 	http.HandleFunc("/resthttp", HandlerRestHttp())
-	log.Println("REST without framework running at :8080")
+	logger.Info("REST without framework running", "addr", ":8080")
 
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	// server span per request, continues incoming w3c trace context
+	if err := http.ListenAndServe(":8080", otelhttp.NewHandler(http.DefaultServeMux, "resthttp")); err != nil {
 		return err
 	}
 
@@ -21,11 +24,13 @@ func ServeRestHttp(ctx context.Context) error {
 	return nil
 }
 
-func ServeRestGin(ctx context.Context) error {
+func ServeRestGin(ctx context.Context, logger *slog.Logger) error {
 
 	gin := InitGin()
 	gin.GET("/restgin", HandlerGin())
-	if err := gin.Run(":8081"); err != nil {
+	logger.Info("REST gin running", "addr", ":8081")
+
+	if err := http.ListenAndServe(":8081", otelhttp.NewHandler(gin, "restgin")); err != nil {
 		return err
 	}
 
@@ -35,10 +40,11 @@ func ServeRestGin(ctx context.Context) error {
 	return nil
 }
 
-func ServeRestFiber(ctx context.Context) error {
+func ServeRestFiber(ctx context.Context, logger *slog.Logger) error {
 
 	fiber := InitFiber()
 	fiber.Get("/restfiber", HandlerFiber())
+	logger.Info("REST fiber running", "addr", ":8082")
 	if err := fiber.Listen(":8082"); err != nil {
 		return err
 	}
@@ -1,7 +1,7 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -31,7 +31,7 @@ type Config struct {
 func LoadConfig(path string) (*Config, error) {
 
 	if err := godotenv.Load(path); err != nil {
-		log.Println("no .env file found, using environment variables")
+		slog.Info("no .env file found, using environment variables", "path", path)
 	}
 
 	cfg := &Config{
@@ -1,56 +1,28 @@
 package handler
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"context"
 	"fmt"
-	"log"
 
 	"github.com/lzf-12/go-example-collections/msgbroker/adapter/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
 
 	"github.com/lzf-12/go-example-collections/internal/consumer/model"
 )
 
-func OrderHandlerV2Json(msg kafka.Message) error {
-	var order model.OrderCreatedV2
-	if err := json.Unmarshal(msg.Value, &order); err != nil {
-		return fmt.Errorf("failed to decode json order: %w", err)
-	}
+// messages without version headers on order.v2.* topics are treated as order.created v2
+var orderV2Fallback = versioning.Meta{Type: model.EventOrderCreated, Version: 2}
 
-	// validate required fields
-	if order.ID == "" || order.Product == "" || order.Quantity <= 0 {
-		return fmt.Errorf("invalid order: missing required fields")
+func OrderHandlerV2Json(ctx context.Context, msg kafka.Message) error {
+	if err := orderJSONDispatcher.DispatchHeaders(ctx, msg.Headers.StringMap(), msg.Value, orderV2Fallback); err != nil {
+		return fmt.Errorf("failed to handle json order: %w", err)
 	}
-
-	// business logic (e.g., save to DB, process payment, etc.)
-	log.Printf("processing order: %+v", order)
-
-	go func() {
-		// process logic here
-
-	}()
-
 	return nil
 }
 
-func OrderHandlerV2Xml(msg kafka.Message) error {
-	var order model.OrderCreatedV2
-	if err := xml.Unmarshal(msg.Value, &order); err != nil {
-		return fmt.Errorf("failed to decode json order: %w", err)
+func OrderHandlerV2Xml(ctx context.Context, msg kafka.Message) error {
+	if err := orderXMLDispatcher.DispatchHeaders(ctx, msg.Headers.StringMap(), msg.Value, orderV2Fallback); err != nil {
+		return fmt.Errorf("failed to handle xml order: %w", err)
 	}
-
-	// validate required fields
-	if order.ID == "" || order.Product == "" || order.Quantity <= 0 {
-		return fmt.Errorf("invalid order: missing required fields")
-	}
-
-	// business logic (e.g., save to DB, process payment, etc.)
-	log.Printf("processing order: %+v", order)
-
-	go func() {
-		// process logic here
-
-	}()
-
 	return nil
 }
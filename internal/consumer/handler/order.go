@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+
+	"github.com/lzf-12/go-example-collections/internal/consumer/model"
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
+)
+
+// order.created v1 arrives through rabbitmq (order.v1.*) and v2 through kafka (order.v2.*),
+// both are upcasted to OrderCreatedV2 before reaching processOrderCreated.
+var (
+	orderRegistry = newOrderRegistry()
+
+	orderJSONDispatcher = newOrderDispatcher(json.Unmarshal)
+	orderXMLDispatcher  = newOrderDispatcher(xml.Unmarshal)
+)
+
+func newOrderRegistry() *versioning.Registry {
+	reg := versioning.NewRegistry()
+	reg.RegisterVersion(model.EventOrderCreated, 1, func() any { return &model.OrderCreatedV1{} })
+	reg.RegisterVersion(model.EventOrderCreated, 2, func() any { return &model.OrderCreatedV2{} })
+	reg.RegisterUpcaster(model.EventOrderCreated, 1, model.UpcastOrderCreatedV1)
+	return reg
+}
+
+func newOrderDispatcher(decode versioning.Decoder) *versioning.Dispatcher {
+	d := versioning.NewDispatcher(orderRegistry, decode)
+	versioning.HandleFunc(d, model.EventOrderCreated, processOrderCreated)
+	return d
+}
+
+// processOrderCreated always receives the latest order version
+func processOrderCreated(ctx context.Context, order *model.OrderCreatedV2) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// validate required fields
+	if order.ID == "" || order.Product == "" || order.Quantity <= 0 {
+		return fmt.Errorf("invalid order: missing required fields")
+	}
+
+	// business logic (e.g., save to DB, process payment, etc.)
+	slog.InfoContext(ctx, "processing order", "order_id", order.ID, "product", order.Product, "quantity", order.Quantity)
+
+	return nil
+}
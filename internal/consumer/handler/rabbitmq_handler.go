@@ -1,29 +1,26 @@
 package handler
 
 import (
-	"encoding/json"
-	"encoding/xml"
-	"log"
+	"context"
+	"log/slog"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
 
 	"github.com/lzf-12/go-example-collections/internal/consumer/model"
 )
 
-func HandleCreateOrderV1JSON(msg []byte, _ map[string]interface{}) {
-	var o model.OrderCreatedV1
-	if err := json.Unmarshal(msg, &o); err != nil {
-		log.Printf("[JSON] Failed to parse: %v", err)
-		return
-	}
+// messages without version headers on order.v1.* topics are treated as order.created v1
+var orderV1Fallback = versioning.Meta{Type: model.EventOrderCreated, Version: 1}
 
-	// call create order flow process here
+func HandleCreateOrderV1JSON(ctx context.Context, msg []byte, headers map[string]interface{}) {
+	if err := orderJSONDispatcher.DispatchHeaders(ctx, versioning.StringHeaders(headers), msg, orderV1Fallback); err != nil {
+		slog.ErrorContext(ctx, "failed to handle order", "format", "json", logging.Err(err))
+	}
 }
 
-func HandleCreateOrderV1XML(msg []byte, _ map[string]interface{}) {
-	var o model.OrderCreatedV1
-	if err := xml.Unmarshal(msg, &o); err != nil {
-		log.Printf("[XML] Failed to parse: %v", err)
-		return
+func HandleCreateOrderV1XML(ctx context.Context, msg []byte, headers map[string]interface{}) {
+	if err := orderXMLDispatcher.DispatchHeaders(ctx, versioning.StringHeaders(headers), msg, orderV1Fallback); err != nil {
+		slog.ErrorContext(ctx, "failed to handle order", "format", "xml", logging.Err(err))
 	}
-
-	// call create order flow process here
 }
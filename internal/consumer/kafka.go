@@ -2,20 +2,28 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/lzf-12/go-example-collections/internal/config"
 	handler "github.com/lzf-12/go-example-collections/internal/consumer/handler"
 	pubsub "github.com/lzf-12/go-example-collections/internal/consumer/model"
+	"github.com/lzf-12/go-example-collections/internal/health"
 	"github.com/lzf-12/go-example-collections/msgbroker/adapter/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func InitKafkaConsumer(ctx context.Context) error {
+func InitKafkaConsumer(ctx context.Context, logger *slog.Logger, healthRegistry *health.Registry) error {
+
+	// not ready again once the client is closed, main holds the check down until connected
+	defer healthRegistry.Register("kafka", health.Readiness, health.Unavailable("closed"))
 
 	cfg, err := config.LoadConfig(".env")
 	if err != nil {
-		log.Printf("load config failed: %v", err)
+		logger.ErrorContext(ctx, "load config failed", logging.Err(err))
 		return err
 	}
 
@@ -32,35 +40,65 @@ func InitKafkaConsumer(ctx context.Context) error {
 	consumercfg.Set(fmt.Sprintf("group.id=%s", consumerGroupId))
 	consumercfg.Set(fmt.Sprintf("auto.offset.reset=%s", "earliest"))
 
-	log.Println("initialize kafka consumer client")
+	logger.InfoContext(ctx, "initialize kafka consumer client", "bootstrap_servers", kafkaBrokerServer, "group_id", consumerGroupId)
 	kc, err := kafka.NewKafkaConsumerClient(consumercfg, admincfg)
 	if err != nil {
-		log.Println("error initialize kafka consumer client: ", err)
+		logger.ErrorContext(ctx, "error initialize kafka consumer client", logging.Err(err))
+		return err
 	}
+	kc.Logger = logger
+
+	// must stay below main shutdown timeout to let final offsets commit
+	kc.ConsumerCfg.ShutdownTimeout = 5 * time.Second
+
+	defer func() {
+		if err := kc.Close(); err != nil {
+			logger.ErrorContext(ctx, "close kafka consumer client error", logging.Err(err))
+		}
+	}()
 
 	// healtcheck
-	log.Println("kafka healthcheck...")
+	logger.InfoContext(ctx, "kafka healthcheck")
 	err = kc.HealthCheck(ctx)
 	if err != nil {
-		log.Println("healtcheck kafka error: ", err)
+		logger.ErrorContext(ctx, "healtcheck kafka error", logging.Err(err))
 		return err
 	}
-	log.Println("kafka ok")
+	logger.InfoContext(ctx, "kafka ok")
+
+	healthRegistry.Register("kafka", health.Readiness, health.Broker(kc))
+
+	// the fetch loop waits for each handler, a loop stuck well past the handler timeout needs a restart
+	healthRegistry.Register("kafka-consumer", health.Liveness, health.Heartbeat(kc.LastPoll, 2*time.Minute))
+	defer healthRegistry.Unregister("kafka-consumer")
+
+	// export consumer lag of assigned partitions
+	lagCollector := kc.LagCollector()
+	if err := prometheus.Register(lagCollector); err != nil {
+		logger.WarnContext(ctx, "register kafka lag collector error", logging.Err(err))
+	}
+	defer prometheus.Unregister(lagCollector)
 
 	// TODO: centralize topic partition configuration in .yml
 	// topic handlers map
 	topicHandlers := []kafka.TopicHandler{
-		{Topic: pubsub.TopicOrderV2Json, Handler: handler.OrderHandlerV2Json, Partitions: 1, ReplicationFactor: 1},
-		{Topic: pubsub.TopicOrderV2Xml, Handler: handler.OrderHandlerV2Xml, Partitions: 1, ReplicationFactor: 1},
+		{Topic: pubsub.TopicOrderV2Json, Handler: handler.OrderHandlerV2Json, Timeout: 30 * time.Second, Partitions: 1, ReplicationFactor: 1},
+		{Topic: pubsub.TopicOrderV2Xml, Handler: handler.OrderHandlerV2Xml, Timeout: 30 * time.Second, Partitions: 1, ReplicationFactor: 1},
 	}
 
 	// subscribe all topic and handlers
 	err = kc.SubscribeTopics(ctx, topicHandlers)
+	var shutdownErr *kafka.ShutdownError
+	if errors.As(err, &shutdownErr) {
+		// offsets of unprocessed messages were not committed, they will be redelivered
+		logger.WarnContext(ctx, "kafka consumer stopped with unprocessed messages", "unprocessed", len(shutdownErr.Unprocessed), logging.Err(err))
+		return nil
+	}
 	if err != nil {
-		log.Println("subscribe single topic error: ", err)
+		logger.ErrorContext(ctx, "subscribe topics error", logging.Err(err))
 		return err
 	}
 
-	log.Println("success initialize kafka consumer client")
+	logger.InfoContext(ctx, "kafka consumer client stopped")
 	return nil
 }
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 const (
 	RmqQueueOrder    = "order-service.queue"
@@ -8,6 +12,9 @@ const (
 	TopicOrderV1Xml  = "order.v1.xml"
 	TopicOrderV2Json = "order.v2.json"
 	TopicOrderV2Xml  = "order.v2.xml"
+
+	// event type carried in versioning.HeaderEventType for both order versions
+	EventOrderCreated = "order.created"
 )
 
 type OrderCreatedV1 struct {
@@ -27,10 +34,27 @@ type OrderCreatedV2 struct {
 	ConsumerId string    `json:"consumer_id" xml:"consumer_id"`
 }
 
+// UpcastOrderCreatedV1 converts *OrderCreatedV1 into *OrderCreatedV2.
+// v1 producers don't know the consumer, so ConsumerId is left empty.
+func UpcastOrderCreatedV1(from any) (any, error) {
+	v1, ok := from.(*OrderCreatedV1)
+	if !ok {
+		return nil, fmt.Errorf("expected *OrderCreatedV1, got %T", from)
+	}
+
+	return &OrderCreatedV2{
+		ID:        v1.ID,
+		Product:   v1.Product,
+		Quantity:  v1.Quantity,
+		Price:     v1.Price,
+		Timestamp: v1.Timestamp,
+	}, nil
+}
+
 type QueueTopicHandler struct {
 	Queue   string
 	Topic   string
-	Handler func([]byte, map[string]interface{})
+	Handler func(context.Context, []byte, map[string]interface{})
 
 	DeadLetterQueue string
 }
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
+)
+
+func newOrderRegistry() *versioning.Registry {
+	reg := versioning.NewRegistry()
+	reg.RegisterVersion(EventOrderCreated, 1, func() any { return &OrderCreatedV1{} })
+	reg.RegisterVersion(EventOrderCreated, 2, func() any { return &OrderCreatedV2{} })
+	reg.RegisterUpcaster(EventOrderCreated, 1, UpcastOrderCreatedV1)
+	return reg
+}
+
+func TestUpcastOrderCreatedV1(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	got, err := UpcastOrderCreatedV1(&OrderCreatedV1{ID: "o-1", Product: "book", Quantity: 2, Price: 9.5, Timestamp: ts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OrderCreatedV2{ID: "o-1", Product: "book", Quantity: 2, Price: 9.5, Timestamp: ts}
+	if v2, ok := got.(*OrderCreatedV2); !ok || *v2 != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := UpcastOrderCreatedV1(&OrderCreatedV2{}); err == nil {
+		t.Fatal("expected error for wrong input type")
+	}
+}
+
+func TestOrderCreatedDispatch(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	v1 := OrderCreatedV1{ID: "o-1", Product: "book", Quantity: 2, Price: 9.5, Timestamp: ts}
+	v2 := OrderCreatedV2{ID: "o-2", Product: "pen", Quantity: 1, Price: 1.5, Timestamp: ts, ConsumerId: "c-1"}
+	upcastV1 := OrderCreatedV2{ID: "o-1", Product: "book", Quantity: 2, Price: 9.5, Timestamp: ts}
+
+	type codec struct {
+		name      string
+		marshal   func(any) ([]byte, error)
+		unmarshal versioning.Decoder
+	}
+	codecs := []codec{
+		{"json", json.Marshal, json.Unmarshal},
+		{"xml", xml.Marshal, xml.Unmarshal},
+	}
+
+	tests := []struct {
+		name     string
+		value    any
+		headers  map[string]string
+		fallback versioning.Meta
+		want     OrderCreatedV2
+		wantErr  error
+	}{
+		{"v1", v1, versioning.SetHeaders(nil, versioning.Meta{Type: EventOrderCreated, Version: 1}), versioning.Meta{}, upcastV1, nil},
+		{"v2", v2, versioning.SetHeaders(nil, versioning.Meta{Type: EventOrderCreated, Version: 2}), versioning.Meta{}, v2, nil},
+		{"v1 without headers", v1, nil, versioning.Meta{Type: EventOrderCreated, Version: 1}, upcastV1, nil},
+		{"v2 without headers", v2, nil, versioning.Meta{Type: EventOrderCreated, Version: 2}, v2, nil},
+		{"unknown version", v2, map[string]string{versioning.HeaderEventType: EventOrderCreated, versioning.HeaderEventVersion: "3"}, versioning.Meta{}, OrderCreatedV2{}, versioning.ErrUnknownEventVersion},
+		{"unknown type", v2, map[string]string{versioning.HeaderEventType: "order.deleted", versioning.HeaderEventVersion: "1"}, versioning.Meta{}, OrderCreatedV2{}, versioning.ErrNoHandler},
+		{"missing headers without fallback", v2, nil, versioning.Meta{}, OrderCreatedV2{}, versioning.ErrNoHandler},
+	}
+
+	for _, c := range codecs {
+		for _, tt := range tests {
+			t.Run(c.name+"/"+tt.name, func(t *testing.T) {
+				payload, err := c.marshal(tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got *OrderCreatedV2
+				d := versioning.NewDispatcher(newOrderRegistry(), c.unmarshal)
+				versioning.HandleFunc(d, EventOrderCreated, func(_ context.Context, order *OrderCreatedV2) error {
+					got = order
+					return nil
+				})
+
+				err = d.DispatchHeaders(context.Background(), tt.headers, payload, tt.fallback)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("got %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got == nil || !got.Timestamp.Equal(tt.want.Timestamp) {
+					t.Fatalf("got %+v, want %+v", got, tt.want)
+				}
+				got.Timestamp = tt.want.Timestamp
+				if *got != tt.want {
+					t.Fatalf("got %+v, want %+v", *got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -2,34 +2,43 @@ package consumer
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/lzf-12/go-example-collections/internal/config"
 	"github.com/lzf-12/go-example-collections/internal/consumer/handler"
 	"github.com/lzf-12/go-example-collections/internal/consumer/model"
+	"github.com/lzf-12/go-example-collections/internal/health"
 	"github.com/lzf-12/go-example-collections/msgbroker/adapter/rabbitmq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
 	"github.com/lzf-12/go-example-collections/msgbroker/retry"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func InitRabbitMQConsumer(ctx context.Context) error {
+func InitRabbitMQConsumer(ctx context.Context, logger *slog.Logger, healthRegistry *health.Registry) error {
+
+	// not ready again once the broker is closed, main holds the check down until connected
+	defer healthRegistry.Register("rabbitmq", health.Readiness, health.Unavailable("closed"))
 
 	cfg, err := config.LoadConfig(".env")
 	if err != nil {
-		log.Printf("load config failed: %v", err)
+		logger.ErrorContext(ctx, "load config failed", logging.Err(err))
 		return err
 	}
 
 	opts := rabbitmq.RabbitMQOpts{
 		AmqpString: cfg.RabbitMQAmqpString,
+		Logger:     logger,
 	}
 
 	rmq, err := rabbitmq.NewRabbitMQBroker(opts)
 	if err != nil {
-		log.Printf("rabbitMQ initialize connection failed: %v", err)
+		logger.ErrorContext(ctx, "rabbitMQ initialize connection failed", logging.Err(err))
 		return err
 	}
 
+	healthRegistry.Register("rabbitmq", health.Readiness, health.Broker(rmq))
+
 	consumerCfg := rabbitmq.ConsumerCfg{
 		PrefetchCount: 0,
 		PrefetchSize:  0,
@@ -45,7 +54,7 @@ func InitRabbitMQConsumer(ctx context.Context) error {
 
 	consumer, err := rmq.NewConsumer(consumerCfg)
 	if err != nil {
-		log.Printf("consumer initialize failed: %v", err)
+		logger.ErrorContext(ctx, "consumer initialize failed", logging.Err(err))
 		return err
 	}
 
@@ -64,22 +73,29 @@ func InitRabbitMQConsumer(ctx context.Context) error {
 
 	// subscribe each map
 	for _, qth := range mapQueueTopicHandler {
-		err := consumer.Subscribe(qth.Queue, qth.Topic, qth.Handler)
+		err := consumer.SubscribeWithContext(qth.Queue, qth.Topic, qth.Handler)
 		if err != nil {
-			log.Printf("failed to subscribe to topic %s: %v", qth.Topic, err)
+			logger.ErrorContext(ctx, "failed to subscribe to topic", logging.KeyQueue, qth.Queue, logging.KeyRoutingKey, qth.Topic, logging.Err(err))
 		} else {
-			log.Printf("subscribed to topic: %s", qth.Topic)
+			logger.InfoContext(ctx, "subscribed to topic", logging.KeyQueue, qth.Queue, logging.KeyRoutingKey, qth.Topic)
 		}
 	}
 
+	// export depth of subscribed queues
+	queueCollector := consumer.Props().QueueCollector()
+	if err := prometheus.Register(queueCollector); err != nil {
+		logger.WarnContext(ctx, "register rabbitMQ queue collector failed", logging.Err(err))
+	}
+	defer prometheus.Unregister(queueCollector)
+
 	// shutdown context received
 	<-ctx.Done()
 
-	log.Println("shutdown signal received in RabbitMQ consumer. cleaning up...")
+	logger.Info("shutdown signal received in RabbitMQ consumer. cleaning up")
 
 	close(consumer.Props().Done)  // shutdown channel
 	consumer.Props().Conn.Close() // close connection
 
-	log.Println("rabbitMQ disconnection complete")
+	logger.Info("rabbitMQ disconnection complete")
 	return nil
 }
@@ -2,20 +2,23 @@ package consumer
 
 import (
 	"context"
+	"log/slog"
+
+	"github.com/lzf-12/go-example-collections/internal/health"
 )
 
-func ServeRabbitMQConsumer(ctx context.Context) error {
+func ServeRabbitMQConsumer(ctx context.Context, logger *slog.Logger, healthRegistry *health.Registry) error {
 
-	if err := InitRabbitMQConsumer(ctx); err != nil {
+	if err := InitRabbitMQConsumer(ctx, logger, healthRegistry); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func ServeKafkaConsumer(ctx context.Context) error {
+func ServeKafkaConsumer(ctx context.Context, logger *slog.Logger, healthRegistry *health.Registry) error {
 
-	if err := InitKafkaConsumer(ctx); err != nil {
+	if err := InitKafkaConsumer(ctx, logger, healthRegistry); err != nil {
 		return err
 	}
 
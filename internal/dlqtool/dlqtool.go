@@ -0,0 +1,195 @@
+package dlqtool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/internal/config"
+	"github.com/lzf-12/go-example-collections/msgbroker/adapter/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/adapter/rabbitmq"
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+// exit codes for scripts
+const (
+	ExitOK    = 0
+	ExitError = 1
+)
+
+const (
+	BrokerKafka    = "kafka"
+	BrokerRabbitMQ = "rabbitmq"
+
+	ActionList      = "list"      // one line per message
+	ActionPeek      = "peek"      // full messages with headers and body
+	ActionRepublish = "republish" // send back to the original topic / routing key
+
+	FormatTable = "table"
+	FormatJSON  = "json"
+
+	maxErrorWidth = 60
+)
+
+// Options of the dlq command
+type Options struct {
+	Broker string
+	Action string
+	Source string // dlq queue or topic, RABBITMQ_DEFAULT_DLQ for rabbitmq when empty
+	Target string // overrides the original topic / routing key on republish
+	Limit  int    // 0 means all matching messages
+	Format string
+	Filter dlq.Filter
+}
+
+// Run executes the dlq action and returns the process exit code
+func Run(ctx context.Context, logger *slog.Logger, opts Options, out io.Writer) int {
+	cfg, err := config.LoadConfig(".env")
+	if err != nil {
+		logger.ErrorContext(ctx, "load config failed", logging.Err(err))
+		return ExitError
+	}
+
+	if opts.Format != FormatTable && opts.Format != FormatJSON && opts.Format != "" {
+		logger.ErrorContext(ctx, "invalid format, valid formats are: table | json", "format", opts.Format)
+		return ExitError
+	}
+
+	var (
+		peek      func() ([]dlq.Message, error)
+		republish func() (int, error)
+	)
+
+	switch opts.Broker {
+	case BrokerRabbitMQ:
+		if opts.Source == "" {
+			opts.Source = cfg.RabbitMQDefaultDlq
+		}
+		rmq, err := rabbitmq.NewRabbitMQBroker(rabbitmq.RabbitMQOpts{AmqpString: cfg.RabbitMQAmqpString, Logger: logger})
+		if err != nil {
+			logger.ErrorContext(ctx, "rabbitMQ initialize connection failed", logging.Err(err))
+			return ExitError
+		}
+		defer rmq.Close()
+
+		peek = func() ([]dlq.Message, error) { return rmq.PeekDLQ(ctx, opts.Source, opts.Limit, opts.Filter) }
+		republish = func() (int, error) {
+			return rmq.RepublishDLQ(ctx, opts.Source, opts.Target, opts.Limit, opts.Filter)
+		}
+
+	case BrokerKafka:
+		if opts.Source == "" {
+			logger.ErrorContext(ctx, "dlq topic is required for kafka")
+			return ExitError
+		}
+		producercfg := kafka.NewKafkaConfigMap()
+		producercfg.Set(fmt.Sprintf("bootstrap.servers=%s:%s", cfg.KafkaHost, cfg.KafkaPort))
+
+		// the producer config is also used to read the dlq topic with a throwaway group
+		kc, err := kafka.NewKafkaProducerClient(producercfg)
+		if err != nil {
+			logger.ErrorContext(ctx, "error initialize kafka client", logging.Err(err))
+			return ExitError
+		}
+		kc.Logger = logger
+		defer kc.Close()
+
+		peek = func() ([]dlq.Message, error) { return kc.PeekDLQ(ctx, opts.Source, opts.Limit, opts.Filter) }
+		republish = func() (int, error) {
+			return kc.RepublishDLQ(ctx, opts.Source, opts.Target, opts.Limit, opts.Filter)
+		}
+
+	default:
+		logger.ErrorContext(ctx, "invalid broker, valid brokers are: kafka | rabbitmq", "broker", opts.Broker)
+		return ExitError
+	}
+
+	switch opts.Action {
+	case ActionList, ActionPeek:
+		messages, err := peek()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to read dlq", "source", opts.Source, logging.Err(err))
+			return ExitError
+		}
+		if err := write(out, opts, messages); err != nil {
+			logger.ErrorContext(ctx, "failed to write dlq messages", logging.Err(err))
+			return ExitError
+		}
+
+	case ActionRepublish:
+		n, err := republish()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to republish dlq messages", "source", opts.Source, "republished", n, logging.Err(err))
+			return ExitError
+		}
+		fmt.Fprintf(out, "republished %d message(s) from %s\n", n, opts.Source)
+
+	default:
+		logger.ErrorContext(ctx, "invalid action, valid actions are: list | peek | republish", "action", opts.Action)
+		return ExitError
+	}
+
+	return ExitOK
+}
+
+func write(out io.Writer, opts Options, messages []dlq.Message) error {
+	if opts.Format == FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if opts.Action == ActionList {
+			// list leaves bodies out like the table output
+			for i := range messages {
+				messages[i].Body = nil
+			}
+		}
+		return enc.Encode(messages)
+	}
+
+	if opts.Action == ActionPeek {
+		for _, m := range messages {
+			fmt.Fprintf(out, "id: %s\nsource: %s\nfailed at: %s\nheaders:\n", m.ID, m.Source, m.FailedAt().Format(time.RFC3339))
+			for k, v := range m.Headers {
+				fmt.Fprintf(out, "  %s: %s\n", k, v)
+			}
+			fmt.Fprintf(out, "body:\n%s\n\n", m.Body)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSOURCE\tFAILED AT\tRETRIES\tSIZE\tERROR")
+	for _, m := range messages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n",
+			m.ID, m.Source, m.FailedAt().Format(time.RFC3339), m.RetryCount(), len(m.Body), truncate(m.Error(), maxErrorWidth))
+	}
+	return w.Flush()
+}
+
+// ParseHeaders parses "k1=v1,k2=v2" filter flags
+func ParseHeaders(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid header filter %q, expected key=value", pair)
+		}
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
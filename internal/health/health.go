@@ -0,0 +1,282 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 5 * time.Second
+)
+
+// Kind tells which probe a check belongs to.
+// liveness failing means the process should be restarted, readiness failing only stops traffic,
+// so dependencies (brokers, databases) belong to readiness.
+type Kind int
+
+const (
+	Liveness Kind = 1 << iota
+	Readiness
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Checker reports the health of one dependency, nil means healthy
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to Checker
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// HealthChecker is satisfied by kafka.KafkaClient and rabbitmq.RabbitMQBroker
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Pinger is satisfied by the storage clients (postgres, mongodb, redis, sqlite)
+type Pinger interface {
+	Ping() error
+}
+
+// Broker checks a broker client through its HealthCheck.
+// kafka's HealthCheck blocks in librdkafka, so the deadline is also enforced around the call.
+func Broker(c HealthChecker) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return runWithContext(ctx, func() error { return c.HealthCheck(ctx) })
+	})
+}
+
+// Ping checks a storage client, Ping has no context so the deadline is enforced around the call
+func Ping(p Pinger) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return runWithContext(ctx, p.Ping)
+	})
+}
+
+// Heartbeat is a liveness check failing when last reports a time older than maxAge.
+// a zero time means the loop has not started yet and counts as alive.
+func Heartbeat(last func() time.Time, maxAge time.Duration) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return nil
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("no heartbeat for %s", age.Round(time.Second))
+		}
+		return nil
+	})
+}
+
+// Unavailable always fails with reason, it holds the place of a dependency not connected yet or closed
+// so readiness is down rather than missing the check
+func Unavailable(reason string) Checker {
+	return CheckerFunc(func(context.Context) error { return errors.New(reason) })
+}
+
+// runWithContext returns when fn does or ctx is done, whichever comes first.
+// fn keeps running in the background after ctx is done.
+func runWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("check panicked: %v", rec)
+			}
+		}()
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cfg configures a Registry, zero value uses defaults
+type Cfg struct {
+	Timeout  time.Duration // per check deadline, default 2s
+	CacheTTL time.Duration // results are reused for this long so probes don't hammer dependencies, default 5s
+}
+
+// Result of a single check
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report aggregates the checks of one probe, Status is down when any check is down
+// or, for readiness, once the registry is draining
+type Report struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining,omitempty"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+func (r Report) Up() bool { return r.Status == StatusUp }
+
+// Registry holds named checks and runs them on demand
+type Registry struct {
+	cfg Cfg
+
+	mu       sync.RWMutex
+	checks   map[string]*check
+	draining atomic.Bool
+}
+
+type check struct {
+	kind    Kind
+	checker Checker
+
+	mu     sync.Mutex // serializes runs, concurrent probes wait for and share one result
+	result Result
+}
+
+func NewRegistry(cfg Cfg) *Registry {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	return &Registry{cfg: cfg, checks: make(map[string]*check)}
+}
+
+// Register adds or replaces the check name for the given probes, e.g. Readiness or Liveness|Readiness
+func (r *Registry) Register(name string, kind Kind, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = &check{kind: kind, checker: c}
+}
+
+// Unregister removes the check name, e.g. when its client is closed
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Drain reports readiness down from now on, call it once shutdown starts so traffic stops
+// while dependencies are still closing
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Names returns registered check names of kind in sorted order
+func (r *Registry) Names(kind Kind) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.checks))
+	for name, c := range r.checks {
+		if c.kind&kind != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check runs every check of kind concurrently, returning cached results younger than CacheTTL
+func (r *Registry) Check(ctx context.Context, kind Kind) Report {
+	r.mu.RLock()
+	selected := make(map[string]*check, len(r.checks))
+	for name, c := range r.checks {
+		if c.kind&kind != 0 {
+			selected[name] = c
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(selected))}
+	if kind&Readiness != 0 && r.draining.Load() {
+		report.Status = StatusDown
+		report.Draining = true
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, c := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := r.run(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if res.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// CheckOne runs the check name, false when it is not registered
+func (r *Registry) CheckOne(ctx context.Context, name string) (Result, bool) {
+	r.mu.RLock()
+	c, ok := r.checks[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return Result{}, false
+	}
+	return r.run(ctx, c), true
+}
+
+func (r *Registry) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < r.cfg.CacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := safeCheck(ctx, c.checker)
+
+	res := Result{Status: StatusUp, Duration: time.Since(start).String(), CheckedAt: start}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			res.Error = fmt.Sprintf("timed out after %s", r.cfg.Timeout)
+		}
+	}
+
+	c.result = res
+	return res
+}
+
+// safeCheck keeps a panicking checker from taking down the probe endpoint
+func safeCheck(ctx context.Context, c Checker) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("check panicked: %v", rec)
+		}
+	}()
+	return c.Check(ctx)
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type blockingBroker struct{ release chan struct{} }
+
+// HealthCheck ignores ctx like kafka's GetMetadata
+func (b blockingBroker) HealthCheck(ctx context.Context) error {
+	<-b.release
+	return nil
+}
+
+func TestBrokerHonorsDeadline(t *testing.T) {
+	b := blockingBroker{release: make(chan struct{})}
+	defer close(b.release)
+
+	r := NewRegistry(Cfg{Timeout: 50 * time.Millisecond})
+	r.Register("broker", Readiness, Broker(b))
+
+	start := time.Now()
+	report := r.Check(context.Background(), Readiness)
+	if report.Up() {
+		t.Fatal("blocked broker reported up")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("check took %s", elapsed)
+	}
+	if got := report.Checks["broker"].Error; got != "timed out after 50ms" {
+		t.Fatalf("got error %q", got)
+	}
+}
+
+type panickingBroker struct{}
+
+func (panickingBroker) HealthCheck(ctx context.Context) error { panic("boom") }
+
+func TestBrokerPanicRecovered(t *testing.T) {
+	c := Broker(panickingBroker{})
+	if err := c.Check(context.Background()); err == nil {
+		t.Fatal("expected error from panicking check")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var last time.Time
+	c := Heartbeat(func() time.Time { return last }, time.Minute)
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatalf("not started: %v", err)
+	}
+
+	last = time.Now().Add(-30 * time.Second)
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatalf("recent heartbeat: %v", err)
+	}
+
+	last = time.Now().Add(-2 * time.Minute)
+	err := c.Check(context.Background())
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stale heartbeat: got %v", err)
+	}
+}
+
+func TestDrainReportsReadinessDown(t *testing.T) {
+	r := NewRegistry(Cfg{})
+	r.Register("broker", Readiness, CheckerFunc(func(context.Context) error { return nil }))
+	r.Register("loop", Liveness, CheckerFunc(func(context.Context) error { return nil }))
+
+	if report := r.Check(context.Background(), Readiness); !report.Up() {
+		t.Fatalf("ready before drain: %+v", report)
+	}
+
+	r.Drain()
+	report := r.Check(context.Background(), Readiness)
+	if report.Up() || !report.Draining {
+		t.Fatalf("draining registry reported %+v", report)
+	}
+	if report.Checks["broker"].Status != StatusUp {
+		t.Fatalf("checks still run while draining, got %+v", report.Checks["broker"])
+	}
+	if report := r.Check(context.Background(), Liveness); !report.Up() {
+		t.Fatalf("drain must not fail liveness: %+v", report)
+	}
+}
+
+func TestUnavailableHoldsReadinessDown(t *testing.T) {
+	r := NewRegistry(Cfg{})
+	r.Register("kafka", Readiness, Unavailable("not connected"))
+
+	report := r.Check(context.Background(), Readiness)
+	if report.Up() {
+		t.Fatal("unavailable dependency reported ready")
+	}
+	if got := report.Checks["kafka"].Error; got != "not connected" {
+		t.Fatalf("got error %q", got)
+	}
+
+	// replacing the placeholder drops its cached result
+	r.Register("kafka", Readiness, CheckerFunc(func(context.Context) error { return nil }))
+	if report := r.Check(context.Background(), Readiness); !report.Up() {
+		t.Fatalf("connected dependency: %+v", report)
+	}
+}
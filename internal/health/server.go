@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Serve exposes /healthz and /readyz on addr until ctx is done, for probes on a listener of their own
+func (r *Registry) Serve(ctx context.Context, logger *slog.Logger, addr string) error {
+	mux := http.NewServeMux()
+	r.RegisterHTTP(mux)
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("health server shutdown error", logging.Err(err))
+		}
+	}()
+
+	logger.Info("health server running", "addr", addr, "paths", "/healthz /readyz")
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// RegisterHTTP adds /healthz (liveness) and /readyz (readiness) to mux
+func (r *Registry) RegisterHTTP(mux *http.ServeMux) {
+	mux.Handle("/healthz", r.Handler(Liveness))
+	mux.Handle("/readyz", r.Handler(Readiness))
+}
+
+// Handler serves the report of kind as json, 200 when up and 503 when down
+func (r *Registry) Handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Check(req.Context(), kind)
+
+		status := http.StatusOK
+		if !report.Up() {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// GRPCServer returns a grpc health server kept in sync with readiness checks every interval until ctx is done.
+// service "" reports overall readiness, each registered check is also served under its own name.
+func (r *Registry) GRPCServer(ctx context.Context, interval time.Duration) *grpchealth.Server {
+	srv := grpchealth.NewServer()
+	r.syncGRPC(ctx, srv)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				srv.Shutdown()
+				return
+			case <-ticker.C:
+				r.syncGRPC(ctx, srv)
+			}
+		}
+	}()
+
+	return srv
+}
+
+func (r *Registry) syncGRPC(ctx context.Context, srv *grpchealth.Server) {
+	report := r.Check(ctx, Readiness)
+
+	srv.SetServingStatus("", servingStatus(report.Status))
+	for name, res := range report.Checks {
+		srv.SetServingStatus(name, servingStatus(res.Status))
+	}
+}
+
+func servingStatus(status string) healthpb.HealthCheckResponse_ServingStatus {
+	if status == StatusUp {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
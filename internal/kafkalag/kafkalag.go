@@ -0,0 +1,128 @@
+package kafkalag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/lzf-12/go-example-collections/internal/config"
+	"github.com/lzf-12/go-example-collections/msgbroker/adapter/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+// exit codes for scripts
+const (
+	ExitOK              = 0
+	ExitError           = 1
+	ExitThresholdExceed = 2
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Options of the kafka-lag command
+type Options struct {
+	Group       string   // consumer group, KAFKA_CONSUMER_GROUP_ID when empty
+	Topics      []string // all topics the group committed on when empty
+	Format      string   // table or json
+	MaxLag      int64    // per partition threshold, 0 disables
+	MaxTotalLag int64    // sum over all partitions threshold, 0 disables
+}
+
+type report struct {
+	Partitions []kafka.PartitionLag `json:"partitions"`
+	TotalLag   int64                `json:"total_lag"`
+	Exceeded   []string             `json:"exceeded,omitempty"`
+}
+
+// Run prints the lag of the group to out and returns the process exit code,
+// ExitThresholdExceed when any threshold is exceeded so it can gate scripts and autoscalers.
+func Run(ctx context.Context, logger *slog.Logger, opts Options, out io.Writer) int {
+	cfg, err := config.LoadConfig(".env")
+	if err != nil {
+		logger.ErrorContext(ctx, "load config failed", logging.Err(err))
+		return ExitError
+	}
+
+	if opts.Group == "" {
+		opts.Group = cfg.KafkaConsumerGroupID
+	}
+
+	consumercfg := kafka.NewKafkaConfigMap()
+	consumercfg.Set(fmt.Sprintf("bootstrap.servers=%s:%s", cfg.KafkaHost, cfg.KafkaPort))
+	consumercfg.Set(fmt.Sprintf("group.id=%s", opts.Group))
+
+	kc, err := kafka.NewKafkaConsumerClient(consumercfg, kafka.NewKafkaConfigMap())
+	if err != nil {
+		logger.ErrorContext(ctx, "error initialize kafka client", logging.Err(err))
+		return ExitError
+	}
+	kc.Logger = logger
+	defer kc.Close()
+
+	lags, err := kc.GroupLag(ctx, opts.Group, opts.Topics)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get consumer group lag", "group", opts.Group, logging.Err(err))
+		return ExitError
+	}
+
+	rep := report{Partitions: lags}
+	for _, l := range lags {
+		rep.TotalLag += l.Lag
+		if opts.MaxLag > 0 && l.Lag > opts.MaxLag {
+			rep.Exceeded = append(rep.Exceeded, fmt.Sprintf("%s[%d] lag %d > %d", l.Topic, l.Partition, l.Lag, opts.MaxLag))
+		}
+	}
+	if opts.MaxTotalLag > 0 && rep.TotalLag > opts.MaxTotalLag {
+		rep.Exceeded = append(rep.Exceeded, fmt.Sprintf("total lag %d > %d", rep.TotalLag, opts.MaxTotalLag))
+	}
+
+	switch opts.Format {
+	case FormatJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	case FormatTable, "":
+		err = writeTable(out, rep)
+	default:
+		logger.ErrorContext(ctx, "invalid format, valid formats are: table | json", "format", opts.Format)
+		return ExitError
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to write lag report", logging.Err(err))
+		return ExitError
+	}
+
+	if len(rep.Exceeded) > 0 {
+		return ExitThresholdExceed
+	}
+	return ExitOK
+}
+
+func writeTable(out io.Writer, rep report) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "GROUP\tTOPIC\tPARTITION\tCOMMITTED\tHIGH WATERMARK\tLAG\t")
+	for _, l := range rep.Partitions {
+		committed := "-"
+		if l.Committed >= 0 {
+			committed = fmt.Sprint(l.Committed)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t\n", l.Group, l.Topic, l.Partition, committed, l.HighWatermark, l.Lag)
+	}
+	fmt.Fprintf(w, "\t\t\t\tTOTAL\t%d\t\n", rep.TotalLag)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, e := range rep.Exceeded {
+		if _, err := fmt.Fprintln(out, "threshold exceeded:", e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,8 +17,20 @@ import (
 
 	"github.com/lzf-12/go-example-collections/internal/api/graphql"
 	"github.com/lzf-12/go-example-collections/internal/api/grpc"
+	"github.com/lzf-12/go-example-collections/internal/api/metrics"
 	"github.com/lzf-12/go-example-collections/internal/api/rest"
 	"github.com/lzf-12/go-example-collections/internal/consumer"
+	"github.com/lzf-12/go-example-collections/internal/dlqtool"
+	"github.com/lzf-12/go-example-collections/internal/health"
+	"github.com/lzf-12/go-example-collections/internal/kafkalag"
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 )
 
 const shutdowntimeout = 10 * time.Second
@@ -25,10 +39,84 @@ func main() {
 
 	mode := flag.String("mode",
 		"resthttp",
-		"available mode: resthttp | restgin | restfiber | graphql | grpc | consumer-rabbitmq | consumer-kafka")
+		"available mode: resthttp | restgin | restfiber | graphql | grpc | consumer-rabbitmq | consumer-kafka | kafka-lag | dlq")
+	metricsAddr := flag.String("metrics-addr", ":9090", "prometheus /metrics listen address, also serving /healthz and /readyz unless -health-addr is set, empty to disable")
+	healthAddr := flag.String("health-addr", "", "/healthz and /readyz listen address of their own, served on -metrics-addr when empty")
+	logLevel := flag.String("log-level", "info", "log level: debug | info | warn | error")
+	showPayload := flag.Bool("log-payload", false, "log message payloads in clear text, for local debugging only")
+	lagGroup := flag.String("group", "", "kafka-lag: consumer group, KAFKA_CONSUMER_GROUP_ID when empty")
+	lagTopics := flag.String("topics", "", "kafka-lag: comma separated topics, all topics with committed offsets when empty")
+	lagFormat := flag.String("format", kafkalag.FormatTable, "kafka-lag, dlq: output format table | json")
+	lagMax := flag.Int64("max-lag", 0, "kafka-lag: exit 2 when any partition lag exceeds this, 0 disables")
+	lagMaxTotal := flag.Int64("max-total-lag", 0, "kafka-lag: exit 2 when total lag exceeds this, 0 disables")
+	dlqBroker := flag.String("broker", dlqtool.BrokerRabbitMQ, "dlq: broker kafka | rabbitmq")
+	dlqAction := flag.String("action", dlqtool.ActionList, "dlq: action list | peek | republish")
+	dlqSource := flag.String("dlq", "", "dlq: dead letter queue or topic, RABBITMQ_DEFAULT_DLQ when empty for rabbitmq")
+	dlqTarget := flag.String("target", "", "dlq: republish to this topic / routing key instead of the original one")
+	dlqLimit := flag.Int("limit", 0, "dlq: max messages to list or republish, 0 for all")
+	dlqIDs := flag.String("ids", "", "dlq: comma separated message ids to select")
+	dlqHeaders := flag.String("header", "", "dlq: comma separated key=value headers messages must have")
+	dlqSince := flag.String("since", "", "dlq: select messages failed at or after this RFC3339 time")
+	dlqUntil := flag.String("until", "", "dlq: select messages failed before this RFC3339 time")
 	flag.Parse()
 	serverMode := strings.ToLower(*mode)
 
+	logger := newLogger(os.Stdout, *logLevel, *showPayload)
+	slog.SetDefault(logger)
+
+	// one-shot command, prints and exits. logs go to stderr to keep the report parseable
+	if serverMode == "kafka-lag" {
+		logger = newLogger(os.Stderr, *logLevel, *showPayload)
+		slog.SetDefault(logger)
+
+		var topics []string
+		if *lagTopics != "" {
+			topics = strings.Split(*lagTopics, ",")
+		}
+		os.Exit(kafkalag.Run(context.Background(), logger, kafkalag.Options{
+			Group:       *lagGroup,
+			Topics:      topics,
+			Format:      *lagFormat,
+			MaxLag:      *lagMax,
+			MaxTotalLag: *lagMaxTotal,
+		}, os.Stdout))
+	}
+
+	if serverMode == "dlq" {
+		logger = newLogger(os.Stderr, *logLevel, *showPayload)
+		slog.SetDefault(logger)
+
+		filter, err := dlqFilter(*dlqIDs, *dlqHeaders, *dlqSince, *dlqUntil)
+		if err != nil {
+			logger.Error("invalid dlq filter", logging.Err(err))
+			os.Exit(dlqtool.ExitError)
+		}
+		os.Exit(dlqtool.Run(context.Background(), logger, dlqtool.Options{
+			Broker: *dlqBroker,
+			Action: *dlqAction,
+			Source: *dlqSource,
+			Target: *dlqTarget,
+			Limit:  *dlqLimit,
+			Format: *lagFormat,
+			Filter: filter,
+		}, os.Stdout))
+	}
+
+	// w3c trace context for incoming requests, spans are exported when an otlp endpoint is configured
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	shutdownTracing, err := setupTracing(context.Background(), serverMode)
+	if err != nil {
+		logger.Error("tracing setup failed", logging.Err(err))
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdowntimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("tracing shutdown error", logging.Err(err))
+		}
+	}()
+
 	// channel for shutdown signal
 	shutdownSig := make(chan os.Signal, 1)
 	signal.Notify(shutdownSig, syscall.SIGINT, syscall.SIGTERM)
@@ -39,31 +127,43 @@ func main() {
 	shutdownctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// broker consumers replace their placeholder readiness checks once connected
+	healthRegistry := health.NewRegistry(health.Cfg{})
+
+	// metrics and probes outlive the dependencies so readiness reports the drain until exit
+	serverctx, stopServers := context.WithCancel(context.Background())
+	defer stopServers()
+
+	probesOnMetrics := *healthAddr == ""
+	if probesOnMetrics && *metricsAddr == "" {
+		logger.Warn("health probes disabled, set -health-addr or -metrics-addr to serve /healthz and /readyz")
+	}
+
 	switch serverMode {
 	case "resthttp":
 		go func() {
-			if err := rest.ServeRestHttp(shutdownctx); err != nil {
+			if err := rest.ServeRestHttp(shutdownctx, logger); err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	case "restgin":
 		go func() {
-			if err := rest.ServeRestGin(shutdownctx); err != nil {
+			if err := rest.ServeRestGin(shutdownctx, logger); err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	case "restfiber":
 		go func() {
-			if err := rest.ServeRestFiber(shutdownctx); err != nil {
+			if err := rest.ServeRestFiber(shutdownctx, logger); err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	case "graphql":
 		go func() {
-			err := graphql.ServeGraphql(shutdownctx)
+			err := graphql.ServeGraphql(shutdownctx, logger)
 			if err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
@@ -71,41 +171,64 @@ func main() {
 		}()
 	case "grpc":
 		go func() {
-			err := grpc.ServeGrpc(shutdownctx)
+			err := grpc.ServeGrpc(shutdownctx, logger, healthRegistry)
 			if err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	case "consumer-rabbitmq":
+		healthRegistry.Register("rabbitmq", health.Readiness, health.Unavailable("not connected"))
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := consumer.ServeRabbitMQConsumer(shutdownctx); err != nil {
+			if err := consumer.ServeRabbitMQConsumer(shutdownctx, logger, healthRegistry); err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	case "consumer-kafka":
+		healthRegistry.Register("kafka", health.Readiness, health.Unavailable("not connected"))
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := consumer.ServeKafkaConsumer(shutdownctx); err != nil {
+			if err := consumer.ServeKafkaConsumer(shutdownctx, logger, healthRegistry); err != nil {
 				serverErrs <- err
 				shutdownSig <- os.Interrupt
 			}
 		}()
 	default:
-		log.Printf("%s. is invalid mode. valid mode are: resthttp | restgin | restfiber | graphql | grpc | consumer-rabbitmq | consumer-kafka", serverMode)
+		logger.Error("invalid mode. valid mode are: resthttp | restgin | restfiber | graphql | grpc | consumer-rabbitmq | consumer-kafka | kafka-lag | dlq", "mode", serverMode)
 		os.Exit(1)
 	}
 
+	if *healthAddr != "" {
+		go func() {
+			if err := healthRegistry.Serve(serverctx, logger, *healthAddr); err != nil {
+				logger.Error("health server error", logging.Err(err))
+			}
+		}()
+	}
+
+	if *metricsAddr != "" {
+		var probes *health.Registry
+		if probesOnMetrics {
+			probes = healthRegistry
+		}
+		go func() {
+			if err := metrics.ServeMetrics(serverctx, logger, *metricsAddr, probes); err != nil {
+				logger.Error("metrics server error", logging.Err(err))
+			}
+		}()
+	}
+
 	// wait for shutdown signal
 	<-shutdownSig
-	log.Println("shutdown signal received...")
+	logger.Info("shutdown signal received")
 
+	healthRegistry.Drain()
 	cancel()
-	log.Println("sending shutdown context to dependency...")
+	logger.Info("sending shutdown context to dependency")
 
 	// wait for dependency shutdown
 	shutdownDone := make(chan struct{})
@@ -116,19 +239,87 @@ func main() {
 
 	select {
 	case <-shutdownDone:
-		log.Println("clean shutdown")
+		logger.Info("clean shutdown")
 	case <-time.After(shutdowntimeout):
-		log.Println("shutdown process taking too long - forcing exit")
+		logger.Warn("shutdown process taking too long - forcing exit")
 	case sig := <-shutdownSig: // second signal
-		log.Printf("received %v - forcing exit", sig)
+		logger.Warn("second signal received - forcing exit", "signal", sig.String())
 	}
 
 	// check for catch errors
 	select {
 	case err := <-serverErrs:
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("server error: %v", err)
+			logger.Error("server error", logging.Err(err))
 		}
 	default:
 	}
 }
+
+// setupTracing installs a global tracer provider exporting spans over otlp/grpc when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, the exporter takes its other settings from OTEL_EXPORTER_OTLP_* too.
+// without an endpoint spans stay no-op. the returned func flushes and stops the provider.
+func setupTracing(ctx context.Context, mode string) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp trace exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the mode based service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("go-example-collections-"+mode)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// newLogger builds the json logger shared by servers and broker clients,
+// records carry trace/span ids and credentials and payloads are redacted.
+func newLogger(w io.Writer, level string, showPayload bool) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	rules := logging.DefaultRedactRules
+	rules.ShowPayload = showPayload
+
+	next := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})
+	return slog.New(logging.NewHandler(next, rules))
+}
+
+// dlqFilter builds the dlq message filter from the command flags
+func dlqFilter(ids, headers, since, until string) (dlq.Filter, error) {
+	var (
+		filter dlq.Filter
+		err    error
+	)
+	if ids != "" {
+		filter.IDs = strings.Split(ids, ",")
+	}
+	if filter.Headers, err = dlqtool.ParseHeaders(headers); err != nil {
+		return filter, err
+	}
+	if since != "" {
+		if filter.From, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until != "" {
+		if filter.To, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	return filter, nil
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
 )
 
 // create topic only if not exist, otherwise skip creating topic
@@ -53,7 +53,7 @@ func (kc *KafkaClient) CreateTopicsIfNotExist(ctx context.Context, topicHandlers
 
 			// topic exist
 			if tp.Error.Code() == kafka.ErrNoError {
-				log.Printf("topic %s already exist, skip creating topic...", th.Topic)
+				kc.logger().InfoContext(ctx, "topic already exist, skip creating topic", logging.KeyTopic, th.Topic)
 				continue
 			}
 		}
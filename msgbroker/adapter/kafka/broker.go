@@ -2,13 +2,17 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -18,14 +22,18 @@ const (
 var (
 	ErrProducerNotInitialized = errors.New("producer not initialized")
 	ErrConsumerNotInitialized = errors.New("consumer not initialized")
+	ErrClientClosed           = errors.New("kafka client closed")
 )
 
 type Message struct {
 	Key       string
 	Value     []byte
-	Headers   map[string]string
+	Headers   Headers
 	Timestamp time.Time
 	Topic     *string
+	Partition int32  // set on consumed messages
+	Offset    int64  // set on consumed messages
+	Group     string // consumer group, set on messages consumed by SubscribeTopics
 }
 
 type KafkaClient struct {
@@ -33,7 +41,19 @@ type KafkaClient struct {
 	Consumer     *kafka.Consumer
 	Admin        *kafka.AdminClient
 	ConfigMap    *kafka.ConfigMap
+	ConsumerCfg  ConsumerCfg
+	Logger       logging.Logger        // structured logger, slog.Default when nil. set before subscribing or publishing
+	Partitioner  Partitioner           // partition of published messages, librdkafka "partitioner" config decides when nil
+	Interceptors []ProducerInterceptor // applied in order to every published message
+	Payload      payload.Transformer   // compression / claim-check of message values, applied on publish and consume
 	errorChannel chan error
+
+	partitionCounts  sync.Map           // topic -> partitionCount, used by Partitioner
+	partitionFetches singleflight.Group // one metadata request per topic at a time
+	fetchMu          sync.Mutex         // guards closed and fetches.Add
+	fetches          sync.WaitGroup     // running metadata requests, Close waits for them before closing the producer
+	closed           bool               // set by Close, later metadata requests fail with ErrClientClosed
+	lastPoll         atomic.Int64       // unix nanos of the last consumer loop iteration, see LastPoll
 }
 
 func NewKafkaConfigMap() *kafka.ConfigMap {
@@ -51,11 +71,15 @@ func NewKafkaConsumerClient(consumerCfgMap *kafka.ConfigMap, adminCfgMap *kafka.
 		(*consumerCfgMap)["enable.auto.commit"] = false // Prefer manual commits for reliability
 	}
 
+	if _, ok := (*consumerCfgMap)["enable.auto.offset.store"]; !ok {
+		(*consumerCfgMap)["enable.auto.offset.store"] = false // only processed messages are stored, see SubscribeTopics
+	}
+
 	var consumerClient *kafka.Consumer
 
 	consumerClient, err := kafka.NewConsumer(consumerCfgMap)
 	if err != nil {
-		log.Println("error new consumer: ", err)
+		logging.Default().ErrorContext(context.Background(), "failed to create kafka consumer", logging.Err(err))
 		consumerClient.Close()
 		return nil, fmt.Errorf("failed to create new consumer: %w", err)
 	}
@@ -63,7 +87,7 @@ func NewKafkaConsumerClient(consumerCfgMap *kafka.ConfigMap, adminCfgMap *kafka.
 	// derive admin client from consumer
 	adminFromClient, err := kafka.NewAdminClientFromConsumer(consumerClient)
 	if err != nil {
-		log.Println("error new admin from consumer: ", err)
+		logging.Default().ErrorContext(context.Background(), "failed to create kafka admin from consumer", logging.Err(err))
 		adminFromClient.Close()
 		return nil, fmt.Errorf("failed to create new admin from consumer: %w", err)
 	}
@@ -116,8 +140,12 @@ func (kc *KafkaClient) handleEvents() {
 		case e := <-kc.Producer.Events():
 			switch ev := e.(type) {
 			case *kafka.Message:
+				topic := getTopicName(ev.TopicPartition.Topic)
 				if ev.TopicPartition.Error != nil {
+					metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageDeliver).Inc()
 					kc.errorChannel <- fmt.Errorf("delivery failed: %v", ev.TopicPartition.Error)
+				} else {
+					metrics.MessagesProduced.WithLabelValues(metrics.BrokerKafka, topic).Inc()
 				}
 			case kafka.Error:
 				kc.errorChannel <- fmt.Errorf("producer error: %v", ev)
@@ -131,6 +159,10 @@ func (kc *KafkaClient) handleEvents() {
 func (kc *KafkaClient) Close() error {
 	var errs []error
 
+	kc.fetchMu.Lock()
+	kc.closed = true
+	kc.fetchMu.Unlock()
+
 	if kc.Producer != nil {
 
 		// flushing for message guarantee, prevent loss, and orderly shutdown
@@ -138,7 +170,7 @@ func (kc *KafkaClient) Close() error {
 
 		if remainingevents > 0 {
 
-			log.Printf("Warning: %d messages remain after initial flush, retrying again ...", remainingevents)
+			kc.logger().WarnContext(context.Background(), "messages remain after flush", "remaining", remainingevents)
 			undelivered := kc.getUndeliveredMessages(remainingevents)
 
 			// Log the undelivered messages with details
@@ -148,6 +180,8 @@ func (kc *KafkaClient) Close() error {
 			errs = append(errs, fmt.Errorf("%d messages were not delivered", remainingevents))
 		}
 
+		// metadata requests outlive publishers that stopped waiting, they must finish before the handle goes away
+		kc.fetches.Wait()
 		kc.Producer.Close()
 	}
 
@@ -175,13 +209,17 @@ func (kc *KafkaClient) ErrorChannel() <-chan error {
 	return kc.errorChannel
 }
 
-// HealthCheck verifies Kafka connectivity
+// HealthCheck verifies Kafka connectivity, waiting at most until the ctx deadline
 func (kc *KafkaClient) HealthCheck(ctx context.Context) error {
 	if kc.Admin == nil {
 		return errors.New("admin client not initialized")
 	}
 
-	_, err := kc.Admin.GetMetadata(nil, true, int(defaultTimeout.Milliseconds()))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := kc.Admin.GetMetadata(nil, true, timeoutMs(ctx))
 	if err != nil {
 		return fmt.Errorf("kafka health check failed: %w", err)
 	}
@@ -189,6 +227,25 @@ func (kc *KafkaClient) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// LastPoll returns when SubscribeTopics last went around its fetch loop, zero before it started.
+// the loop blocks while a handler runs, so a stale value means a stuck handler or consumer.
+func (kc *KafkaClient) LastPoll() time.Time {
+	n := kc.lastPoll.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// timeoutMs is defaultTimeout in milliseconds for librdkafka calls, shortened to the ctx deadline
+func timeoutMs(ctx context.Context) int {
+	timeout := defaultTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	return max(int(timeout.Milliseconds()), 1)
+}
+
 // getUndeliveredMessages retrieves messages still in the producer queue
 func (kc *KafkaClient) getUndeliveredMessages(count int) []*kafka.Message {
 	undelivered := make([]*kafka.Message, 0, count)
@@ -211,42 +268,28 @@ func (kc *KafkaClient) getUndeliveredMessages(count int) []*kafka.Message {
 	return undelivered
 }
 
-// logUndeliveredMessages logs details about failed messages
+// logUndeliveredMessages logs details about failed messages, payloads are subject to logger redaction rules
 func (kc *KafkaClient) logUndeliveredMessages(messages []*kafka.Message) {
 	if len(messages) == 0 {
 		return
 	}
 
-	log.Printf("--- UNDELIVERED MESSAGES REPORT ---")
-	log.Printf("Count: %d", len(messages))
+	logger := kc.logger()
+	logger.WarnContext(context.Background(), "undelivered messages report", "count", len(messages))
 
 	for i, msg := range messages {
-		entry := struct {
-			Index     int
-			Topic     string
-			Partition int32
-			Key       string
-			Value     string
-			Error     string
-		}{
-			Index:     i + 1,
-			Topic:     *msg.TopicPartition.Topic,
-			Partition: msg.TopicPartition.Partition,
-			Error:     msg.TopicPartition.Error.Error(),
-		}
-
-		if msg.Key != nil {
-			entry.Key = string(msg.Key)
-		}
-
-		if msg.Value != nil {
-			entry.Value = string(msg.Value)
-		}
-
-		// Using JSON marshaling for structured logging
-		jsonData, _ := json.Marshal(entry)
-		log.Printf("Undelivered message: %s", jsonData)
+		logger.WarnContext(context.Background(), "undelivered message",
+			"index", i+1,
+			logging.KeyTopic, getTopicName(msg.TopicPartition.Topic),
+			logging.KeyPartition, msg.TopicPartition.Partition,
+			logging.KeyKey, string(msg.Key),
+			logging.Payload(msg.Value),
+			logging.Err(msg.TopicPartition.Error),
+		)
 	}
+}
 
-	log.Printf("--- END UNDELIVERED MESSAGES ---")
+// logger returns the configured logger or the default one
+func (kc *KafkaClient) logger() logging.Logger {
+	return logging.OrDefault(kc.Logger)
 }
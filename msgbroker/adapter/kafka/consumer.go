@@ -4,20 +4,69 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"strconv"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultPollInterval    = 100 * time.Millisecond
+	defaultShutdownTimeout = defaultTimeout
 )
 
 type TopicHandler struct {
 	Topic             string
-	Handler           func(Message) error
+	Handler           func(ctx context.Context, msg Message) error
+	Timeout           time.Duration // per message deadline of Handler context, 0 means no deadline
+	DLQTopic          string        // failed messages are published here and committed, requires a producer
 	Partitions        int
 	ReplicationFactor int
 }
 
-// subscribe starts consuming messages from a topic
+// kafka consumer-specific configuration, zero value uses defaults.
+// assignment protocol is chosen with "partition.assignment.strategy" in the consumer config map,
+// e.g. "cooperative-sticky" for incremental rebalancing, both eager and cooperative are handled.
+type ConsumerCfg struct {
+	ShutdownTimeout time.Duration  // max wait for in-flight handler before giving up on shutdown, default 10s
+	RebalanceHooks  RebalanceHooks // optional user callbacks on assignment changes
+
+	// OffsetStore makes an external database the source of consumer positions: assigned partitions start
+	// at the stored offsets and every processed message is recorded there. offsets are still committed
+	// to kafka, only for lag monitoring.
+	OffsetStore OffsetStore
+}
+
+// ShutdownError is returned by SubscribeTopics when messages were left unprocessed during shutdown.
+// their offsets were not committed, so they will be redelivered to the next group member.
+type ShutdownError struct {
+	Unprocessed []Message
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("%d message(s) left unprocessed on shutdown", len(e.Unprocessed))
+}
+
+// inflight tracks a message whose handler is still running
+type inflight struct {
+	raw      *kafka.Message
+	message  Message
+	dlqTopic string
+	ctx      context.Context // carries the consumer span, used for logging
+	done     chan error
+	cancel   context.CancelFunc
+	span     trace.Span
+	start    time.Time
+}
+
+// subscribe starts consuming messages from a topic.
+// on ctx cancellation it stops fetching, waits for the in-flight handler up to ConsumerCfg.ShutdownTimeout,
+// commits final offsets synchronously and unsubscribes. the caller is responsible for Close.
 func (kc *KafkaClient) SubscribeTopics(ctx context.Context, topicHandlers []TopicHandler) error {
 	if kc.Consumer == nil {
 		return ErrConsumerNotInitialized
@@ -27,92 +76,227 @@ func (kc *KafkaClient) SubscribeTopics(ctx context.Context, topicHandlers []Topi
 		return errors.New("error topic and handler map cannot empty")
 	}
 
-	handlerMap := make(map[string]func(Message) error)
+	handlerMap := make(map[string]TopicHandler)
 	var topics []string
 	for _, th := range topicHandlers {
-		handlerMap[th.Topic] = th.Handler
+		handlerMap[th.Topic] = th
 		topics = append(topics, th.Topic)
 	}
 
-	cb := func(consumer *kafka.Consumer, event kafka.Event) error {
-
-		log.Println("received new callback event: ", event.String())
-		switch ev := event.(type) {
-		case kafka.AssignedPartitions:
-			consumer.Assign(ev.Partitions)
-
-			for _, p := range ev.Partitions {
-				log.Printf("assigned topic=%s partition=%v offset=%v", getTopicName(p.Topic), p.Partition, p.Offset)
-			}
-
-		case kafka.RevokedPartitions:
-			consumer.Commit()
-			for _, p := range ev.Partitions {
-				log.Printf("revoked topic=%s partition=%v offset=%v", getTopicName(p.Topic), p.Partition, p.Offset)
-			}
-		}
-		return nil
-	}
-
-	err := kc.Consumer.SubscribeTopics(topics, cb)
+	err := kc.Consumer.SubscribeTopics(topics, kc.rebalanceCallback)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to topics: %w", err)
 	}
 
+	// handlers outlive shutdown signal until ShutdownTimeout, so they don't inherit ctx cancellation
+	handlerBaseCtx := context.WithoutCancel(ctx)
+
+	// handed to handlers with each message, e.g. for OffsetStore transactions
+	group, _ := kc.groupID()
+
 	for {
+		kc.lastPoll.Store(time.Now().UnixNano())
+
 		select {
 		case <-ctx.Done():
-			log.Println("unsub consumers from all topic...")
-			kc.Consumer.Unsubscribe()
-			log.Println("unsub done")
-			time.Sleep(5 * time.Second)
-			return nil
+			return kc.shutdownConsumer(nil)
 		default:
-			msg, err := kc.Consumer.ReadMessage(100 * time.Millisecond)
-			if err != nil {
-				if err.(kafka.Error).Code() == kafka.ErrTimedOut {
-					continue
-				}
-				return fmt.Errorf("consumer error: %w", err)
-			}
+		}
 
-			message := Message{
-				Topic:     msg.TopicPartition.Topic,
-				Value:     msg.Value,
-				Timestamp: msg.Timestamp,
+		msg, err := kc.Consumer.ReadMessage(defaultPollInterval)
+		if err != nil {
+			var kerr kafka.Error
+			if errors.As(err, &kerr) && kerr.Code() == kafka.ErrTimedOut {
+				continue
 			}
+			return fmt.Errorf("consumer error: %w", err)
+		}
 
-			if msg.Key != nil {
-				message.Key = string(msg.Key)
-			}
+		message := toMessage(msg)
+		message.Group = group
 
-			if len(msg.Headers) > 0 {
-				headers := make(map[string]string)
-				for _, header := range msg.Headers {
-					headers[header.Key] = string(header.Value)
-				}
-				message.Headers = headers
-			}
+		// get the appropriate handler for this topic
+		th, exists := handlerMap[*msg.TopicPartition.Topic]
+		if !exists {
+			kc.logger().WarnContext(ctx, "no handler found for topic", messageAttrs(message)...)
+			continue
+		}
 
-			// get the appropriate handler for this topic
-			handler, exists := handlerMap[*msg.TopicPartition.Topic]
-			if !exists {
-				log.Printf("no handler found for topic: %s", *msg.TopicPartition.Topic)
-				continue
-			}
+		// continue the producer trace carried in message headers
+		spanCtx, span := tracing.StartConsumerSpan(handlerBaseCtx, semconv.MessagingSystemKafka, th.Topic,
+			&message.Headers,
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(int(message.Partition))),
+			semconv.MessagingKafkaOffset(int(message.Offset)),
+			semconv.MessagingMessageBodySize(len(message.Value)),
+		)
 
-			if err := handler(message); err != nil {
-				log.Printf("message handling failed for topic %s: %v", *msg.TopicPartition.Topic, err)
-				continue
+		handlerCtx, cancel := handlerContext(spanCtx, th.Timeout)
+		current := &inflight{
+			raw:      msg,
+			message:  message,
+			dlqTopic: th.DLQTopic,
+			ctx:      spanCtx,
+			done:     make(chan error, 1),
+			cancel:   cancel,
+			span:     span,
+			start:    time.Now(),
+		}
+		go func() {
+			// decoded copy, current.message keeps the raw value and headers for logging and the dlq.
+			// headers are cloned since Set and Del filter in place on the shared backing array.
+			message := message
+			message.Headers = message.Headers.Clone()
+			if err := kc.decodePayload(handlerCtx, &message); err != nil {
+				current.done <- err
+				return
 			}
+			current.done <- th.Handler(handlerCtx, message)
+		}()
+
+		select {
+		case err := <-current.done:
+			cancel()
+			kc.completeMessage(current, err)
+		case <-ctx.Done():
+			return kc.shutdownConsumer(current)
+		}
+	}
+}
+
+// completeMessage records handler metrics and commits message offset after successful processing
+func (kc *KafkaClient) completeMessage(current *inflight, handlerErr error) bool {
+	ctx, msg := current.ctx, current.raw
+	topic := getTopicName(msg.TopicPartition.Topic)
+	metrics.ObserveHandler(metrics.BrokerKafka, topic, current.start, handlerErr)
+	tracing.End(current.span, handlerErr)
+
+	if handlerErr != nil {
+		kc.logger().ErrorContext(ctx, "message handling failed", append(messageAttrs(current.message), logging.Err(handlerErr))...)
+		if current.dlqTopic == "" {
+			return false
+		}
+
+		// dead-lettered messages are committed like processed ones
+		if err := kc.sendToDLQ(ctx, current.dlqTopic, current.message, handlerErr); err != nil {
+			metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageDLQ).Inc()
+			kc.logger().ErrorContext(ctx, "failed to send message to dlq", append(messageAttrs(current.message), logging.Err(err))...)
+			return false
+		}
+		kc.logger().WarnContext(ctx, "message sent to dlq", append(messageAttrs(current.message), "dlq_topic", current.dlqTopic)...)
+	}
+
+	if err := kc.storeOffset(ctx, msg); err != nil {
+		metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageCommit).Inc()
+		kc.logger().ErrorContext(ctx, "failed to save offset to offset store", append(messageAttrs(current.message), logging.Err(err))...)
+		return false
+	}
+
+	// store offset so commits triggered by rebalance never include unprocessed messages
+	if _, err := kc.Consumer.StoreMessage(msg); err != nil {
+		kc.logger().ErrorContext(ctx, "failed to store offset", append(messageAttrs(current.message), logging.Err(err))...)
+	}
+
+	// manual commit after successful processing
+	if _, err := kc.Consumer.CommitMessage(msg); err != nil {
+		metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageCommit).Inc()
+		kc.logger().ErrorContext(ctx, "failed to commit message", append(messageAttrs(current.message), logging.Err(err))...)
+		return false
+	}
+	return true
+}
 
-			// manual commit after successful processing
-			_, err = kc.Consumer.CommitMessage(msg)
-			if err != nil {
-				log.Printf("failed to commit message: %v", err)
+// shutdownConsumer waits for the in-flight handler (if any), commits its offset and unsubscribes
+func (kc *KafkaClient) shutdownConsumer(current *inflight) error {
+	kc.logger().InfoContext(context.Background(), "stop fetching, shutting down consumer")
+
+	var unprocessed []Message
+
+	if current != nil {
+		timeout := kc.ConsumerCfg.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case err := <-current.done:
+			timer.Stop()
+			current.cancel()
+
+			// commit is synchronous, so a successful handler is never redelivered
+			if !kc.completeMessage(current, err) {
+				unprocessed = append(unprocessed, current.message)
 			}
+		case <-timer.C:
+			current.cancel()
+			metrics.ObserveHandler(metrics.BrokerKafka, getTopicName(current.raw.TopicPartition.Topic), current.start, context.DeadlineExceeded)
+			tracing.End(current.span, context.DeadlineExceeded)
+			kc.logger().WarnContext(current.ctx, "in-flight handler did not finish before shutdown timeout",
+				append(messageAttrs(current.message), "timeout", timeout)...)
+			unprocessed = append(unprocessed, current.message)
+		}
+	}
+
+	if err := kc.Consumer.Unsubscribe(); err != nil {
+		kc.logger().ErrorContext(context.Background(), "failed to unsubscribe", logging.Err(err))
+	}
+	kc.logger().InfoContext(context.Background(), "unsubscribed consumer from all topics")
+
+	if len(unprocessed) > 0 {
+		for _, m := range unprocessed {
+			kc.logger().WarnContext(context.Background(), "unprocessed message", messageAttrs(m)...)
 		}
+		return &ShutdownError{Unprocessed: unprocessed}
+	}
+
+	return nil
+}
+
+// messageAttrs returns the log fields identifying a consumed message
+func messageAttrs(m Message) []any {
+	return []any{
+		logging.KeyTopic, getTopicName(m.Topic),
+		logging.KeyPartition, m.Partition,
+		logging.KeyOffset, m.Offset,
+	}
+}
+
+// decodePayload restores a value encoded by kc.Payload (decompression, claim-check lookup)
+func (kc *KafkaClient) decodePayload(ctx context.Context, msg *Message) error {
+	if kc.Payload == nil {
+		return nil
+	}
+	value, err := kc.Payload.Decode(ctx, msg.Value, &msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
 	}
+	msg.Value = value
+	return nil
+}
+
+func handlerContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+func toMessage(msg *kafka.Message) Message {
+	message := Message{
+		Topic:     msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Value:     msg.Value,
+		Timestamp: msg.Timestamp,
+	}
+
+	if msg.Key != nil {
+		message.Key = string(msg.Key)
+	}
+
+	message.Headers = fromKafkaHeaders(msg.Headers)
+
+	return message
 }
 
 func getTopicName(topic *string) string {
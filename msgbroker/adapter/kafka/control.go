@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// seek, skip and pause/resume controls for partitions currently assigned to this consumer.
+// they are safe to call from another goroutine while SubscribeTopics is running.
+
+// SeekOffset moves the fetch position of an assigned partition to offset
+func (kc *KafkaClient) SeekOffset(topic string, partition int32, offset int64) error {
+	if kc.Consumer == nil {
+		return ErrConsumerNotInitialized
+	}
+
+	err := kc.Consumer.Seek(kafka.TopicPartition{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    kafka.Offset(offset),
+	}, int(defaultTimeout.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("failed to seek topic %s partition %d to offset %d: %w", topic, partition, offset, err)
+	}
+	return nil
+}
+
+// SeekTimestamp moves the fetch position of an assigned partition to the first message at or after ts
+func (kc *KafkaClient) SeekTimestamp(topic string, partition int32, ts time.Time) error {
+	if kc.Consumer == nil {
+		return ErrConsumerNotInitialized
+	}
+
+	offset, err := offsetForTime(kc.Consumer, topic, partition, ts)
+	if err != nil {
+		return err
+	}
+
+	return kc.SeekOffset(topic, partition, offset)
+}
+
+// SkipMessage skips a poison message by committing and seeking past offset,
+// the skip survives restarts and rebalances since the offset is committed.
+func (kc *KafkaClient) SkipMessage(topic string, partition int32, offset int64) error {
+	if kc.Consumer == nil {
+		return ErrConsumerNotInitialized
+	}
+
+	next := kafka.TopicPartition{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    kafka.Offset(offset + 1),
+	}
+
+	if _, err := kc.Consumer.CommitOffsets([]kafka.TopicPartition{next}); err != nil {
+		return fmt.Errorf("failed to commit skipped offset: %w", err)
+	}
+
+	return kc.SeekOffset(topic, partition, offset+1)
+}
+
+// Pause stops fetching from the given partitions of topic, all assigned partitions of topic if none given.
+// use it for backpressure when downstream is slow, rebalance resets paused state.
+func (kc *KafkaClient) Pause(topic string, partitions ...int32) error {
+	if kc.Consumer == nil {
+		return ErrConsumerNotInitialized
+	}
+
+	tps, err := kc.topicPartitions(topic, partitions)
+	if err != nil {
+		return err
+	}
+
+	if err := kc.Consumer.Pause(tps); err != nil {
+		return fmt.Errorf("failed to pause topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Resume resumes fetching from partitions previously paused with Pause
+func (kc *KafkaClient) Resume(topic string, partitions ...int32) error {
+	if kc.Consumer == nil {
+		return ErrConsumerNotInitialized
+	}
+
+	tps, err := kc.topicPartitions(topic, partitions)
+	if err != nil {
+		return err
+	}
+
+	if err := kc.Consumer.Resume(tps); err != nil {
+		return fmt.Errorf("failed to resume topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// topicPartitions returns partitions of topic, defaulting to the current assignment of topic
+func (kc *KafkaClient) topicPartitions(topic string, partitions []int32) ([]kafka.TopicPartition, error) {
+	var tps []kafka.TopicPartition
+
+	if len(partitions) > 0 {
+		for _, p := range partitions {
+			tps = append(tps, kafka.TopicPartition{Topic: &topic, Partition: p})
+		}
+		return tps, nil
+	}
+
+	assigned, err := kc.Consumer.Assignment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment: %w", err)
+	}
+
+	for _, tp := range assigned {
+		if getTopicName(tp.Topic) == topic {
+			tps = append(tps, tp)
+		}
+	}
+
+	if len(tps) == 0 {
+		return nil, fmt.Errorf("no assigned partitions for topic %s", topic)
+	}
+	return tps, nil
+}
+
+// offsetForTime resolves the earliest offset whose timestamp is at or after ts,
+// returns the high watermark when no such message exists yet.
+func offsetForTime(consumer *kafka.Consumer, topic string, partition int32, ts time.Time) (int64, error) {
+	offsets, err := consumer.OffsetsForTimes([]kafka.TopicPartition{{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    kafka.Offset(ts.UnixMilli()),
+	}}, int(defaultTimeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get offset for time: %w", err)
+	}
+
+	if len(offsets) == 0 {
+		return 0, errors.New("no offset returned for time")
+	}
+	if offsets[0].Error != nil {
+		return 0, fmt.Errorf("failed to get offset for time: %w", offsets[0].Error)
+	}
+
+	if offsets[0].Offset < 0 {
+		_, high, err := consumer.QueryWatermarkOffsets(topic, partition, int(defaultTimeout.Milliseconds()))
+		if err != nil {
+			return 0, fmt.Errorf("failed to query watermark offsets: %w", err)
+		}
+		return high, nil
+	}
+
+	return int64(offsets[0].Offset), nil
+}
@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+)
+
+// errStopScan ends a dlq scan early once the limit is reached
+var errStopScan = errors.New("stop scan")
+
+// PeekDLQ returns up to limit (0 means all) messages of the dead letter topic matching filter.
+// the topic is read with a separate consumer that commits nothing, values are returned as stored.
+func (kc *KafkaClient) PeekDLQ(ctx context.Context, topic string, limit int, filter dlq.Filter) ([]dlq.Message, error) {
+	var out []dlq.Message
+
+	err := kc.scanDLQ(ctx, topic, filter, func(_ Message, m dlq.Message) error {
+		out = append(out, m)
+		if limit > 0 && len(out) >= limit {
+			return errStopScan
+		}
+		return nil
+	})
+	return out, err
+}
+
+// RepublishDLQ publishes up to limit (0 means all) messages matching filter back to the topic recorded
+// in dlq.HeaderOriginalTopic, or target when set, with dlq headers removed and the retry count bumped.
+// kafka topics are append only, republished messages stay in the DLQ, narrow the filter to avoid repeats.
+// requires a producer client.
+func (kc *KafkaClient) RepublishDLQ(ctx context.Context, topic, target string, limit int, filter dlq.Filter) (int, error) {
+	if kc.Producer == nil {
+		return 0, ErrProducerNotInitialized
+	}
+
+	republished := 0
+	err := kc.scanDLQ(ctx, topic, filter, func(msg Message, m dlq.Message) error {
+		dest := m.Headers[dlq.HeaderOriginalTopic]
+		if target != "" {
+			dest = target
+		}
+		if dest == "" {
+			kc.logger().WarnContext(ctx, "dlq message without original topic, skipped", logging.KeyTopic, topic, "id", m.ID)
+			return nil
+		}
+
+		headers := make(Headers, 0, len(msg.Headers)+1)
+		for _, h := range msg.Headers {
+			if !dlq.IsFailureHeader(h.Key) {
+				headers = append(headers, h)
+			}
+		}
+		headers.Set(dlq.HeaderRetryCount, strconv.Itoa(m.RetryCount()+1))
+
+		// value and headers are republished as stored, still encoded, so interceptors and Payload are skipped
+		err := kc.publish(ctx, dest, Message{Key: msg.Key, Value: msg.Value, Headers: headers})
+		metrics.ObservePublish(metrics.BrokerKafka, dest, err)
+		if err != nil {
+			return fmt.Errorf("failed to republish message %s: %w", m.ID, err)
+		}
+
+		republished++
+		kc.logger().InfoContext(ctx, "republished dlq message", logging.KeyTopic, dest, "id", m.ID, "retry_count", m.RetryCount()+1)
+		if limit > 0 && republished >= limit {
+			return errStopScan
+		}
+		return nil
+	})
+	return republished, err
+}
+
+// scanDLQ replays topic from filter.From (or the beginning) and calls fn for matching messages
+func (kc *KafkaClient) scanDLQ(ctx context.Context, topic string, filter dlq.Filter, fn func(msg Message, m dlq.Message) error) error {
+	from := filter.From
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+
+	_, err := kc.replay(ctx, ReplayCfg{Topic: topic, From: from}, false, func(_ context.Context, msg Message) error {
+		m := toDLQMessage(msg)
+		if !filter.Match(m) {
+			return nil
+		}
+		return fn(msg, m)
+	})
+	if errors.Is(err, errStopScan) {
+		return nil
+	}
+	return err
+}
+
+func toDLQMessage(msg Message) dlq.Message {
+	return dlq.Message{
+		ID:        fmt.Sprintf("%d:%d", msg.Partition, msg.Offset),
+		Source:    getTopicName(msg.Topic),
+		Headers:   msg.Headers.StringMap(),
+		Body:      msg.Value,
+		Timestamp: msg.Timestamp,
+	}
+}
+
+// sendToDLQ publishes the raw consumed message to the dead letter topic with the failure recorded in headers
+func (kc *KafkaClient) sendToDLQ(ctx context.Context, dlqTopic string, msg Message, cause error) error {
+	msg.Headers = msg.Headers.Clone()
+	for k, v := range dlq.FailureHeaders(getTopicName(msg.Topic), cause, time.Now()) {
+		msg.Headers.Set(k, v)
+	}
+	// value is still encoded as consumed, so it is not passed through Publish again
+	if err := kc.publish(ctx, dlqTopic, msg); err != nil {
+		return fmt.Errorf("failed to send message to dlq %s: %w", dlqTopic, err)
+	}
+	return nil
+}
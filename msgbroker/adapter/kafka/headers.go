@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var _ propagation.TextMapCarrier = (*Headers)(nil)
+
+// Header is a single kafka record header, values are raw bytes
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Headers keeps record headers in wire order, a key may appear more than once.
+// *Headers is a propagation.TextMapCarrier, Get/Set work on the first value of a key.
+type Headers []Header
+
+// Get returns the first value of key as string, empty when absent
+func (h Headers) Get(key string) string {
+	v, _ := h.Lookup(key)
+	return string(v)
+}
+
+// Lookup returns the first value of key
+func (h Headers) Lookup(key string) ([]byte, bool) {
+	for _, header := range h {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Values returns every value of key in order
+func (h Headers) Values(key string) [][]byte {
+	var values [][]byte
+	for _, header := range h {
+		if header.Key == key {
+			values = append(values, header.Value)
+		}
+	}
+	return values
+}
+
+// Has reports whether key is present
+func (h Headers) Has(key string) bool {
+	_, ok := h.Lookup(key)
+	return ok
+}
+
+// Keys returns distinct keys in order of first appearance
+func (h Headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	seen := make(map[string]struct{}, len(h))
+	for _, header := range h {
+		if _, ok := seen[header.Key]; ok {
+			continue
+		}
+		seen[header.Key] = struct{}{}
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// Add appends a value, existing values of key are kept
+func (h *Headers) Add(key string, value []byte) {
+	*h = append(*h, Header{Key: key, Value: value})
+}
+
+// Set replaces all values of key with a single string value
+func (h *Headers) Set(key, value string) {
+	h.SetBytes(key, []byte(value))
+}
+
+// SetBytes replaces all values of key with a single value, keeping the position of the first occurrence
+func (h *Headers) SetBytes(key string, value []byte) {
+	out := (*h)[:0]
+	replaced := false
+	for _, header := range *h {
+		if header.Key != key {
+			out = append(out, header)
+			continue
+		}
+		if !replaced {
+			out = append(out, Header{Key: key, Value: value})
+			replaced = true
+		}
+	}
+	if !replaced {
+		out = append(out, Header{Key: key, Value: value})
+	}
+	*h = out
+}
+
+// Del removes all values of key
+func (h *Headers) Del(key string) {
+	out := (*h)[:0]
+	for _, header := range *h {
+		if header.Key != key {
+			out = append(out, header)
+		}
+	}
+	*h = out
+}
+
+// Clone returns a copy that can be modified without affecting h
+func (h Headers) Clone() Headers {
+	if h == nil {
+		return nil
+	}
+	out := make(Headers, len(h))
+	copy(out, h)
+	return out
+}
+
+// StringMap flattens headers into a map of first values, e.g. for versioning.MetaFromHeaders
+func (h Headers) StringMap() map[string]string {
+	out := make(map[string]string, len(h))
+	for _, header := range h {
+		if _, ok := out[header.Key]; !ok {
+			out[header.Key] = string(header.Value)
+		}
+	}
+	return out
+}
+
+// Size is the encoded size of keys and values
+func (h Headers) Size() int {
+	size := 0
+	for _, header := range h {
+		size += len(header.Key) + len(header.Value)
+	}
+	return size
+}
+
+func fromKafkaHeaders(headers []kafka.Header) Headers {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(Headers, 0, len(headers))
+	for _, header := range headers {
+		out = append(out, Header{Key: header.Key, Value: header.Value})
+	}
+	return out
+}
+
+func toKafkaHeaders(headers Headers) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]kafka.Header, 0, len(headers))
+	for _, header := range headers {
+		out = append(out, kafka.Header{Key: header.Key, Value: header.Value})
+	}
+	return out
+}
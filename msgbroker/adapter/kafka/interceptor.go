@@ -0,0 +1,130 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
+)
+
+// headers set by the built-in interceptors
+const (
+	HeaderMessageID     = "x-message-id"
+	HeaderCorrelationID = "x-correlation-id"
+	HeaderSourceService = "x-source-service"
+)
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+// ProducerInterceptor runs on every message in Publish, PublishAsync and PublishJSON before it is produced.
+// it may modify msg, a returned error rejects the message.
+// msg.Headers is already a copy, the caller's headers are never mutated.
+type ProducerInterceptor func(ctx context.Context, topic string, msg *Message) error
+
+// intercept applies kc.Interceptors in order, stopping at the first error
+func (kc *KafkaClient) intercept(ctx context.Context, topic string, msg *Message) error {
+	for _, interceptor := range kc.Interceptors {
+		if err := interceptor(ctx, topic, msg); err != nil {
+			return fmt.Errorf("message rejected by interceptor: %w", err)
+		}
+	}
+	return nil
+}
+
+// MessageIDInterceptor sets a random (uuid v4) message id header when absent
+func MessageIDInterceptor() ProducerInterceptor {
+	return func(_ context.Context, _ string, msg *Message) error {
+		if msg.Headers.Has(HeaderMessageID) {
+			return nil
+		}
+		id, err := newUUID()
+		if err != nil {
+			return fmt.Errorf("failed to generate message id: %w", err)
+		}
+		msg.Headers.Set(HeaderMessageID, id)
+		return nil
+	}
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying the correlation id picked up by CorrelationIDInterceptor
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation id set by WithCorrelationID
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// CorrelationIDInterceptor sets the correlation id header from ctx when absent.
+// without one in ctx the message id is reused, so the message starts a new correlation chain.
+func CorrelationIDInterceptor() ProducerInterceptor {
+	return func(ctx context.Context, _ string, msg *Message) error {
+		if msg.Headers.Has(HeaderCorrelationID) {
+			return nil
+		}
+		if id, ok := CorrelationIDFromContext(ctx); ok {
+			msg.Headers.Set(HeaderCorrelationID, id)
+			return nil
+		}
+		if id, ok := msg.Headers.Lookup(HeaderMessageID); ok {
+			msg.Headers.SetBytes(HeaderCorrelationID, id)
+		}
+		return nil
+	}
+}
+
+// SourceServiceInterceptor sets the name of the producing service
+func SourceServiceInterceptor(service string) ProducerInterceptor {
+	return func(_ context.Context, _ string, msg *Message) error {
+		msg.Headers.Set(HeaderSourceService, service)
+		return nil
+	}
+}
+
+// SchemaVersionInterceptor sets event type and version headers (see versioning) per topic when absent,
+// topics missing from schemas are left untouched.
+func SchemaVersionInterceptor(schemas map[string]versioning.Meta) ProducerInterceptor {
+	return func(_ context.Context, topic string, msg *Message) error {
+		meta, ok := schemas[topic]
+		if !ok {
+			return nil
+		}
+		if !msg.Headers.Has(versioning.HeaderEventType) {
+			msg.Headers.Set(versioning.HeaderEventType, meta.Type)
+		}
+		if !msg.Headers.Has(versioning.HeaderEventVersion) {
+			msg.Headers.Set(versioning.HeaderEventVersion, strconv.Itoa(meta.Version))
+		}
+		return nil
+	}
+}
+
+// MaxSizeInterceptor rejects messages whose key, value and headers exceed maxBytes,
+// failing fast instead of waiting for the broker to refuse them (message.max.bytes).
+// register it last so headers added by other interceptors are counted.
+func MaxSizeInterceptor(maxBytes int) ProducerInterceptor {
+	return func(_ context.Context, topic string, msg *Message) error {
+		size := len(msg.Key) + len(msg.Value) + msg.Headers.Size()
+		if size > maxBytes {
+			return fmt.Errorf("%w: %d bytes exceeds %d bytes on topic %s", ErrMessageTooLarge, size, maxBytes, topic)
+		}
+		return nil
+	}
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
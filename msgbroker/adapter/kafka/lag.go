@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// PartitionLag is the position of a consumer group on one partition
+type PartitionLag struct {
+	Group         string `json:"group"`
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	Committed     int64  `json:"committed"` // -1 when the group has not committed on this partition
+	LowWatermark  int64  `json:"low_watermark"`
+	HighWatermark int64  `json:"high_watermark"`
+	Lag           int64  `json:"lag"`
+}
+
+// GroupLag reports committed offset, watermarks and lag of group on every partition of topics.
+// with no topics, all non-internal topics where the group has committed offsets are reported.
+// the admin API of this client version cannot list group offsets, so a consumer carrying the group id
+// fetches them; it never subscribes, the group membership is not affected.
+func (kc *KafkaClient) GroupLag(ctx context.Context, group string, topics []string) ([]PartitionLag, error) {
+	if kc.ConfigMap == nil {
+		return nil, ErrConsumerNotInitialized
+	}
+	if group == "" {
+		return nil, fmt.Errorf("group is required")
+	}
+
+	consumer, err := kafka.NewConsumer(kc.lagConfigMap(group))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lag consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	discover := len(topics) == 0
+	md, err := consumer.GetMetadata(nil, true, int(defaultTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	if discover {
+		for name := range md.Topics {
+			if !strings.HasPrefix(name, "__") {
+				topics = append(topics, name)
+			}
+		}
+	}
+	sort.Strings(topics)
+
+	var result []PartitionLag
+	for _, topic := range topics {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tm, ok := md.Topics[topic]
+		if !ok || tm.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("topic %s not found", topic)
+		}
+
+		partitions := make([]kafka.TopicPartition, 0, len(tm.Partitions))
+		for _, p := range tm.Partitions {
+			partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: p.ID})
+		}
+
+		committed, err := consumer.Committed(partitions, int(defaultTimeout.Milliseconds()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get committed offsets of topic %s: %w", topic, err)
+		}
+
+		var lags []PartitionLag
+		hasCommitted := false
+		for _, tp := range committed {
+			low, high, err := consumer.QueryWatermarkOffsets(topic, tp.Partition, int(defaultTimeout.Milliseconds()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to query watermark of topic %s partition %d: %w", topic, tp.Partition, err)
+			}
+
+			offset := int64(tp.Offset)
+			if tp.Offset == kafka.OffsetInvalid {
+				offset = -1
+			} else {
+				hasCommitted = true
+			}
+
+			lags = append(lags, PartitionLag{
+				Group:         group,
+				Topic:         topic,
+				Partition:     tp.Partition,
+				Committed:     offset,
+				LowWatermark:  low,
+				HighWatermark: high,
+				Lag:           partitionLag(offset, low, high),
+			})
+		}
+
+		if discover && !hasCommitted {
+			continue
+		}
+		sort.Slice(lags, func(i, j int) bool { return lags[i].Partition < lags[j].Partition })
+		result = append(result, lags...)
+	}
+
+	return result, nil
+}
+
+// partitionLag counts messages between committed offset and high watermark,
+// nothing committed (negative offset) or an offset below low watermark counts from low watermark
+func partitionLag(committed, low, high int64) int64 {
+	if committed < low {
+		committed = low
+	}
+	if lag := high - committed; lag > 0 {
+		return lag
+	}
+	return 0
+}
+
+// lagConfigMap copies client config with group, without auto commit so the group offsets are never touched
+func (kc *KafkaClient) lagConfigMap(group string) *kafka.ConfigMap {
+	cfg := kafka.ConfigMap{}
+	for k, v := range *kc.ConfigMap {
+		cfg[k] = v
+	}
+
+	cfg["group.id"] = group
+	cfg["enable.auto.commit"] = false
+	cfg["go.events.channel.enable"] = false
+
+	return &cfg
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const lagScrapeTimeout = 2 * time.Second
+
+var (
+	lagDesc = prometheus.NewDesc(
+		"msgbroker_kafka_consumer_lag",
+		"Messages between committed offset and high watermark per assigned partition.",
+		[]string{"topic", "partition"}, nil,
+	)
+	highWatermarkDesc = prometheus.NewDesc(
+		"msgbroker_kafka_high_watermark",
+		"High watermark offset per assigned partition.",
+		[]string{"topic", "partition"}, nil,
+	)
+)
+
+// lagCollector computes per-partition lag of the consumer assignment at scrape time
+type lagCollector struct {
+	kc *KafkaClient
+}
+
+// LagCollector returns a prometheus collector exporting lag of the partitions assigned to this consumer.
+// watermarks are queried from the broker on every scrape.
+func (kc *KafkaClient) LagCollector() prometheus.Collector {
+	return &lagCollector{kc: kc}
+}
+
+func (c *lagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lagDesc
+	ch <- highWatermarkDesc
+}
+
+func (c *lagCollector) Collect(ch chan<- prometheus.Metric) {
+	consumer := c.kc.Consumer
+	if consumer == nil {
+		return
+	}
+
+	assigned, err := consumer.Assignment()
+	if err != nil || len(assigned) == 0 {
+		return
+	}
+
+	committed, err := consumer.Committed(assigned, int(lagScrapeTimeout.Milliseconds()))
+	if err != nil {
+		c.kc.logger().WarnContext(context.Background(), "lag collector failed to get committed offsets", logging.Err(err))
+		return
+	}
+
+	for _, tp := range committed {
+		topic := getTopicName(tp.Topic)
+		partition := strconv.Itoa(int(tp.Partition))
+
+		low, high, err := consumer.QueryWatermarkOffsets(topic, tp.Partition, int(lagScrapeTimeout.Milliseconds()))
+		if err != nil {
+			c.kc.logger().WarnContext(context.Background(), "lag collector failed to query watermark",
+				logging.KeyTopic, topic,
+				logging.KeyPartition, tp.Partition,
+				logging.Err(err),
+			)
+			continue
+		}
+
+		// nothing committed yet, everything since low watermark is pending
+		offset := int64(tp.Offset)
+		if tp.Offset == kafka.OffsetInvalid {
+			offset = -1
+		}
+		lag := partitionLag(offset, low, high)
+
+		ch <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lag), topic, partition)
+		ch <- prometheus.MustNewConstMetric(highWatermarkDesc, prometheus.GaugeValue, float64(high), topic, partition)
+	}
+}
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+// OffsetStore keeps consumer positions outside of kafka, storage/postgres and storage/sqlite provide implementations.
+// offsets are the next offset to consume, i.e. last processed offset + 1.
+//
+// for exactly-once sinks the handler writes its data and the next offset in one database transaction
+// (e.g. postgres OffsetStore.StoreOffsetTx(ctx, tx, msg.Group, *msg.Topic, msg.Partition, msg.Offset+1)), the client storing the same offset
+// again after the handler returns is then a no-op.
+type OffsetStore interface {
+	LoadOffset(ctx context.Context, group, topic string, partition int32) (offset int64, found bool, err error)
+	StoreOffset(ctx context.Context, group, topic string, partition int32, offset int64) error
+}
+
+// applyStoredOffsets sets the start offset of each assigned partition to the one in ConsumerCfg.OffsetStore,
+// partitions without stored offset start from the committed offset (or auto.offset.reset).
+func (kc *KafkaClient) applyStoredOffsets(ctx context.Context, partitions []kafka.TopicPartition) error {
+	store := kc.ConsumerCfg.OffsetStore
+	if store == nil {
+		return nil
+	}
+
+	group, err := kc.groupID()
+	if err != nil {
+		return err
+	}
+
+	for i, tp := range partitions {
+		topic := getTopicName(tp.Topic)
+		offset, found, err := store.LoadOffset(ctx, group, topic, tp.Partition)
+		if err != nil {
+			return fmt.Errorf("failed to load offset of topic %s partition %d: %w", topic, tp.Partition, err)
+		}
+		if !found {
+			continue
+		}
+
+		partitions[i].Offset = kafka.Offset(offset)
+		kc.logger().InfoContext(ctx, "seek to stored offset",
+			logging.KeyTopic, topic,
+			logging.KeyPartition, tp.Partition,
+			logging.KeyOffset, offset,
+		)
+	}
+	return nil
+}
+
+// storeOffset saves the position after msg in ConsumerCfg.OffsetStore
+func (kc *KafkaClient) storeOffset(ctx context.Context, msg *kafka.Message) error {
+	store := kc.ConsumerCfg.OffsetStore
+	if store == nil {
+		return nil
+	}
+
+	group, err := kc.groupID()
+	if err != nil {
+		return err
+	}
+
+	tp := msg.TopicPartition
+	return store.StoreOffset(ctx, group, getTopicName(tp.Topic), tp.Partition, int64(tp.Offset)+1)
+}
+
+// groupID returns group.id of the consumer config
+func (kc *KafkaClient) groupID() (string, error) {
+	if kc.ConfigMap == nil {
+		return "", fmt.Errorf("group.id not configured")
+	}
+	v, err := kc.ConfigMap.Get("group.id", "")
+	if err != nil {
+		return "", fmt.Errorf("failed to read group.id: %w", err)
+	}
+	group, _ := v.(string)
+	if group == "" {
+		return "", fmt.Errorf("group.id not configured")
+	}
+	return group, nil
+}
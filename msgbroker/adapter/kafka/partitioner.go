@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+// partition counts are refreshed periodically so partitions added to a topic are picked up
+const partitionMetadataTTL = time.Minute
+
+// Partitioner picks the partition of a produced message.
+// numPartitions is the current partition count of the destination topic,
+// returning kafka.PartitionAny leaves the choice to librdkafka.
+type Partitioner interface {
+	Partition(msg Message, numPartitions int32) (int32, error)
+}
+
+// PartitionerFunc adapts a function of the message to a Partitioner, e.g. route by a header or customer id
+type PartitionerFunc func(msg Message, numPartitions int32) (int32, error)
+
+func (f PartitionerFunc) Partition(msg Message, numPartitions int32) (int32, error) {
+	return f(msg, numPartitions)
+}
+
+// Murmur2Partitioner matches the default partitioner of the Java client (and librdkafka "murmur2_random"),
+// so keys written by Go and JVM producers to the same topic land on the same partition.
+// messages without key are spread round-robin.
+type Murmur2Partitioner struct {
+	unkeyed RoundRobinPartitioner
+}
+
+func (p *Murmur2Partitioner) Partition(msg Message, numPartitions int32) (int32, error) {
+	if msg.Key == "" {
+		return p.unkeyed.Partition(msg, numPartitions)
+	}
+	// same as org.apache.kafka.common.utils.Utils.toPositive(murmur2(key)) % numPartitions
+	return int32(murmur2([]byte(msg.Key))&0x7fffffff) % numPartitions, nil
+}
+
+// ConsistentHashPartitioner maps keys with jump consistent hash,
+// when partitions are added only about 1/n of the keys move to another partition.
+// not compatible with JVM producers, use Murmur2Partitioner when sharing topics with them.
+// messages without key are spread round-robin.
+type ConsistentHashPartitioner struct {
+	unkeyed RoundRobinPartitioner
+}
+
+func (p *ConsistentHashPartitioner) Partition(msg Message, numPartitions int32) (int32, error) {
+	if msg.Key == "" {
+		return p.unkeyed.Partition(msg, numPartitions)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(msg.Key))
+	return jumpHash(h.Sum64(), numPartitions), nil
+}
+
+// RoundRobinPartitioner cycles through all partitions regardless of key
+type RoundRobinPartitioner struct {
+	next atomic.Uint32
+}
+
+func (p *RoundRobinPartitioner) Partition(_ Message, numPartitions int32) (int32, error) {
+	n := p.next.Add(1) - 1
+	return int32(n % uint32(numPartitions)), nil
+}
+
+// ExplicitPartitioner sends every message to a fixed partition
+type ExplicitPartitioner int32
+
+func (p ExplicitPartitioner) Partition(_ Message, numPartitions int32) (int32, error) {
+	if int32(p) < 0 || int32(p) >= numPartitions {
+		return 0, fmt.Errorf("partition %d out of range, topic has %d partitions", int32(p), numPartitions)
+	}
+	return int32(p), nil
+}
+
+// partitionCount caches the partition count of a topic
+type partitionCount struct {
+	count     int32
+	fetchedAt time.Time
+}
+
+// partitionFor resolves the partition of msg using kc.Partitioner,
+// kafka.PartitionAny when no partitioner is configured.
+func (kc *KafkaClient) partitionFor(ctx context.Context, topic string, msg Message) (int32, error) {
+	if kc.Partitioner == nil {
+		return kafka.PartitionAny, nil
+	}
+
+	count, err := kc.partitionCount(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	partition, err := kc.Partitioner.Partition(msg, count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to pick partition: %w", err)
+	}
+	if partition != kafka.PartitionAny && (partition < 0 || partition >= count) {
+		return 0, fmt.Errorf("partitioner returned partition %d, topic %s has %d partitions", partition, topic, count)
+	}
+	return partition, nil
+}
+
+// partitionCount returns the cached partition count of topic. a stale count is still returned while it is
+// refreshed in the background, only the first publish to a topic waits for metadata, at most until ctx is done.
+// concurrent publishers share one metadata request per topic.
+func (kc *KafkaClient) partitionCount(ctx context.Context, topic string) (int32, error) {
+	if v, ok := kc.partitionCounts.Load(topic); ok {
+		pc := v.(partitionCount)
+		if time.Since(pc.fetchedAt) >= partitionMetadataTTL {
+			kc.partitionFetches.DoChan(topic, func() (any, error) {
+				count, err := kc.fetchPartitionCount(topic)
+				if errors.Is(err, ErrClientClosed) {
+					return pc.count, nil
+				}
+				if err != nil {
+					// keep the known count for another ttl instead of retrying on every publish
+					kc.logger().WarnContext(context.Background(), "failed to refresh partition count", logging.KeyTopic, topic, logging.Err(err))
+					kc.partitionCounts.Store(topic, partitionCount{count: pc.count, fetchedAt: time.Now()})
+					return pc.count, nil
+				}
+				return count, nil
+			})
+		}
+		return pc.count, nil
+	}
+
+	fetch := kc.partitionFetches.DoChan(topic, func() (any, error) {
+		return kc.fetchPartitionCount(topic)
+	})
+	select {
+	case res := <-fetch:
+		if res.Err != nil {
+			return 0, res.Err
+		}
+		return res.Val.(int32), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// fetchPartitionCount reads the partition count of topic from the cluster and caches it.
+// it is shared by every waiting publisher, so it is bounded by defaultTimeout rather than a caller's ctx.
+// it fails with ErrClientClosed once Close started, Close waits for requests already running.
+func (kc *KafkaClient) fetchPartitionCount(topic string) (int32, error) {
+	kc.fetchMu.Lock()
+	if kc.closed {
+		kc.fetchMu.Unlock()
+		return 0, ErrClientClosed
+	}
+	kc.fetches.Add(1)
+	kc.fetchMu.Unlock()
+	defer kc.fetches.Done()
+
+	md, err := kc.Producer.GetMetadata(&topic, false, int(defaultTimeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get metadata of topic %s: %w", topic, err)
+	}
+
+	tm, ok := md.Topics[topic]
+	if !ok || tm.Error.Code() != kafka.ErrNoError || len(tm.Partitions) == 0 {
+		return 0, fmt.Errorf("topic %s not available: %v", topic, tm.Error)
+	}
+
+	count := int32(len(tm.Partitions))
+	kc.partitionCounts.Store(topic, partitionCount{count: count, fetchedAt: time.Now()})
+	return count, nil
+}
+
+// murmur2 is the 32-bit murmur2 variant of the Java client (seed 0x9747b28c)
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach
+func jumpHash(key uint64, buckets int32) int32 {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// vectors of org.apache.kafka.common.utils.UtilsTest#testMurmur2
+func TestMurmur2JavaVectors(t *testing.T) {
+	cases := []struct {
+		key  []byte
+		want int32
+	}{
+		{[]byte("21"), -973932308},
+		{[]byte("foobar"), -790332482},
+		{[]byte("a-little-bit-long-string"), -985981536},
+		{[]byte("a-little-bit-longer-string"), -1486304829},
+		{[]byte("lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8"), -58897971},
+		{[]byte{'a', 'b', 'c'}, 479470107},
+	}
+	for _, c := range cases {
+		if got := int32(murmur2(c.key)); got != c.want {
+			t.Errorf("murmur2(%q) = %d, want %d", c.key, got, c.want)
+		}
+	}
+}
+
+func TestMurmur2Partitioner(t *testing.T) {
+	var p Murmur2Partitioner
+
+	// toPositive(murmur2(key)) % numPartitions as in the Java client
+	cases := []struct {
+		key  string
+		want int32
+	}{
+		{"21", (-973932308 & 0x7fffffff) % 12},
+		{"foobar", (-790332482 & 0x7fffffff) % 12},
+		{"abc", 479470107 % 12},
+	}
+	for _, c := range cases {
+		got, err := p.Partition(Message{Key: c.key}, 12)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("partition of %q = %d, want %d", c.key, got, c.want)
+		}
+	}
+
+	// unkeyed messages are spread round-robin
+	for i := int32(0); i < 6; i++ {
+		got, _ := p.Partition(Message{}, 3)
+		if got != i%3 {
+			t.Fatalf("unkeyed message %d went to partition %d", i, got)
+		}
+	}
+}
+
+func TestConsistentHashPartitionerStable(t *testing.T) {
+	var p ConsistentHashPartitioner
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		msg := Message{Key: time.Duration(i).String()}
+		before, _ := p.Partition(msg, 10)
+		after, _ := p.Partition(msg, 11)
+		if before < 0 || before >= 10 || after < 0 || after >= 11 {
+			t.Fatalf("partition out of range: %d, %d", before, after)
+		}
+		if before != after {
+			moved++
+		}
+	}
+	// about 1/11 of the keys move when a partition is added
+	if moved > 200 {
+		t.Fatalf("%d of 1000 keys moved", moved)
+	}
+}
+
+// newUnreachableClient returns a client whose metadata requests never get an answer.
+// closing it waits for the pending request to time out, so callers run in parallel.
+// Close must not release the producer under a running request, -race checks that.
+func newUnreachableClient(t *testing.T) *KafkaClient {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("waits for a metadata request to time out")
+	}
+	t.Parallel()
+
+	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": "127.0.0.1:1", "log_level": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc := &KafkaClient{Producer: p, Partitioner: &Murmur2Partitioner{}, errorChannel: make(chan error, 1)}
+	t.Cleanup(func() { kc.Close() }) // undelivered broker errors fail the flush, only the race matters here
+	return kc
+}
+
+func TestPartitionCountHonorsContext(t *testing.T) {
+	kc := newUnreachableClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := kc.partitionFor(ctx, "orders", Message{Key: "k"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("publish blocked for %s", elapsed)
+	}
+}
+
+func TestPartitionCountStaleServedWhileRefreshing(t *testing.T) {
+	kc := newUnreachableClient(t)
+	kc.partitionCounts.Store("orders", partitionCount{count: 6, fetchedAt: time.Now().Add(-2 * partitionMetadataTTL)})
+
+	start := time.Now()
+	count, err := kc.partitionCount(context.Background(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Fatalf("got %d partitions, want the cached 6", count)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stale count waited %s for metadata", elapsed)
+	}
+}
+
+func TestPartitionCountAfterClose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the flush to time out")
+	}
+	t.Parallel()
+	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": "127.0.0.1:1", "log_level": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc := &KafkaClient{Producer: p, errorChannel: make(chan error, 1)}
+	kc.Close()
+
+	if _, err := kc.partitionCount(context.Background(), "orders"); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("got %v, want ErrClientClosed", err)
+	}
+}
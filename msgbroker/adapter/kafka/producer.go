@@ -8,41 +8,44 @@ import (
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Publish sends a message to Kafka (synchronous with timeout)
+// Publish sends a message to Kafka (synchronous with timeout).
+// trace context of ctx is injected into message headers.
 func (kc *KafkaClient) Publish(ctx context.Context, topic string, msg Message) error {
-	if kc.Producer == nil {
-		return ErrProducerNotInitialized
+	ctx, span := startProducerSpan(ctx, topic, &msg)
+	err := kc.encodePayload(ctx, &msg)
+	if err == nil {
+		err = kc.intercept(ctx, topic, &msg)
 	}
-
-	kafkaMsg := &kafka.Message{
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &topic,
-			Partition: kafka.PartitionAny,
-		},
-		Value: msg.Value,
+	if err == nil {
+		err = kc.publish(ctx, topic, msg)
 	}
+	tracing.End(span, err)
+	metrics.ObservePublish(metrics.BrokerKafka, topic, err)
+	return err
+}
 
-	if msg.Key != "" {
-		kafkaMsg.Key = []byte(msg.Key)
+func (kc *KafkaClient) publish(ctx context.Context, topic string, msg Message) error {
+	if kc.Producer == nil {
+		return ErrProducerNotInitialized
 	}
 
-	if len(msg.Headers) > 0 {
-		headers := make([]kafka.Header, 0, len(msg.Headers))
-		for k, v := range msg.Headers {
-			headers = append(headers, kafka.Header{
-				Key:   k,
-				Value: []byte(v),
-			})
-		}
-		kafkaMsg.Headers = headers
+	partition, err := kc.partitionFor(ctx, topic, msg)
+	if err != nil {
+		return err
 	}
+	kafkaMsg := toKafkaMessage(topic, partition, msg)
 
-	deliveryChan := make(chan kafka.Event)
-	defer close(deliveryChan)
+	// buffered, delivery report may arrive after we stopped waiting
+	deliveryChan := make(chan kafka.Event, 1)
 
-	err := kc.Producer.Produce(kafkaMsg, deliveryChan)
+	err = kc.Producer.Produce(kafkaMsg, deliveryChan)
 	if err != nil {
 		return fmt.Errorf("failed to produce message: %w", err)
 	}
@@ -53,6 +56,10 @@ func (kc *KafkaClient) Publish(ctx context.Context, topic string, msg Message) e
 		if m.TopicPartition.Error != nil {
 			return fmt.Errorf("delivery failed: %w", m.TopicPartition.Error)
 		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			semconv.MessagingDestinationPartitionID(fmt.Sprint(m.TopicPartition.Partition)),
+			semconv.MessagingKafkaOffset(int(m.TopicPartition.Offset)),
+		)
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -61,36 +68,40 @@ func (kc *KafkaClient) Publish(ctx context.Context, topic string, msg Message) e
 	}
 }
 
-// PublishAsync sends a message to Kafka asynchronously
-func (kc *KafkaClient) PublishAsync(topic string, msg Message) error {
+// PublishAsync sends a message to Kafka asynchronously.
+// trace context of ctx is injected into message headers, the span ends once the message is enqueued.
+func (kc *KafkaClient) PublishAsync(ctx context.Context, topic string, msg Message) error {
+	ctx, span := startProducerSpan(ctx, topic, &msg)
+
 	if kc.Producer == nil {
+		tracing.End(span, ErrProducerNotInitialized)
 		return ErrProducerNotInitialized
 	}
 
-	kafkaMsg := &kafka.Message{
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &topic,
-			Partition: kafka.PartitionAny,
-		},
-		Value: msg.Value,
+	err := kc.encodePayload(ctx, &msg)
+	if err == nil {
+		err = kc.intercept(ctx, topic, &msg)
 	}
-
-	if msg.Key != "" {
-		kafkaMsg.Key = []byte(msg.Key)
+	if err != nil {
+		tracing.End(span, err)
+		metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageProduce).Inc()
+		return err
 	}
 
-	if len(msg.Headers) > 0 {
-		headers := make([]kafka.Header, 0, len(msg.Headers))
-		for k, v := range msg.Headers {
-			headers = append(headers, kafka.Header{
-				Key:   k,
-				Value: []byte(v),
-			})
-		}
-		kafkaMsg.Headers = headers
+	partition, err := kc.partitionFor(ctx, topic, msg)
+	if err != nil {
+		tracing.End(span, err)
+		return err
 	}
 
-	return kc.Producer.Produce(kafkaMsg, nil)
+	// delivery is reported to handleEvents
+	err = kc.Producer.Produce(toKafkaMessage(topic, partition, msg), nil)
+	tracing.End(span, err)
+	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.BrokerKafka, topic, metrics.StageProduce).Inc()
+		return err
+	}
+	return nil
 }
 
 // PublishJSON is a convenience method for publishing JSON messages
@@ -107,3 +118,48 @@ func (kc *KafkaClient) PublishJSON(ctx context.Context, topic string, key string
 
 	return kc.Publish(ctx, topic, msg)
 }
+
+// encodePayload applies kc.Payload to the message value before interceptors run,
+// so size checks see what is actually sent
+func (kc *KafkaClient) encodePayload(ctx context.Context, msg *Message) error {
+	if kc.Payload == nil {
+		return nil
+	}
+	value, err := kc.Payload.Encode(ctx, msg.Value, &msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	msg.Value = value
+	return nil
+}
+
+// startProducerSpan starts the send span and injects it into a copy of msg headers,
+// the caller's headers are never mutated.
+func startProducerSpan(ctx context.Context, topic string, msg *Message) (context.Context, trace.Span) {
+	msg.Headers = msg.Headers.Clone()
+
+	attrs := []attribute.KeyValue{semconv.MessagingMessageBodySize(len(msg.Value))}
+	if msg.Key != "" {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(msg.Key))
+	}
+
+	return tracing.StartProducerSpan(ctx, semconv.MessagingSystemKafka, topic, &msg.Headers, attrs...)
+}
+
+func toKafkaMessage(topic string, partition int32, msg Message) *kafka.Message {
+	kafkaMsg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: partition,
+		},
+		Value: msg.Value,
+	}
+
+	if msg.Key != "" {
+		kafkaMsg.Key = []byte(msg.Key)
+	}
+
+	kafkaMsg.Headers = toKafkaHeaders(msg.Headers)
+
+	return kafkaMsg
+}
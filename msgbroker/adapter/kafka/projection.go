@@ -0,0 +1,17 @@
+package kafka
+
+import "context"
+
+// EventPublisher publishes with plain types, it satisfies storage/postgres/eventstore.Publisher
+// for projecting stored events to kafka
+type EventPublisher struct {
+	Client *KafkaClient
+}
+
+func (p EventPublisher) Publish(ctx context.Context, topic, key string, value []byte, headers map[string]string) error {
+	h := make(Headers, 0, len(headers))
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return p.Client.Publish(ctx, topic, Message{Key: key, Value: value, Headers: h})
+}
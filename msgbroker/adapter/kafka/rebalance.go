@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+const (
+	rebalanceProtocolCooperative = "COOPERATIVE"
+)
+
+// RebalanceHooks are optional callbacks invoked from the rebalance callback of SubscribeTopics.
+// hooks run on the consumer goroutine, between messages, so no handler is in-flight while they run.
+type RebalanceHooks struct {
+	OnAssigned func(partitions []kafka.TopicPartition) // before partitions are assigned, e.g. warm per-partition caches
+	OnRevoked  func(partitions []kafka.TopicPartition) // before offsets are committed and partitions released, e.g. flush state
+	OnLost     func(partitions []kafka.TopicPartition) // partitions already owned by another member, offsets must not be committed
+}
+
+// rebalanceCallback handles both eager and cooperative (cooperative-sticky) assignment protocols.
+// eager protocol revokes and re-assigns the full assignment, cooperative only the incremental difference.
+func (kc *KafkaClient) rebalanceCallback(consumer *kafka.Consumer, event kafka.Event) error {
+
+	ctx := context.Background()
+	logger := kc.logger()
+	logger.DebugContext(ctx, "received rebalance event", "event", event.String())
+	hooks := kc.ConsumerCfg.RebalanceHooks
+	cooperative := consumer.GetRebalanceProtocol() == rebalanceProtocolCooperative
+
+	switch ev := event.(type) {
+	case kafka.AssignedPartitions:
+		if hooks.OnAssigned != nil {
+			hooks.OnAssigned(ev.Partitions)
+		}
+
+		// start offsets given with the assignment take precedence over committed offsets
+		if err := kc.applyStoredOffsets(ctx, ev.Partitions); err != nil {
+			logger.ErrorContext(ctx, "failed to apply stored offsets", logging.Err(err))
+			return err
+		}
+
+		var err error
+		if cooperative {
+			err = consumer.IncrementalAssign(ev.Partitions)
+		} else {
+			err = consumer.Assign(ev.Partitions)
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to assign partitions", logging.Err(err))
+			return err
+		}
+
+		for _, p := range ev.Partitions {
+			logger.InfoContext(ctx, "assigned partition", partitionAttrs(p)...)
+		}
+
+	case kafka.RevokedPartitions:
+		if consumer.AssignmentLost() {
+			// partitions were lost (e.g. session timeout), another member may already process them
+			if hooks.OnLost != nil {
+				hooks.OnLost(ev.Partitions)
+			}
+			for _, p := range ev.Partitions {
+				logger.WarnContext(ctx, "lost partition", partitionAttrs(p)...)
+			}
+		} else {
+			if hooks.OnRevoked != nil {
+				hooks.OnRevoked(ev.Partitions)
+			}
+
+			if _, err := consumer.Commit(); err != nil && !isNoOffsetErr(err) {
+				logger.ErrorContext(ctx, "failed to commit offsets on revoke", logging.Err(err))
+			}
+			for _, p := range ev.Partitions {
+				logger.InfoContext(ctx, "revoked partition", partitionAttrs(p)...)
+			}
+		}
+
+		var err error
+		if cooperative {
+			err = consumer.IncrementalUnassign(ev.Partitions)
+		} else {
+			err = consumer.Unassign()
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to unassign partitions", logging.Err(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+func partitionAttrs(tp kafka.TopicPartition) []any {
+	return []any{
+		logging.KeyTopic, getTopicName(tp.Topic),
+		logging.KeyPartition, tp.Partition,
+		logging.KeyOffset, tp.Offset.String(),
+	}
+}
+
+// isNoOffsetErr reports whether commit failed only because there was nothing to commit
+func isNoOffsetErr(err error) bool {
+	kerr, ok := err.(kafka.Error)
+	return ok && kerr.Code() == kafka.ErrNoOffset
+}
@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+// replay configuration, From is required, To defaults to now
+type ReplayCfg struct {
+	Topic      string
+	Partitions []int32 // optional, all partitions of Topic if empty
+	From       time.Time
+	To         time.Time
+	GroupID    string // optional, group.id of the replay consumer, never committed. default "<group.id>-replay-<unix>"
+}
+
+// ReplayResult summarizes a finished replay
+type ReplayResult struct {
+	Processed int
+	Skipped   int // messages in range whose timestamp is after To
+}
+
+// Replay consumes cfg.Topic from cfg.From up to cfg.To into handler using a separate consumer.
+// partitions are assigned manually and no offsets are committed, so the main consumer group is untouched.
+// it stops on the first handler error, reporting the failing position.
+func (kc *KafkaClient) Replay(ctx context.Context, cfg ReplayCfg, handler func(ctx context.Context, msg Message) error) (ReplayResult, error) {
+	return kc.replay(ctx, cfg, true, handler)
+}
+
+// replay implements Replay, raw keeps values as stored instead of decoding them with kc.Payload
+func (kc *KafkaClient) replay(ctx context.Context, cfg ReplayCfg, decode bool, handler func(ctx context.Context, msg Message) error) (ReplayResult, error) {
+	var result ReplayResult
+
+	if kc.ConfigMap == nil {
+		return result, ErrConsumerNotInitialized
+	}
+	if cfg.Topic == "" || cfg.From.IsZero() {
+		return result, errors.New("replay topic and from time are required")
+	}
+	if cfg.To.IsZero() {
+		cfg.To = time.Now()
+	}
+	if cfg.To.Before(cfg.From) {
+		return result, errors.New("replay to time must be after from time")
+	}
+
+	consumer, err := kafka.NewConsumer(kc.replayConfigMap(cfg.GroupID))
+	if err != nil {
+		return result, fmt.Errorf("failed to create replay consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	partitions := cfg.Partitions
+	if len(partitions) == 0 {
+		partitions, err = topicPartitionIDs(consumer, cfg.Topic)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// resolve [start, end) offsets per partition from the time range
+	var assignment []kafka.TopicPartition
+	endOffsets := make(map[int32]int64)
+	for _, p := range partitions {
+		start, err := offsetForTime(consumer, cfg.Topic, p, cfg.From)
+		if err != nil {
+			return result, err
+		}
+		end, err := offsetForTime(consumer, cfg.Topic, p, cfg.To)
+		if err != nil {
+			return result, err
+		}
+		if start >= end {
+			continue
+		}
+
+		endOffsets[p] = end
+		assignment = append(assignment, kafka.TopicPartition{
+			Topic:     &cfg.Topic,
+			Partition: p,
+			Offset:    kafka.Offset(start),
+		})
+	}
+
+	if len(assignment) == 0 {
+		kc.logger().InfoContext(ctx, "replay found no messages in range", logging.KeyTopic, cfg.Topic, "from", cfg.From, "to", cfg.To)
+		return result, nil
+	}
+
+	if err := consumer.Assign(assignment); err != nil {
+		return result, fmt.Errorf("failed to assign replay partitions: %w", err)
+	}
+
+	for len(endOffsets) > 0 {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+		}
+
+		var msg *kafka.Message
+		switch ev := consumer.Poll(int(defaultPollInterval.Milliseconds())).(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				return result, fmt.Errorf("replay consumer error: %w", ev.TopicPartition.Error)
+			}
+			msg = ev
+		case kafka.PartitionEOF:
+			// end reached without seeing end-1, e.g. compacted away
+			delete(endOffsets, ev.Partition)
+			continue
+		case kafka.Error:
+			return result, fmt.Errorf("replay consumer error: %w", ev)
+		default:
+			continue
+		}
+
+		p := msg.TopicPartition.Partition
+		end, ok := endOffsets[p]
+		if !ok {
+			continue
+		}
+
+		offset := int64(msg.TopicPartition.Offset)
+		if offset >= end {
+			delete(endOffsets, p)
+			continue
+		}
+		if offset == end-1 {
+			delete(endOffsets, p)
+		}
+
+		if msg.Timestamp.After(cfg.To) {
+			result.Skipped++
+			continue
+		}
+
+		message := toMessage(msg)
+		if decode {
+			if err := kc.decodePayload(ctx, &message); err != nil {
+				return result, fmt.Errorf("replay failed at topic %s partition %d offset %d: %w", cfg.Topic, p, offset, err)
+			}
+		}
+
+		if err := handler(ctx, message); err != nil {
+			return result, fmt.Errorf("replay handler failed at topic %s partition %d offset %d: %w", cfg.Topic, p, offset, err)
+		}
+		result.Processed++
+	}
+
+	kc.logger().InfoContext(ctx, "replay done", logging.KeyTopic, cfg.Topic, "processed", result.Processed, "skipped", result.Skipped)
+	return result, nil
+}
+
+// replayConfigMap copies client config with an isolated group and commits disabled
+func (kc *KafkaClient) replayConfigMap(groupID string) *kafka.ConfigMap {
+	cfg := kafka.ConfigMap{}
+	for k, v := range *kc.ConfigMap {
+		cfg[k] = v
+	}
+
+	if groupID == "" {
+		base, _ := cfg.Get("group.id", "kafka")
+		groupID = fmt.Sprintf("%v-replay-%d", base, time.Now().Unix())
+	}
+
+	cfg["group.id"] = groupID
+	cfg["enable.auto.commit"] = false
+	cfg["enable.auto.offset.store"] = false
+	cfg["go.events.channel.enable"] = false
+	cfg["enable.partition.eof"] = true
+
+	return &cfg
+}
+
+func topicPartitionIDs(consumer *kafka.Consumer, topic string) ([]int32, error) {
+	md, err := consumer.GetMetadata(&topic, false, int(defaultTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topic metadata: %w", err)
+	}
+
+	tm, ok := md.Topics[topic]
+	if !ok || tm.Error.Code() != kafka.ErrNoError {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+
+	ids := make([]int32, 0, len(tm.Partitions))
+	for _, p := range tm.Partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
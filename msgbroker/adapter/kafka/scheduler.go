@@ -0,0 +1,25 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/scheduler"
+)
+
+var _ scheduler.Publisher = ScheduledPublisher{}
+
+// ScheduledPublisher publishes due scheduler messages to the topic in Destination,
+// the schedule id is sent as HeaderMessageID so consumers can drop duplicate dispatches
+type ScheduledPublisher struct {
+	Client *KafkaClient
+}
+
+func (p ScheduledPublisher) Publish(ctx context.Context, m scheduler.Message) error {
+	headers := make(Headers, 0, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		headers.Set(k, v)
+	}
+	headers.Set(HeaderMessageID, m.ID)
+
+	return p.Client.Publish(ctx, m.Destination, Message{Key: m.Key, Value: m.Body, Headers: headers})
+}
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextOverHeaders(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+
+	original := Headers{{Key: "x-custom", Value: []byte("1")}}
+	msg := Message{Key: "order-1", Value: []byte("{}"), Headers: original}
+
+	_, producer := startProducerSpan(context.Background(), "orders", &msg)
+	tracing.End(producer, nil)
+
+	if original.Has("traceparent") {
+		t.Fatal("caller headers were mutated")
+	}
+	if !msg.Headers.Has("traceparent") || msg.Headers.Get("x-custom") != "1" {
+		t.Fatalf("unexpected headers %v", msg.Headers)
+	}
+
+	// headers survive the conversion to and from the wire format
+	consumed := Headers(nil)
+	for _, h := range toKafkaHeaders(msg.Headers) {
+		consumed = append(consumed, Header{Key: h.Key, Value: h.Value})
+	}
+
+	_, consumer := tracing.StartConsumerSpan(context.Background(), semconv.MessagingSystemKafka, "orders", &consumed,
+		semconv.MessagingKafkaOffset(42))
+	tracing.End(consumer, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	send, process := spans[0], spans[1]
+
+	if send.SpanKind != trace.SpanKindProducer || process.SpanKind != trace.SpanKindConsumer {
+		t.Fatalf("got kinds %v, %v", send.SpanKind, process.SpanKind)
+	}
+	if process.Parent.SpanID() != send.SpanContext.SpanID() || process.SpanContext.TraceID() != send.SpanContext.TraceID() {
+		t.Fatal("consumer span is not a child of the producer span")
+	}
+
+	want := map[attribute.Key]string{
+		semconv.MessagingSystemKey:          "kafka",
+		semconv.MessagingDestinationNameKey: "orders",
+		semconv.MessagingKafkaMessageKeyKey: "order-1",
+		semconv.MessagingMessageBodySizeKey: "2",
+		semconv.MessagingOperationTypeKey:   "send",
+	}
+	for key, value := range want {
+		if got := attr(send.Attributes, key); got != value {
+			t.Errorf("send %s = %q, want %q", key, got, value)
+		}
+	}
+	if got := attr(process.Attributes, semconv.MessagingKafkaOffsetKey); got != "42" {
+		t.Errorf("process offset = %q", got)
+	}
+}
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
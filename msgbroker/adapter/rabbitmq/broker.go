@@ -1,13 +1,20 @@
 package rabbitmq
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
 
 	"github.com/streadway/amqp"
 )
 
 type RabbitMQBroker struct {
 	conn        *amqp.Connection
+	logger      logging.Logger
+	payload     payload.Transformer
 	producercfg ProducerCfg
 	consumercfg ConsumerCfg
 }
@@ -15,6 +22,8 @@ type RabbitMQBroker struct {
 type RabbitMQOpts struct {
 	AmqpString string
 	AmqpConfig amqp.Config
+	Logger     logging.Logger      // structured logger shared by consumers and producers, slog.Default when nil
+	Payload    payload.Transformer // compression / claim-check of message bodies, applied on publish and consume
 }
 
 func NewRabbitMQBroker(opts RabbitMQOpts) (*RabbitMQBroker, error) {
@@ -22,10 +31,54 @@ func NewRabbitMQBroker(opts RabbitMQOpts) (*RabbitMQBroker, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &RabbitMQBroker{conn: conn}, nil
+	return &RabbitMQBroker{conn: conn, logger: logging.OrDefault(opts.Logger), payload: opts.Payload}, nil
+}
+
+// HealthCheck verifies the connection is open and the broker accepts new channels
+func (r *RabbitMQBroker) HealthCheck(ctx context.Context) error {
+	if r.conn == nil || r.conn.IsClosed() {
+		return errors.New("rabbitmq connection closed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ch, err := r.conn.Channel()
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- ch.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("rabbitmq health check failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("rabbitmq health check failed: %w", ctx.Err())
+	}
+}
+
+// Close closes the connection, channels of consumers and producers are closed with it
+func (r *RabbitMQBroker) Close() error {
+	if r.conn == nil || r.conn.IsClosed() {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// exchangeName names the default exchange the way messaging semantic conventions do
+func exchangeName(exchange string) string {
+	if exchange == "" {
+		return "amq.default"
+	}
+	return exchange
 }
 
-func gracefulShutdown(conn *amqp.Connection, ch *amqp.Channel, cleanup func()) {
+func gracefulShutdown(logger logging.Logger, conn *amqp.Connection, ch *amqp.Channel, cleanup func()) {
+	ctx := context.Background()
 
 	// Call optional cleanup logic
 	if cleanup != nil {
@@ -33,18 +86,18 @@ func gracefulShutdown(conn *amqp.Connection, ch *amqp.Channel, cleanup func()) {
 	}
 
 	// Gracefully close channel and connection
-	log.Println("Closing RabbitMQ channel and connection...")
+	logger.InfoContext(ctx, "closing rabbitmq channel and connection")
 	if ch != nil {
 		if err := ch.Close(); err != nil {
-			log.Printf("Error closing channel: %v\n", err)
+			logger.ErrorContext(ctx, "failed to close rabbitmq channel", logging.Err(err))
 		}
 	}
 
 	if conn != nil {
 		if err := conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v\n", err)
+			logger.ErrorContext(ctx, "failed to close rabbitmq connection", logging.Err(err))
 		}
 	}
 
-	log.Println("RabbitMQ shutdown complete.")
+	logger.InfoContext(ctx, "rabbitmq shutdown complete")
 }
@@ -1,18 +1,25 @@
 package rabbitmq
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
 	"github.com/lzf-12/go-example-collections/msgbroker/retry"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
 
 	"github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 )
 
 type ConsumerInt interface {
 	Subscribe(queuename string, topic string, handler func(message []byte, headers map[string]interface{})) error
+	SubscribeWithContext(queuename string, topic string, handler func(ctx context.Context, message []byte, headers map[string]interface{})) error
 	Props() *RabbitMQConsumer
 }
 
@@ -22,6 +29,11 @@ type RabbitMQConsumer struct {
 	config       ConsumerCfg
 	Done         chan struct{}
 	shutdownOnce sync.Once
+	logger       logging.Logger
+	payload      payload.Transformer
+
+	mu     sync.Mutex
+	queues map[string]struct{} // subscribed queues, exported as depth metrics
 }
 
 // RabbitMQ consumer-specific configuration
@@ -59,10 +71,21 @@ func (r *RabbitMQBroker) NewConsumer(config ConsumerCfg) (ConsumerInt, error) {
 		Channel: channel,
 		config:  config,
 		Done:    make(chan struct{}),
+		logger:  r.logger,
+		payload: r.payload,
+		queues:  make(map[string]struct{}),
 	}, nil
 }
 
 func (c *RabbitMQConsumer) Subscribe(queuename string, topic string, handler func(message []byte, headers map[string]interface{})) error {
+	return c.SubscribeWithContext(queuename, topic, func(_ context.Context, message []byte, headers map[string]interface{}) {
+		handler(message, headers)
+	})
+}
+
+// SubscribeWithContext is Subscribe with a handler context carrying the consumer span,
+// which continues the trace propagated in message headers.
+func (c *RabbitMQConsumer) SubscribeWithContext(queuename string, topic string, handler func(ctx context.Context, message []byte, headers map[string]interface{})) error {
 	// declare queue if it doesn't exist
 	queue, err := c.Channel.QueueDeclare(
 		queuename,
@@ -101,13 +124,19 @@ func (c *RabbitMQConsumer) Subscribe(queuename string, topic string, handler fun
 		return fmt.Errorf("failed to start consuming: %w", err)
 	}
 
+	c.mu.Lock()
+	c.queues[queue.Name] = struct{}{}
+	c.mu.Unlock()
+
 	// start message processing goroutine
-	go c.processMessages(deliveries, handler)
+	go c.processMessages(queue.Name, deliveries, handler)
 
 	return nil
 }
 
-func (c *RabbitMQConsumer) processMessages(deliveries <-chan amqp.Delivery, handler func([]byte, map[string]interface{})) {
+func (c *RabbitMQConsumer) processMessages(queue string, deliveries <-chan amqp.Delivery, handler func(context.Context, []byte, map[string]interface{})) {
+	logger := logging.OrDefault(c.logger)
+
 	for {
 		select {
 		case <-c.Done:
@@ -124,21 +153,35 @@ func (c *RabbitMQConsumer) processMessages(deliveries <-chan amqp.Delivery, hand
 				// Delivery channel closed — check if shutdown was requested
 				select {
 				case <-c.Done:
-					log.Println("Message channel closed during shutdown. Exiting.")
+					logger.InfoContext(context.Background(), "message channel closed during shutdown", logging.KeyQueue, queue)
 					return
 				default:
-					log.Println("Message channel closed unexpectedly — attempting to reconnect...")
+					logger.WarnContext(context.Background(), "message channel closed unexpectedly, attempting to reconnect", logging.KeyQueue, queue)
 					if err := c.reconnect(); err != nil {
-						log.Printf("Failed to reconnect: %v", err)
+						logger.ErrorContext(context.Background(), "failed to reconnect", logging.KeyQueue, queue, logging.Err(err))
 						return
 					}
 					continue
 				}
 			}
 
+			ctx, span := tracing.StartConsumerSpan(context.Background(), semconv.MessagingSystemRabbitmq, exchangeName(delivery.Exchange),
+				tracing.TableCarrier(delivery.Headers),
+				semconv.MessagingRabbitmqDestinationRoutingKey(delivery.RoutingKey),
+				semconv.MessagingRabbitmqMessageDeliveryTag(int(delivery.DeliveryTag)),
+				semconv.MessagingMessageBodySize(len(delivery.Body)),
+			)
+
 			// process message with retry logic
+			attempts := 0
+			start := time.Now()
 			err := retry.WithBackoff(c.config.RetryPolicy, func() error {
-				handler(delivery.Body, delivery.Headers)
+				attempts++
+				body, err := c.decodePayload(ctx, delivery)
+				if err != nil {
+					return err
+				}
+				handler(ctx, body, delivery.Headers)
 
 				// manual ack if AutoAck is false
 				if !c.config.AutoAck {
@@ -149,20 +192,54 @@ func (c *RabbitMQConsumer) processMessages(deliveries <-chan amqp.Delivery, hand
 				return nil
 			})
 
+			metrics.ObserveHandler(metrics.BrokerRabbitMQ, delivery.RoutingKey, start, err)
+			tracing.End(span, err)
+			if attempts > 1 {
+				metrics.Retries.WithLabelValues(metrics.BrokerRabbitMQ, delivery.RoutingKey).Add(float64(attempts - 1))
+			}
+
 			// if max retries failed, move to DLQ
 			if err != nil {
-				log.Printf("Handler failed after max retries, sending to DLQ: %v", err)
-				c.sendToDLQ(delivery)
+				logger.ErrorContext(ctx, "handler failed after max retries, sending to DLQ",
+					logging.KeyQueue, queue,
+					logging.KeyRoutingKey, delivery.RoutingKey,
+					"attempts", attempts,
+					logging.Err(err),
+				)
+				c.sendToDLQ(ctx, delivery, err)
 			}
 		}
 	}
 }
 
-func (c *RabbitMQConsumer) sendToDLQ(delivery amqp.Delivery) {
+// decodePayload restores a body encoded by the broker payload transformer, the DLQ keeps the encoded body
+func (c *RabbitMQConsumer) decodePayload(ctx context.Context, delivery amqp.Delivery) ([]byte, error) {
+	if c.payload == nil {
+		return delivery.Body, nil
+	}
+	body, err := c.payload.Decode(ctx, delivery.Body, tracing.TableCarrier(delivery.Headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return body, nil
+}
+
+// sendToDLQ forwards delivery to the DLQ with the failure recorded in dlq headers, see RepublishDLQ
+func (c *RabbitMQConsumer) sendToDLQ(ctx context.Context, delivery amqp.Delivery, cause error) {
+	logger := logging.OrDefault(c.logger)
 
 	dlqExchange := c.config.DLQExchange     // default configuration
 	dlqRoutingKey := c.config.DLQRoutingKey // default configuration
 
+	headers := make(amqp.Table, len(delivery.Headers)+5)
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	for k, v := range dlq.FailureHeaders(delivery.RoutingKey, cause, time.Now()) {
+		headers[k] = v
+	}
+	headers[dlq.HeaderOriginalExchange] = delivery.Exchange
+
 	err := c.Channel.Publish(
 		dlqExchange,   // exchange
 		dlqRoutingKey, // routing key
@@ -171,7 +248,7 @@ func (c *RabbitMQConsumer) sendToDLQ(delivery amqp.Delivery) {
 		amqp.Publishing{
 			ContentType:   delivery.ContentType,
 			Body:          delivery.Body,
-			Headers:       delivery.Headers,
+			Headers:       headers,
 			Timestamp:     time.Now(),
 			CorrelationId: delivery.CorrelationId,
 			DeliveryMode:  delivery.DeliveryMode,
@@ -182,11 +259,18 @@ func (c *RabbitMQConsumer) sendToDLQ(delivery amqp.Delivery) {
 	)
 
 	if err != nil {
-		log.Printf("Failed to send message to DLQ: %v", err)
+		metrics.Errors.WithLabelValues(metrics.BrokerRabbitMQ, delivery.RoutingKey, metrics.StageDLQ).Inc()
+		logger.ErrorContext(ctx, "failed to send message to DLQ",
+			logging.KeyExchange, dlqExchange,
+			logging.KeyRoutingKey, dlqRoutingKey,
+			logging.Err(err),
+		)
 	} else {
+		metrics.DeadLettered.WithLabelValues(metrics.BrokerRabbitMQ, delivery.RoutingKey).Inc()
+
 		// Always ack or reject the original message to avoid requeue
 		if err := delivery.Ack(false); err != nil {
-			log.Printf("Failed to ack original message after DLQ forward: %v", err)
+			logger.ErrorContext(ctx, "failed to ack original message after DLQ forward", logging.KeyRoutingKey, delivery.RoutingKey, logging.Err(err))
 		}
 	}
 }
@@ -0,0 +1,177 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/versioning"
+
+	"github.com/streadway/amqp"
+)
+
+// PeekDLQ returns up to limit (0 means all) messages of the dead letter queue matching filter.
+// messages are fetched unacknowledged and requeued afterwards, the queue is left as it was.
+func (r *RabbitMQBroker) PeekDLQ(ctx context.Context, queue string, limit int, filter dlq.Filter) ([]dlq.Message, error) {
+	var out []dlq.Message
+
+	err := r.scanDLQ(ctx, queue, func(_ *dlqChannel, d amqp.Delivery, m dlq.Message) (bool, error) {
+		if !filter.Match(m) {
+			return true, nil
+		}
+		out = append(out, m)
+		return limit <= 0 || len(out) < limit, nil
+	})
+	return out, err
+}
+
+// RepublishDLQ moves up to limit (0 means all) messages matching filter back to the exchange and routing key
+// they were dead-lettered from, with dlq headers removed and the retry count bumped.
+// target, when set, overrides the recorded routing key. a message is only removed from the DLQ
+// once the broker confirmed the republish.
+func (r *RabbitMQBroker) RepublishDLQ(ctx context.Context, queue, target string, limit int, filter dlq.Filter) (int, error) {
+	republished := 0
+	logger := logging.OrDefault(r.logger)
+
+	err := r.scanDLQ(ctx, queue, func(ch *dlqChannel, d amqp.Delivery, m dlq.Message) (bool, error) {
+		if !filter.Match(m) {
+			return true, nil
+		}
+
+		routingKey := m.Headers[dlq.HeaderOriginalTopic]
+		if target != "" {
+			routingKey = target
+		}
+		if routingKey == "" {
+			logger.WarnContext(ctx, "dlq message without original routing key, skipped", logging.KeyQueue, queue, "id", m.ID)
+			return true, nil
+		}
+
+		headers := make(amqp.Table, len(d.Headers))
+		for k, v := range d.Headers {
+			if !dlq.IsFailureHeader(k) {
+				headers[k] = v
+			}
+		}
+		headers[dlq.HeaderRetryCount] = strconv.Itoa(m.RetryCount() + 1)
+
+		if err := ch.publishConfirmed(ctx, m.Headers[dlq.HeaderOriginalExchange], routingKey, amqp.Publishing{
+			ContentType:   d.ContentType,
+			Body:          d.Body,
+			Headers:       headers,
+			Timestamp:     time.Now(),
+			CorrelationId: d.CorrelationId,
+			DeliveryMode:  d.DeliveryMode,
+			MessageId:     d.MessageId,
+			Type:          d.Type,
+			AppId:         d.AppId,
+		}); err != nil {
+			return false, fmt.Errorf("failed to republish message %s: %w", m.ID, err)
+		}
+
+		if err := d.Ack(false); err != nil {
+			return false, fmt.Errorf("failed to ack dlq message %s: %w", m.ID, err)
+		}
+
+		republished++
+		logger.InfoContext(ctx, "republished dlq message",
+			logging.KeyQueue, queue,
+			logging.KeyRoutingKey, routingKey,
+			"id", m.ID,
+			"retry_count", m.RetryCount()+1,
+		)
+		return limit <= 0 || republished < limit, nil
+	})
+	return republished, err
+}
+
+// scanDLQ fetches messages of queue one by one without ack until fn returns false, the queue is drained
+// or the messages present at start were all seen (republished messages failing again are not revisited).
+// messages fn did not ack are requeued.
+func (r *RabbitMQBroker) scanDLQ(ctx context.Context, queue string, fn func(ch *dlqChannel, d amqp.Delivery, m dlq.Message) (bool, error)) error {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to put channel in confirm mode: %w", err)
+	}
+	dc := &dlqChannel{ch: ch, confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1))}
+
+	q, err := ch.QueueInspect(queue)
+	if err != nil {
+		return fmt.Errorf("failed to inspect queue %s: %w", queue, err)
+	}
+
+	var lastTag uint64
+	defer func() {
+		if lastTag > 0 {
+			// requeue everything not acked, acked deliveries are unaffected
+			_ = ch.Nack(lastTag, true, true)
+		}
+	}()
+
+	for i := 0; i < q.Messages; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return fmt.Errorf("failed to get message from %s: %w", queue, err)
+		}
+		if !ok {
+			return nil
+		}
+		lastTag = d.DeliveryTag
+
+		next, err := fn(dc, d, toDLQMessage(d, i))
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+// dlqChannel is a channel in confirm mode, publishes are sequential so one confirmation is pending at most
+type dlqChannel struct {
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+// publishConfirmed publishes and waits for the broker ack
+func (c *dlqChannel) publishConfirmed(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if err := c.ch.Publish(exchange, routingKey, false, false, msg); err != nil {
+		return err
+	}
+
+	select {
+	case confirm, ok := <-c.confirms:
+		if !ok || !confirm.Ack {
+			return fmt.Errorf("publish not confirmed by broker")
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// toDLQMessage identifies messages by message id, or by queue position when producers set none
+func toDLQMessage(d amqp.Delivery, position int) dlq.Message {
+	id := d.MessageId
+	if id == "" {
+		id = "#" + strconv.Itoa(position)
+	}
+	return dlq.Message{
+		ID:        id,
+		Source:    d.RoutingKey,
+		Headers:   versioning.StringHeaders(d.Headers),
+		Body:      d.Body,
+		Timestamp: d.Timestamp,
+	}
+}
@@ -0,0 +1,68 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		"msgbroker_rabbitmq_queue_depth",
+		"Messages ready in queue.",
+		[]string{"queue"}, nil,
+	)
+	queueConsumersDesc = prometheus.NewDesc(
+		"msgbroker_rabbitmq_queue_consumers",
+		"Consumers attached to queue.",
+		[]string{"queue"}, nil,
+	)
+)
+
+// queueCollector inspects subscribed queues at scrape time
+type queueCollector struct {
+	c *RabbitMQConsumer
+}
+
+// QueueCollector returns a prometheus collector exporting depth of the queues this consumer subscribed to
+func (c *RabbitMQConsumer) QueueCollector() prometheus.Collector {
+	return &queueCollector{c: c}
+}
+
+func (qc *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueConsumersDesc
+}
+
+func (qc *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	qc.c.mu.Lock()
+	queues := make([]string, 0, len(qc.c.queues))
+	for q := range qc.c.queues {
+		queues = append(queues, q)
+	}
+	qc.c.mu.Unlock()
+
+	if len(queues) == 0 || qc.c.Conn == nil || qc.c.Conn.IsClosed() {
+		return
+	}
+
+	// dedicated channel, a failed passive declare closes the channel it runs on
+	channel, err := qc.c.Conn.Channel()
+	if err != nil {
+		logging.OrDefault(qc.c.logger).WarnContext(context.Background(), "queue collector failed to open channel", logging.Err(err))
+		return
+	}
+	defer channel.Close()
+
+	for _, name := range queues {
+		q, err := channel.QueueInspect(name)
+		if err != nil {
+			logging.OrDefault(qc.c.logger).WarnContext(context.Background(), "queue collector failed to inspect queue", logging.KeyQueue, name, logging.Err(err))
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(q.Messages), name)
+		ch <- prometheus.MustNewConstMetric(queueConsumersDesc, prometheus.GaugeValue, float64(q.Consumers), name)
+	}
+}
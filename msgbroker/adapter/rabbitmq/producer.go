@@ -1,24 +1,33 @@
 package rabbitmq
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
 	"github.com/lzf-12/go-example-collections/msgbroker/retry"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
 
 	"github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 )
 
 type ProducerInt interface {
 	Publish(topic string, message []byte) error
 	PublishWithHeaders(topic string, message []byte, headers map[string]interface{}) error
+	PublishWithContext(ctx context.Context, topic string, message []byte, headers map[string]interface{}) error
 }
 
 type RabbitMQProducer struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	config  ProducerCfg
+	logger  logging.Logger
+	payload payload.Transformer
 }
 
 // RabbitMQ producer-specific configuration
@@ -49,6 +58,8 @@ func (r *RabbitMQBroker) NewProducer(cfg ProducerCfg) (ProducerInt, error) {
 		conn:    r.conn,
 		channel: channel,
 		config:  r.producercfg,
+		logger:  r.logger,
+		payload: r.payload,
 	}, nil
 }
 
@@ -57,22 +68,51 @@ func (p *RabbitMQProducer) Publish(topic string, message []byte) error {
 }
 
 func (p *RabbitMQProducer) PublishWithHeaders(topic string, message []byte, headers map[string]interface{}) error {
+	return p.PublishWithContext(context.Background(), topic, message, headers)
+}
+
+// PublishWithContext publishes message and injects trace context of ctx into a copy of headers
+func (p *RabbitMQProducer) PublishWithContext(ctx context.Context, topic string, message []byte, headers map[string]interface{}) error {
 	routingKey := p.config.RoutingKey
 	if routingKey == "" {
 		routingKey = topic
 	}
 
+	table := make(amqp.Table, len(headers)+2)
+	for k, v := range headers {
+		table[k] = v
+	}
+
+	ctx, span := tracing.StartProducerSpan(ctx, semconv.MessagingSystemRabbitmq, exchangeName(p.config.Exchange),
+		tracing.TableCarrier(table),
+		semconv.MessagingRabbitmqDestinationRoutingKey(routingKey),
+		semconv.MessagingMessageBodySize(len(message)),
+	)
+
+	if p.payload != nil {
+		encoded, err := p.payload.Encode(ctx, message, tracing.TableCarrier(table))
+		if err != nil {
+			err = fmt.Errorf("failed to encode payload: %w", err)
+			metrics.ObservePublish(metrics.BrokerRabbitMQ, routingKey, err)
+			tracing.End(span, err)
+			return err
+		}
+		message = encoded
+	}
+
 	msg := amqp.Publishing{
 		DeliveryMode: p.config.DeliveryMode,
 		ContentType:  p.config.ContentType,
 		Body:         message,
-		Headers:      amqp.Table(headers),
+		Headers:      table,
 		Timestamp:    time.Now(),
 	}
 
 	var lastErr error
+	attempts := 0
 
 	retry.WithBackoff(p.config.RetryPolicy, func() error {
+		attempts++
 		err := p.channel.Publish(
 			p.config.Exchange,
 			routingKey,
@@ -91,9 +131,24 @@ func (p *RabbitMQProducer) PublishWithHeaders(topic string, message []byte, head
 			}
 			return err
 		}
+		lastErr = nil
 		return nil
 	})
 
+	if attempts > 1 {
+		metrics.Retries.WithLabelValues(metrics.BrokerRabbitMQ, routingKey).Add(float64(attempts - 1))
+	}
+	metrics.ObservePublish(metrics.BrokerRabbitMQ, routingKey, lastErr)
+	if lastErr != nil {
+		logging.OrDefault(p.logger).ErrorContext(ctx, "failed to publish message",
+			logging.KeyExchange, p.config.Exchange,
+			logging.KeyRoutingKey, routingKey,
+			"attempts", attempts,
+			logging.Err(lastErr),
+		)
+	}
+	tracing.End(span, lastErr)
+
 	return lastErr
 }
 
@@ -0,0 +1,28 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/scheduler"
+)
+
+// HeaderMessageID carries the schedule id of dispatched messages for deduplication
+const HeaderMessageID = "x-message-id"
+
+var _ scheduler.Publisher = ScheduledPublisher{}
+
+// ScheduledPublisher publishes due scheduler messages with the routing key in Destination,
+// exchange and a fixed ProducerCfg.RoutingKey, when set, are the ones of the producer
+type ScheduledPublisher struct {
+	Producer ProducerInt
+}
+
+func (p ScheduledPublisher) Publish(ctx context.Context, m scheduler.Message) error {
+	headers := make(map[string]interface{}, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[HeaderMessageID] = m.ID
+
+	return p.Producer.PublishWithContext(ctx, m.Destination, m.Body, headers)
+}
@@ -0,0 +1,172 @@
+package redisstreams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
+	"github.com/lzf-12/go-example-collections/msgbroker/retry"
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+)
+
+const (
+	defaultBatchSize        = 10
+	defaultBlock            = 2 * time.Second
+	defaultClaimMinIdle     = time.Minute
+	defaultClaimInterval    = 30 * time.Second
+	defaultMaxDeliveries    = 5
+	defaultDeadConsumerIdle = 24 * time.Hour
+	defaultShutdownTimeout  = 10 * time.Second
+)
+
+// stream entry fields, headers are stored as "h:<name>"
+const (
+	fieldKey     = "key"
+	fieldValue   = "value"
+	headerPrefix = "h:"
+)
+
+var system = semconv.MessagingSystemKey.String("redis")
+
+type Message struct {
+	Key        string
+	Value      []byte
+	Headers    map[string]string
+	Timestamp  time.Time // set on consumed messages, from the entry id
+	Topic      string    // stream, set on consumed messages
+	ID         string    // stream entry id, set on consumed messages
+	Deliveries int64     // set on consumed messages, 1 on first delivery
+}
+
+// Cfg configures NewClient, zero value uses defaults
+type Cfg struct {
+	Group    string // consumer group, required to subscribe
+	Consumer string // name within the group, default hostname-pid. must be unique per running instance
+
+	// StartID is where a newly created group starts reading: "$" (default) for new entries only, "0" for the whole stream
+	StartID string
+
+	// MaxLen trims streams to about this many entries on publish (XADD MAXLEN ~), 0 keeps everything.
+	// trimmed entries are gone even when still pending, size it well above the consumer lag.
+	MaxLen int64
+
+	BatchSize int64         // entries per XREADGROUP, default 10
+	Block     time.Duration // XREADGROUP block time, also bounds shutdown latency, default 2s
+
+	// ClaimMinIdle is how long an entry stays pending before it is claimed again, from a dead consumer or
+	// for another attempt after a failed handler, default 1m. it must exceed the longest handler run.
+	ClaimMinIdle  time.Duration
+	ClaimInterval time.Duration // how often pending entries are checked, default 30s
+
+	// MaxDeliveries is the number of deliveries after which a failing entry is dead-lettered
+	// when its TopicHandler has a DLQTopic, default 5
+	MaxDeliveries int64
+
+	// DeadConsumerIdle removes group consumers without pending entries idle this long, default 24h
+	DeadConsumerIdle time.Duration
+
+	RetryPolicy     retry.RetryPolicy // in-process handler retries per delivery, none when MaxRetries is 0
+	ShutdownTimeout time.Duration     // max wait for the in-flight handler on shutdown, default 10s
+
+	Logger  logging.Logger      // structured logger, slog.Default when nil
+	Payload payload.Transformer // compression / claim-check of message values, applied on publish and consume
+}
+
+// Client publishes to and consumes from Redis streams on a go-redis client, e.g. storage/redis Redis.Client()
+type Client struct {
+	rdb    *redis.Client
+	cfg    Cfg
+	logger logging.Logger
+}
+
+func NewClient(rdb *redis.Client, cfg Cfg) (*Client, error) {
+	if rdb == nil {
+		return nil, errors.New("redis client cannot be nil")
+	}
+	if cfg.Consumer == "" {
+		host, _ := os.Hostname()
+		cfg.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.StartID == "" {
+		cfg.StartID = "$"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = defaultBlock
+	}
+	if cfg.ClaimMinIdle <= 0 {
+		cfg.ClaimMinIdle = defaultClaimMinIdle
+	}
+	if cfg.ClaimInterval <= 0 {
+		cfg.ClaimInterval = defaultClaimInterval
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = defaultMaxDeliveries
+	}
+	if cfg.DeadConsumerIdle <= 0 {
+		cfg.DeadConsumerIdle = defaultDeadConsumerIdle
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if cfg.RetryPolicy.MaxRetries < 1 {
+		// WithBackoff runs fn MaxRetries times, at least once is needed
+		cfg.RetryPolicy.MaxRetries = 1
+	}
+
+	return &Client{rdb: rdb, cfg: cfg, logger: logging.OrDefault(cfg.Logger)}, nil
+}
+
+// HealthCheck pings the redis server
+func (c *Client) HealthCheck(ctx context.Context) error {
+	if err := c.rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("redis streams health check failed: %w", err)
+	}
+	return nil
+}
+
+func toValues(msg Message) map[string]any {
+	values := make(map[string]any, len(msg.Headers)+2)
+	values[fieldValue] = msg.Value
+	if msg.Key != "" {
+		values[fieldKey] = msg.Key
+	}
+	for k, v := range msg.Headers {
+		values[headerPrefix+k] = v
+	}
+	return values
+}
+
+func toMessage(stream string, entry redis.XMessage, deliveries int64) Message {
+	msg := Message{Topic: stream, ID: entry.ID, Deliveries: deliveries, Headers: map[string]string{}}
+	for k, v := range entry.Values {
+		s, _ := v.(string)
+		switch {
+		case k == fieldValue:
+			msg.Value = []byte(s)
+		case k == fieldKey:
+			msg.Key = s
+		case strings.HasPrefix(k, headerPrefix):
+			msg.Headers[strings.TrimPrefix(k, headerPrefix)] = s
+		}
+	}
+	if ms, _, ok := strings.Cut(entry.ID, "-"); ok {
+		if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			msg.Timestamp = time.UnixMilli(n)
+		}
+	}
+	return msg
+}
+
+func messageAttrs(m Message) []any {
+	return []any{logging.KeyTopic, m.Topic, "id", m.ID, "deliveries", m.Deliveries}
+}
@@ -0,0 +1,392 @@
+package redisstreams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/retry"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TopicHandler struct {
+	Topic   string // stream key
+	Handler func(ctx context.Context, msg Message) error
+	Timeout time.Duration // per attempt deadline of Handler context, 0 means no deadline
+
+	// DLQTopic is the stream failed entries are added to once delivered Cfg.MaxDeliveries times,
+	// they are then acknowledged. without it failing entries stay pending and are redelivered forever.
+	DLQTopic string
+}
+
+// ShutdownError is returned by SubscribeTopics when messages were left unprocessed during shutdown.
+// they stay pending in the group and are claimed by a consumer after Cfg.ClaimMinIdle.
+type ShutdownError struct {
+	Unprocessed []Message
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("%d message(s) left unprocessed on shutdown", len(e.Unprocessed))
+}
+
+// inflight tracks a message whose handler is still running
+type inflight struct {
+	message Message
+	th      TopicHandler
+	ctx     context.Context // carries the consumer span, used for logging
+	done    chan error
+	span    trace.Span
+	start   time.Time
+}
+
+// SubscribeTopics consumes the streams of topicHandlers as Cfg.Consumer of Cfg.Group, creating the group
+// when missing. entries are acknowledged after their handler succeeds; entries left pending by failed
+// handlers or dead consumers are claimed again every Cfg.ClaimInterval.
+// on ctx cancellation it stops reading and waits for the in-flight handler up to Cfg.ShutdownTimeout.
+func (c *Client) SubscribeTopics(ctx context.Context, topicHandlers []TopicHandler) error {
+	if c.cfg.Group == "" {
+		return errors.New("consumer group is required to subscribe")
+	}
+	if len(topicHandlers) < 1 {
+		return errors.New("error topic and handler map cannot empty")
+	}
+
+	handlerMap := make(map[string]TopicHandler)
+	var topics []string
+	for _, th := range topicHandlers {
+		handlerMap[th.Topic] = th
+		topics = append(topics, th.Topic)
+
+		err := c.rdb.XGroupCreateMkStream(ctx, th.Topic, c.cfg.Group, c.cfg.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group on %s: %w", th.Topic, err)
+		}
+	}
+
+	streams := make([]string, 0, 2*len(topics))
+	streams = append(streams, topics...)
+	for range topics {
+		streams = append(streams, ">")
+	}
+
+	// handlers outlive shutdown signal until ShutdownTimeout, so they don't inherit ctx cancellation
+	handlerBaseCtx := context.WithoutCancel(ctx)
+
+	var lastClaim time.Time
+	for {
+		if ctx.Err() != nil {
+			return c.shutdown(nil, nil)
+		}
+
+		if time.Since(lastClaim) >= c.cfg.ClaimInterval {
+			lastClaim = time.Now()
+			for _, topic := range topics {
+				if err := c.reclaim(ctx, handlerBaseCtx, handlerMap[topic]); err != nil {
+					return err
+				}
+			}
+		}
+
+		res, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.cfg.Group,
+			Consumer: c.cfg.Consumer,
+			Streams:  streams,
+			Count:    c.cfg.BatchSize,
+			Block:    c.cfg.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return c.shutdown(nil, nil)
+			}
+			// the client reconnects on its own, keep polling
+			c.logger.ErrorContext(ctx, "failed to read from streams", logging.Err(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.cfg.Block):
+			}
+			continue
+		}
+
+		for _, stream := range res {
+			batch := make([]Message, 0, len(stream.Messages))
+			for _, entry := range stream.Messages {
+				batch = append(batch, toMessage(stream.Stream, entry, 1))
+			}
+			if err := c.processBatch(ctx, handlerBaseCtx, handlerMap[stream.Stream], batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reclaim claims entries pending longer than ClaimMinIdle and processes them, until no full batch is left
+func (c *Client) reclaim(ctx, handlerBaseCtx context.Context, th TopicHandler) error {
+	c.removeDeadConsumers(ctx, th.Topic)
+
+	for ctx.Err() == nil {
+		batch, err := c.claimPending(ctx, th.Topic)
+		if err != nil {
+			c.logger.ErrorContext(ctx, "failed to claim pending entries", logging.KeyTopic, th.Topic, logging.Err(err))
+			return nil
+		}
+		if err := c.processBatch(ctx, handlerBaseCtx, th, batch); err != nil {
+			return err
+		}
+		if int64(len(batch)) < c.cfg.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// claimPending takes over entries idle for ClaimMinIdle, whether their consumer died or their handler failed
+func (c *Client) claimPending(ctx context.Context, topic string) ([]Message, error) {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: topic,
+		Group:  c.cfg.Group,
+		Idle:   c.cfg.ClaimMinIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  c.cfg.BatchSize,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+	return c.claim(ctx, topic, pending)
+}
+
+// claim takes over the listed pending entries that are still idle for ClaimMinIdle.
+// entries another consumer claimed since they were listed are left to it.
+func (c *Client) claim(ctx context.Context, topic string, pending []redis.XPendingExt) ([]Message, error) {
+	ids := make([]string, 0, len(pending))
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	claimed, err := c.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   topic,
+		Group:    c.cfg.Group,
+		Consumer: c.cfg.Consumer,
+		MinIdle:  c.cfg.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make([]Message, 0, len(claimed))
+	found := make(map[string]bool, len(claimed))
+	for _, entry := range claimed {
+		if entry.Values == nil {
+			continue
+		}
+		found[entry.ID] = true
+		// XCLAIM counts as another delivery
+		batch = append(batch, toMessage(topic, entry, deliveries[entry.ID]+1))
+	}
+
+	// an id missing from the reply was either trimmed away while pending or claimed by another consumer
+	// in the meantime, which reset its idle time. only the former has no data left and is dropped.
+	var trimmed []string
+	for _, id := range ids {
+		if found[id] {
+			continue
+		}
+		entries, err := c.rdb.XRange(ctx, topic, id, id).Result()
+		if err != nil {
+			c.logger.ErrorContext(ctx, "failed to look up unclaimed entry", logging.KeyTopic, topic, "id", id, logging.Err(err))
+			continue
+		}
+		if len(entries) == 0 {
+			trimmed = append(trimmed, id)
+		}
+	}
+	if len(trimmed) > 0 {
+		c.logger.WarnContext(ctx, "pending entries were trimmed from the stream, dropped", logging.KeyTopic, topic, "ids", trimmed)
+		if err := c.rdb.XAck(ctx, topic, c.cfg.Group, trimmed...).Err(); err != nil {
+			c.logger.ErrorContext(ctx, "failed to acknowledge trimmed entries", logging.KeyTopic, topic, logging.Err(err))
+		}
+	}
+
+	if len(batch) > 0 {
+		c.logger.InfoContext(ctx, "claimed pending entries", logging.KeyTopic, topic, "count", len(batch))
+	}
+	return batch, nil
+}
+
+// removeDeadConsumers deletes other consumers of the group that hold no entries and were idle for DeadConsumerIdle
+func (c *Client) removeDeadConsumers(ctx context.Context, topic string) {
+	consumers, err := c.rdb.XInfoConsumers(ctx, topic, c.cfg.Group).Result()
+	if err != nil {
+		c.logger.WarnContext(ctx, "failed to list group consumers", logging.KeyTopic, topic, logging.Err(err))
+		return
+	}
+	for _, cons := range consumers {
+		if cons.Name == c.cfg.Consumer || cons.Pending > 0 || cons.Idle < c.cfg.DeadConsumerIdle {
+			continue
+		}
+		if err := c.rdb.XGroupDelConsumer(ctx, topic, c.cfg.Group, cons.Name).Err(); err != nil {
+			c.logger.WarnContext(ctx, "failed to remove dead consumer", logging.KeyTopic, topic, "consumer", cons.Name, logging.Err(err))
+			continue
+		}
+		c.logger.InfoContext(ctx, "removed dead consumer", logging.KeyTopic, topic, "consumer", cons.Name)
+	}
+}
+
+// processBatch handles messages one by one, a ShutdownError is returned when ctx is cancelled midway
+func (c *Client) processBatch(ctx, handlerBaseCtx context.Context, th TopicHandler, batch []Message) error {
+	for i, message := range batch {
+		if ctx.Err() != nil {
+			return c.shutdown(nil, batch[i:])
+		}
+
+		if th.Handler == nil {
+			c.logger.WarnContext(ctx, "no handler found for topic", messageAttrs(message)...)
+			continue
+		}
+
+		current := c.startHandler(handlerBaseCtx, th, message)
+		select {
+		case err := <-current.done:
+			c.completeMessage(current, err)
+		case <-ctx.Done():
+			return c.shutdown(current, batch[i+1:])
+		}
+	}
+	return nil
+}
+
+// startHandler runs the handler of th for message with retries in the background
+func (c *Client) startHandler(handlerBaseCtx context.Context, th TopicHandler, message Message) *inflight {
+	// continue the producer trace carried in message headers
+	spanCtx, span := tracing.StartConsumerSpan(handlerBaseCtx, system, th.Topic,
+		tracing.HeaderCarrier(message.Headers),
+		semconv.MessagingMessageID(message.ID),
+		semconv.MessagingMessageBodySize(len(message.Value)),
+	)
+
+	current := &inflight{
+		message: message,
+		th:      th,
+		ctx:     spanCtx,
+		done:    make(chan error, 1),
+		span:    span,
+		start:   time.Now(),
+	}
+	go func() {
+		// decoded copy, current.message keeps the raw value for the dlq
+		message := message
+		message.Headers = maps.Clone(message.Headers)
+		if err := c.decodePayload(spanCtx, &message); err != nil {
+			current.done <- err
+			return
+		}
+
+		attempts := 0
+		err := retry.WithBackoff(c.cfg.RetryPolicy, func() error {
+			attempts++
+			handlerCtx, cancel := handlerContext(spanCtx, th.Timeout)
+			defer cancel()
+			return th.Handler(handlerCtx, message)
+		})
+		if attempts > 1 {
+			metrics.Retries.WithLabelValues(metrics.BrokerRedisStreams, th.Topic).Add(float64(attempts - 1))
+		}
+		current.done <- err
+	}()
+	return current
+}
+
+// completeMessage records handler metrics and acknowledges the entry after successful processing
+// or dead-lettering, a failed entry is otherwise left pending for redelivery
+func (c *Client) completeMessage(current *inflight, handlerErr error) bool {
+	ctx, msg := current.ctx, current.message
+	metrics.ObserveHandler(metrics.BrokerRedisStreams, msg.Topic, current.start, handlerErr)
+	tracing.End(current.span, handlerErr)
+
+	if handlerErr != nil {
+		c.logger.ErrorContext(ctx, "message handling failed", append(messageAttrs(msg), logging.Err(handlerErr))...)
+		if current.th.DLQTopic == "" || msg.Deliveries < c.cfg.MaxDeliveries {
+			return false
+		}
+
+		if err := c.sendToDLQ(ctx, current.th.DLQTopic, msg, handlerErr); err != nil {
+			metrics.Errors.WithLabelValues(metrics.BrokerRedisStreams, msg.Topic, metrics.StageDLQ).Inc()
+			c.logger.ErrorContext(ctx, "failed to send message to dlq", append(messageAttrs(msg), logging.Err(err))...)
+			return false
+		}
+		metrics.DeadLettered.WithLabelValues(metrics.BrokerRedisStreams, msg.Topic).Inc()
+		c.logger.WarnContext(ctx, "message sent to dlq", append(messageAttrs(msg), "dlq_topic", current.th.DLQTopic)...)
+	}
+
+	if err := c.rdb.XAck(ctx, msg.Topic, c.cfg.Group, msg.ID).Err(); err != nil {
+		metrics.Errors.WithLabelValues(metrics.BrokerRedisStreams, msg.Topic, metrics.StageCommit).Inc()
+		c.logger.ErrorContext(ctx, "failed to acknowledge message", append(messageAttrs(msg), logging.Err(err))...)
+		return false
+	}
+	return true
+}
+
+// shutdown waits for the in-flight handler (if any) and reports what was left pending
+func (c *Client) shutdown(current *inflight, unstarted []Message) error {
+	c.logger.InfoContext(context.Background(), "stop reading, shutting down consumer", "group", c.cfg.Group, "consumer", c.cfg.Consumer)
+
+	unprocessed := append([]Message(nil), unstarted...)
+	if current != nil {
+		timer := time.NewTimer(c.cfg.ShutdownTimeout)
+		select {
+		case err := <-current.done:
+			timer.Stop()
+			if !c.completeMessage(current, err) {
+				unprocessed = append([]Message{current.message}, unprocessed...)
+			}
+		case <-timer.C:
+			metrics.ObserveHandler(metrics.BrokerRedisStreams, current.message.Topic, current.start, context.DeadlineExceeded)
+			tracing.End(current.span, context.DeadlineExceeded)
+			c.logger.WarnContext(current.ctx, "in-flight handler did not finish before shutdown timeout",
+				append(messageAttrs(current.message), "timeout", c.cfg.ShutdownTimeout)...)
+			unprocessed = append([]Message{current.message}, unprocessed...)
+		}
+	}
+
+	if len(unprocessed) > 0 {
+		for _, m := range unprocessed {
+			c.logger.WarnContext(context.Background(), "unprocessed message", messageAttrs(m)...)
+		}
+		return &ShutdownError{Unprocessed: unprocessed}
+	}
+	return nil
+}
+
+// decodePayload restores a value encoded by Cfg.Payload (decompression, claim-check lookup)
+func (c *Client) decodePayload(ctx context.Context, msg *Message) error {
+	if c.cfg.Payload == nil {
+		return nil
+	}
+	value, err := c.cfg.Payload.Decode(ctx, msg.Value, tracing.HeaderCarrier(msg.Headers))
+	if err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	msg.Value = value
+	return nil
+}
+
+func handlerContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
@@ -0,0 +1,285 @@
+package redisstreams
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testTopic = "orders"
+	testGroup = "workers"
+)
+
+// newTestClient returns a client of testGroup on miniredis, whose clock only moves with m.SetTime
+func newTestClient(t *testing.T, cfg Cfg) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	m.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	rdb := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg.Group = testGroup
+	cfg.Consumer = "alive"
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := NewClient(rdb, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.rdb.XGroupCreateMkStream(context.Background(), testTopic, testGroup, "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	return c, m
+}
+
+// deliver reads all new entries as consumer without acknowledging them
+func deliver(t *testing.T, c *Client, consumer string) []Message {
+	t.Helper()
+	res, err := c.rdb.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    testGroup,
+		Consumer: consumer,
+		Streams:  []string{testTopic, ">"},
+		Count:    100,
+		Block:    -1,
+	}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch []Message
+	for _, entry := range res[0].Messages {
+		batch = append(batch, toMessage(testTopic, entry, 1))
+	}
+	return batch
+}
+
+func pendingCount(t *testing.T, c *Client) int64 {
+	t.Helper()
+	p, err := c.rdb.XPending(context.Background(), testTopic, testGroup).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Count
+}
+
+func TestReclaimFromDeadConsumer(t *testing.T) {
+	c, m := newTestClient(t, Cfg{})
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		if err := c.Publish(ctx, testTopic, Message{Key: key, Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// delivered to a consumer that crashed before acknowledging
+	deliver(t, c, "dead")
+
+	var handled []Message
+	th := TopicHandler{Topic: testTopic, Handler: func(ctx context.Context, msg Message) error {
+		handled = append(handled, msg)
+		return nil
+	}}
+
+	// not idle long enough yet
+	if err := c.reclaim(ctx, ctx, th); err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 0 {
+		t.Fatalf("claimed %d entries before ClaimMinIdle", len(handled))
+	}
+
+	m.SetTime(time.Date(2024, 6, 1, 12, 2, 0, 0, time.UTC))
+	if err := c.reclaim(ctx, ctx, th); err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 2 || handled[0].Key != "a" || handled[1].Key != "b" {
+		t.Fatalf("handled %+v", handled)
+	}
+	for _, msg := range handled {
+		if msg.Deliveries != 2 {
+			t.Fatalf("entry %s delivered %d times, want 2", msg.ID, msg.Deliveries)
+		}
+	}
+	if n := pendingCount(t, c); n != 0 {
+		t.Fatalf("%d entries still pending", n)
+	}
+}
+
+func TestDeadLetterAfterMaxDeliveries(t *testing.T) {
+	c, m := newTestClient(t, Cfg{MaxDeliveries: 3})
+	ctx := context.Background()
+
+	if err := c.Publish(ctx, testTopic, Message{Key: "a", Value: []byte("poison"), Headers: map[string]string{"x-tenant": "t1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	th := TopicHandler{Topic: testTopic, DLQTopic: "orders-dlq", Handler: func(ctx context.Context, msg Message) error {
+		calls++
+		return errors.New("cannot process")
+	}}
+
+	// first delivery fails and stays pending
+	if err := c.processBatch(ctx, ctx, th, deliver(t, c, c.cfg.Consumer)); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for delivery := 2; delivery <= 3; delivery++ {
+		if n, _ := c.rdb.XLen(ctx, "orders-dlq").Result(); n != 0 {
+			t.Fatalf("dead-lettered after %d deliveries", delivery-1)
+		}
+		now = now.Add(2 * time.Minute)
+		m.SetTime(now)
+		if err := c.reclaim(ctx, ctx, th); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 3 {
+		t.Fatalf("handler called %d times, want 3", calls)
+	}
+	if n := pendingCount(t, c); n != 0 {
+		t.Fatalf("dead-lettered entry still pending")
+	}
+
+	entries, err := c.rdb.XRange(ctx, "orders-dlq", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d dlq entries", len(entries))
+	}
+	msg := toMessage("orders-dlq", entries[0], 1)
+	if string(msg.Value) != "poison" || msg.Headers["x-tenant"] != "t1" {
+		t.Fatalf("dlq entry %+v", msg)
+	}
+	if msg.Headers[dlq.HeaderOriginalTopic] != testTopic || msg.Headers[dlq.HeaderError] == "" {
+		t.Fatalf("dlq entry misses failure headers: %v", msg.Headers)
+	}
+}
+
+func TestFailedEntryWithoutDLQStaysPending(t *testing.T) {
+	c, m := newTestClient(t, Cfg{MaxDeliveries: 1})
+	ctx := context.Background()
+
+	if err := c.Publish(ctx, testTopic, Message{Value: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	th := TopicHandler{Topic: testTopic, Handler: func(ctx context.Context, msg Message) error {
+		return errors.New("cannot process")
+	}}
+	if err := c.processBatch(ctx, ctx, th, deliver(t, c, c.cfg.Consumer)); err != nil {
+		t.Fatal(err)
+	}
+	m.SetTime(time.Date(2024, 6, 1, 12, 2, 0, 0, time.UTC))
+	if err := c.reclaim(ctx, ctx, th); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingCount(t, c); n != 1 {
+		t.Fatalf("got %d pending entries, want 1", n)
+	}
+}
+
+func TestReclaimDropsTrimmedEntries(t *testing.T) {
+	c, m := newTestClient(t, Cfg{})
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Publish(ctx, testTopic, Message{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliver(t, c, "dead")
+
+	// the stream was trimmed below the consumer lag, "a" and "b" are gone while pending
+	if err := c.rdb.XTrimMaxLen(ctx, testTopic, 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled []string
+	th := TopicHandler{Topic: testTopic, Handler: func(ctx context.Context, msg Message) error {
+		handled = append(handled, msg.Key)
+		return nil
+	}}
+	m.SetTime(time.Date(2024, 6, 1, 12, 2, 0, 0, time.UTC))
+	if err := c.reclaim(ctx, ctx, th); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 1 || handled[0] != "c" {
+		t.Fatalf("handled %v, want only c", handled)
+	}
+	if n := pendingCount(t, c); n != 0 {
+		t.Fatalf("%d trimmed entries still pending", n)
+	}
+}
+
+func TestReclaimLeavesEntriesClaimedByAnotherConsumer(t *testing.T) {
+	a, m := newTestClient(t, Cfg{})
+	ctx := context.Background()
+	b := *a
+	b.cfg.Consumer = "other"
+
+	if err := a.Publish(ctx, testTopic, Message{Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, a, "dead")
+	m.SetTime(time.Date(2024, 6, 1, 12, 2, 0, 0, time.UTC))
+
+	// a lists the idle entry, b claims it before a does
+	pending, err := a.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: testTopic, Group: testGroup, Idle: a.cfg.ClaimMinIdle, Start: "-", End: "+", Count: 10,
+	}).Result()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending %v, %v", pending, err)
+	}
+	claimedByB, err := b.claimPending(ctx, testTopic)
+	if err != nil || len(claimedByB) != 1 {
+		t.Fatalf("b claimed %v, %v", claimedByB, err)
+	}
+
+	// miniredis ignores the min-idle-time of XCLAIM, answer a as redis does for an entry whose idle time b just reset
+	m.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if strings.EqualFold(cmd, "XCLAIM") && args[2] == a.cfg.Consumer {
+			c.WriteLen(0)
+			return true
+		}
+		return false
+	})
+	claimedByA, err := a.claim(ctx, testTopic, pending)
+	m.Server().SetPreHook(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimedByA) != 0 {
+		t.Fatalf("a claimed %d entries held by b", len(claimedByA))
+	}
+	if n := pendingCount(t, a); n != 1 {
+		t.Fatalf("entry in flight at b was acknowledged, %d pending", n)
+	}
+
+	// b's handler failed, the entry is redelivered once idle again
+	m.SetTime(time.Date(2024, 6, 1, 12, 4, 0, 0, time.UTC))
+	var handled []Message
+	th := TopicHandler{Topic: testTopic, Handler: func(ctx context.Context, msg Message) error {
+		handled = append(handled, msg)
+		return nil
+	}}
+	if err := a.reclaim(ctx, ctx, th); err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 || handled[0].Deliveries != 3 {
+		t.Fatalf("handled %+v", handled)
+	}
+}
@@ -0,0 +1,26 @@
+package redisstreams
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/dlq"
+)
+
+// sendToDLQ adds the raw consumed message to the dead letter stream with the failure recorded in headers
+func (c *Client) sendToDLQ(ctx context.Context, dlqTopic string, msg Message, cause error) error {
+	msg.Headers = maps.Clone(msg.Headers)
+	if msg.Headers == nil {
+		msg.Headers = map[string]string{}
+	}
+	for k, v := range dlq.FailureHeaders(msg.Topic, cause, time.Now()) {
+		msg.Headers[k] = v
+	}
+	// value is still encoded as consumed, so it is not passed through Publish again
+	if err := c.publish(ctx, dlqTopic, msg); err != nil {
+		return fmt.Errorf("failed to send message to dlq %s: %w", dlqTopic, err)
+	}
+	return nil
+}
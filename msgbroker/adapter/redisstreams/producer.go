@@ -0,0 +1,69 @@
+package redisstreams
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/metrics"
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+)
+
+// Publish appends msg to the stream topic, trimmed to Cfg.MaxLen.
+// trace context of ctx is injected into message headers.
+func (c *Client) Publish(ctx context.Context, topic string, msg Message) error {
+	msg.Headers = maps.Clone(msg.Headers)
+	if msg.Headers == nil {
+		msg.Headers = map[string]string{}
+	}
+
+	attrs := []attribute.KeyValue{semconv.MessagingMessageBodySize(len(msg.Value))}
+	ctx, span := tracing.StartProducerSpan(ctx, system, topic, tracing.HeaderCarrier(msg.Headers), attrs...)
+
+	err := c.encodePayload(ctx, &msg)
+	if err == nil {
+		err = c.publish(ctx, topic, msg)
+	}
+	tracing.End(span, err)
+	metrics.ObservePublish(metrics.BrokerRedisStreams, topic, err)
+	return err
+}
+
+// PublishJSON is a convenience method for publishing JSON messages
+func (c *Client) PublishJSON(ctx context.Context, topic string, key string, value interface{}) error {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return c.Publish(ctx, topic, Message{Key: key, Value: jsonData})
+}
+
+func (c *Client) publish(ctx context.Context, topic string, msg Message) error {
+	err := c.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: topic,
+		MaxLen: c.cfg.MaxLen,
+		Approx: c.cfg.MaxLen > 0,
+		Values: toValues(msg),
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add message to stream %s: %w", topic, err)
+	}
+	return nil
+}
+
+// encodePayload applies Cfg.Payload to the message value
+func (c *Client) encodePayload(ctx context.Context, msg *Message) error {
+	if c.cfg.Payload == nil {
+		return nil
+	}
+	value, err := c.cfg.Payload.Encode(ctx, msg.Value, tracing.HeaderCarrier(msg.Headers))
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	msg.Value = value
+	return nil
+}
@@ -0,0 +1,113 @@
+package dlq
+
+import (
+	"strconv"
+	"time"
+)
+
+// headers added when a message is dead-lettered, shared by every broker adapter
+const (
+	HeaderError            = "x-dlq-error"             // last processing error
+	HeaderOriginalTopic    = "x-dlq-original-topic"    // kafka topic or amqp routing key the message was consumed from
+	HeaderOriginalExchange = "x-dlq-original-exchange" // amqp only
+	HeaderFailedAt         = "x-dlq-failed-at"         // RFC3339 time of dead-lettering
+	HeaderRetryCount       = "x-retry-count"           // times the message was republished from the DLQ
+)
+
+// Message is a dead-lettered message as seen by the management tooling
+type Message struct {
+	ID        string            `json:"id"` // kafka "partition:offset", amqp message id
+	Source    string            `json:"source"`
+	Headers   map[string]string `json:"headers"`
+	Body      []byte            `json:"body"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Error returns the recorded processing error
+func (m Message) Error() string { return m.Headers[HeaderError] }
+
+// RetryCount returns how often the message was already republished
+func (m Message) RetryCount() int {
+	n, _ := strconv.Atoi(m.Headers[HeaderRetryCount])
+	return n
+}
+
+// FailedAt returns the dead-lettering time, falling back to the broker timestamp
+func (m Message) FailedAt() time.Time {
+	if t, err := time.Parse(time.RFC3339, m.Headers[HeaderFailedAt]); err == nil {
+		return t
+	}
+	return m.Timestamp
+}
+
+// Filter selects messages, zero value matches everything
+type Filter struct {
+	IDs     []string          // any of these ids
+	Headers map[string]string // all of these header values
+	From    time.Time         // failed at or after
+	To      time.Time         // failed before
+}
+
+func (f Filter) Match(m Message) bool {
+	if len(f.IDs) > 0 {
+		found := false
+		for _, id := range f.IDs {
+			if id == m.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for k, v := range f.Headers {
+		if m.Headers[k] != v {
+			return false
+		}
+	}
+
+	failedAt := m.FailedAt()
+	if !f.From.IsZero() && failedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !failedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// FailureHeaders returns the headers recorded when a message consumed from source is dead-lettered
+func FailureHeaders(source string, err error, now time.Time) map[string]string {
+	headers := map[string]string{
+		HeaderOriginalTopic: source,
+		HeaderFailedAt:      now.UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		headers[HeaderError] = err.Error()
+	}
+	return headers
+}
+
+// RepublishHeaders returns the headers of m for republishing: dead-letter markers removed
+// and the retry count bumped, so handlers can give up on messages that keep failing.
+func RepublishHeaders(m Message) map[string]string {
+	headers := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		if !IsFailureHeader(k) {
+			headers[k] = v
+		}
+	}
+	headers[HeaderRetryCount] = strconv.Itoa(m.RetryCount() + 1)
+	return headers
+}
+
+// IsFailureHeader reports whether key is one of the headers set on dead-lettering
+func IsFailureHeader(key string) bool {
+	switch key {
+	case HeaderError, HeaderFailedAt, HeaderOriginalTopic, HeaderOriginalExchange:
+		return true
+	}
+	return false
+}
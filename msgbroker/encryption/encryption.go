@@ -0,0 +1,138 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/payload"
+)
+
+// envelope headers, the wrapped data key travels with the message so any holder of the master key can decrypt
+const (
+	HeaderEncryption = "x-encryption"          // algorithm marker, absent on clear text messages
+	HeaderKeyID      = "x-encryption-key-id"   // id of the master key that wrapped the data key
+	HeaderDataKey    = "x-encryption-data-key" // base64 wrapped data key
+
+	AlgorithmAES256GCM = "aes-256-gcm"
+
+	dataKeySize = 32
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown encryption key")
+	ErrUnsupportedCodec = errors.New("unsupported encryption algorithm")
+)
+
+// KMS wraps and unwraps data keys with a master key it never exposes.
+// WrapKey always uses the current master key, UnwrapKey must still accept rotated out keys
+// for as long as messages encrypted with them may be consumed.
+type KMS interface {
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+var _ payload.Transformer = Envelope{}
+
+// Envelope encrypts whole message bodies with a fresh AES-256-GCM data key per message,
+// the data key is wrapped by KMS. plug it into kafka.KafkaClient.Payload or rabbitmq.RabbitMQOpts.Payload,
+// after compression when chained (payload.Chain(compressor, envelope)) since ciphertext does not compress.
+type Envelope struct {
+	KMS KMS
+}
+
+func (e Envelope) Encode(ctx context.Context, body []byte, headers payload.Carrier) ([]byte, error) {
+	dataKey, err := randomBytes(dataKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	keyID, wrapped, err := e.KMS.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	ciphertext, err := seal(dataKey, body, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+
+	headers.Set(HeaderEncryption, AlgorithmAES256GCM)
+	headers.Set(HeaderKeyID, keyID)
+	headers.Set(HeaderDataKey, base64.StdEncoding.EncodeToString(wrapped))
+	return ciphertext, nil
+}
+
+func (e Envelope) Decode(ctx context.Context, body []byte, headers payload.Carrier) ([]byte, error) {
+	algorithm := headers.Get(HeaderEncryption)
+	if algorithm == "" {
+		return body, nil
+	}
+	if algorithm != AlgorithmAES256GCM {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, algorithm)
+	}
+
+	keyID := headers.Get(HeaderKeyID)
+	wrapped, err := base64.StdEncoding.DecodeString(headers.Get(HeaderDataKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key header: %w", err)
+	}
+
+	dataKey, err := e.KMS.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := open(dataKey, body, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+// seal encrypts plaintext with AES-GCM, output is nonce || ciphertext || tag.
+// aad binds the ciphertext to e.g. the key id so headers cannot be swapped.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open reverses seal
+func open(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,163 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/tracing"
+)
+
+// newTestKeyring writes a keyring with a single random key under id
+func newTestKeyring(t *testing.T, id string) *Keyring {
+	t.Helper()
+	key, err := randomBytes(dataKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := writeKeyring(path, id, map[string][]byte{id: key}); err != nil {
+		t.Fatal(err)
+	}
+	k, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	env := Envelope{KMS: newTestKeyring(t, "k1")}
+
+	for _, body := range [][]byte{[]byte(`{"id":"1"}`), {}, bytes.Repeat([]byte("x"), 1<<16)} {
+		headers := tracing.HeaderCarrier{}
+		ciphertext, err := env.Encode(ctx, body, headers)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		if len(body) > 0 && bytes.Contains(ciphertext, body) {
+			t.Fatal("ciphertext contains the plaintext")
+		}
+		if headers.Get(HeaderEncryption) != AlgorithmAES256GCM || headers.Get(HeaderKeyID) != "k1" {
+			t.Fatalf("unexpected headers %v", headers)
+		}
+
+		plaintext, err := env.Decode(ctx, ciphertext, headers)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !bytes.Equal(plaintext, body) {
+			t.Fatalf("got %q, want %q", plaintext, body)
+		}
+	}
+}
+
+func TestEnvelopeEncryptsMarkedMessages(t *testing.T) {
+	ctx := context.Background()
+	env := Envelope{KMS: newTestKeyring(t, "k1")}
+
+	// a producer supplied marker must not turn encryption off
+	headers := tracing.HeaderCarrier{HeaderEncryption: AlgorithmAES256GCM}
+	body := []byte("secret")
+	ciphertext, err := env.Encode(ctx, body, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ciphertext, body) {
+		t.Fatal("marked message was sent as clear text")
+	}
+	plaintext, err := env.Decode(ctx, ciphertext, headers)
+	if err != nil || !bytes.Equal(plaintext, body) {
+		t.Fatalf("got %q, %v", plaintext, err)
+	}
+}
+
+func TestEnvelopeTamper(t *testing.T) {
+	ctx := context.Background()
+	env := Envelope{KMS: newTestKeyring(t, "k1")}
+
+	tests := []struct {
+		name   string
+		tamper func(body []byte, headers tracing.HeaderCarrier) []byte
+	}{
+		{"flipped ciphertext byte", func(body []byte, _ tracing.HeaderCarrier) []byte {
+			body[len(body)-1] ^= 1
+			return body
+		}},
+		{"truncated ciphertext", func(body []byte, _ tracing.HeaderCarrier) []byte {
+			return body[:5]
+		}},
+		{"flipped data key byte", func(body []byte, headers tracing.HeaderCarrier) []byte {
+			wrapped, _ := base64.StdEncoding.DecodeString(headers[HeaderDataKey])
+			wrapped[0] ^= 1
+			headers[HeaderDataKey] = base64.StdEncoding.EncodeToString(wrapped)
+			return body
+		}},
+		{"unknown algorithm", func(body []byte, headers tracing.HeaderCarrier) []byte {
+			headers[HeaderEncryption] = "rot13"
+			return body
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := tracing.HeaderCarrier{}
+			ciphertext, err := env.Encode(ctx, []byte("secret"), headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.Decode(ctx, tt.tamper(ciphertext, headers), headers); err == nil {
+				t.Fatal("tampered message decoded")
+			}
+		})
+	}
+}
+
+func TestEnvelopeWrongKey(t *testing.T) {
+	ctx := context.Background()
+	headers := tracing.HeaderCarrier{}
+	ciphertext, err := Envelope{KMS: newTestKeyring(t, "k1")}.Encode(ctx, []byte("secret"), headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same key id, different key material
+	if _, err := (Envelope{KMS: newTestKeyring(t, "k1")}).Decode(ctx, ciphertext, headers); err == nil {
+		t.Fatal("decoded with a different master key")
+	}
+
+	_, err = Envelope{KMS: newTestKeyring(t, "k2")}.Decode(ctx, ciphertext, headers)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestEnvelopeRotatedKey(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKeyring(t, "k1")
+	env := Envelope{KMS: k}
+
+	headers := tracing.HeaderCarrier{}
+	ciphertext, err := env.Encode(ctx, []byte("secret"), headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Rotate("k2"); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := env.Decode(ctx, ciphertext, headers)
+	if err != nil || string(plaintext) != "secret" {
+		t.Fatalf("got %q, %v", plaintext, err)
+	}
+
+	if err := k.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Decode(ctx, ciphertext, headers); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+}
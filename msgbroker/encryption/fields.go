@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldPrefix marks encrypted field values: enc:v1:<key id>:<wrapped data key>:<ciphertext>, all base64url
+const fieldPrefix = "enc:v1:"
+
+// Fields encrypts string fields tagged `encrypt:"true"` in place, leaving the rest of the message readable,
+// e.g. routing or analytics on order ids while customer data stays encrypted:
+//
+//	type Order struct {
+//		ID         string `json:"id"`
+//		ConsumerId string `json:"consumer_id" encrypt:"true"`
+//	}
+//
+// nested structs, pointers and slices are walked. a single data key is used per Encrypt call.
+type Fields struct {
+	KMS KMS
+}
+
+// Encrypt encrypts tagged fields of the struct v points to, empty values are skipped.
+// every other value is encrypted, even one that looks encrypted, so calling it twice encrypts twice.
+func (f Fields) Encrypt(ctx context.Context, v any) error {
+	var (
+		dataKey []byte
+		prefix  string
+	)
+
+	return walkTagged(v, func(field reflect.Value, name string) error {
+		plaintext := field.String()
+		if plaintext == "" {
+			return nil
+		}
+
+		// data key is created lazily, structs without tagged values cost no KMS call
+		if dataKey == nil {
+			key, err := randomBytes(dataKeySize)
+			if err != nil {
+				return fmt.Errorf("failed to generate data key: %w", err)
+			}
+			keyID, wrapped, err := f.KMS.WrapKey(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to wrap data key: %w", err)
+			}
+			dataKey = key
+			prefix = fieldPrefix + encode([]byte(keyID)) + ":" + encode(wrapped) + ":"
+		}
+
+		ciphertext, err := seal(dataKey, []byte(plaintext), []byte(name))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt field %s: %w", name, err)
+		}
+		field.SetString(prefix + encode(ciphertext))
+		return nil
+	})
+}
+
+// Decrypt decrypts tagged fields of the struct v points to, clear text values are left untouched
+func (f Fields) Decrypt(ctx context.Context, v any) error {
+	// unwrapped data keys by wrapped key, fields encrypted in one call share a data key
+	dataKeys := make(map[string][]byte)
+
+	return walkTagged(v, func(field reflect.Value, name string) error {
+		value := field.String()
+		if !strings.HasPrefix(value, fieldPrefix) {
+			return nil
+		}
+
+		parts := strings.Split(strings.TrimPrefix(value, fieldPrefix), ":")
+		if len(parts) != 3 {
+			return fmt.Errorf("malformed encrypted field %s", name)
+		}
+
+		dataKey, ok := dataKeys[parts[1]]
+		if !ok {
+			keyID, err := decode(parts[0])
+			if err != nil {
+				return fmt.Errorf("malformed encrypted field %s: %w", name, err)
+			}
+			wrapped, err := decode(parts[1])
+			if err != nil {
+				return fmt.Errorf("malformed encrypted field %s: %w", name, err)
+			}
+			if dataKey, err = f.KMS.UnwrapKey(ctx, string(keyID), wrapped); err != nil {
+				return fmt.Errorf("failed to unwrap data key of field %s: %w", name, err)
+			}
+			dataKeys[parts[1]] = dataKey
+		}
+
+		ciphertext, err := decode(parts[2])
+		if err != nil {
+			return fmt.Errorf("malformed encrypted field %s: %w", name, err)
+		}
+		plaintext, err := open(dataKey, ciphertext, []byte(name))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt field %s: %w", name, err)
+		}
+		field.SetString(string(plaintext))
+		return nil
+	})
+}
+
+// walkTagged calls fn with every settable string field tagged encrypt:"true",
+// name is the field name, bound to the ciphertext so values cannot be moved between fields.
+func walkTagged(v any, fn func(field reflect.Value, name string) error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("expected non-nil pointer to struct")
+	}
+	return walk(rv.Elem(), fn)
+}
+
+func walk(rv reflect.Value, fn func(reflect.Value, string) error) error {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return walk(rv.Elem(), fn)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := walk(rv.Index(i), fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			sf := rt.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			field := rv.Field(i)
+
+			if sf.Tag.Get("encrypt") != "true" {
+				if err := walk(field, fn); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if field.Kind() != reflect.String {
+				return fmt.Errorf("field %s tagged encrypt must be a string, got %s", sf.Name, field.Kind())
+			}
+			if !field.CanSet() {
+				continue
+			}
+			if err := fn(field, sf.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,132 @@
+package encryption
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type testAddress struct {
+	Street string `encrypt:"true"`
+	City   string
+}
+
+type testOrder struct {
+	ID        string
+	Email     string `encrypt:"true"`
+	Phone     string `encrypt:"true"`
+	Address   *testAddress
+	Addresses []testAddress
+}
+
+func newTestOrder() *testOrder {
+	return &testOrder{
+		ID:        "o-1",
+		Email:     "jane@example.com",
+		Address:   &testAddress{Street: "Main St 1", City: "Springfield"},
+		Addresses: []testAddress{{Street: "Side St 2", City: "Shelbyville"}},
+	}
+}
+
+func TestFieldsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := Fields{KMS: newTestKeyring(t, "k1")}
+
+	order := newTestOrder()
+	if err := f.Encrypt(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{order.Email, order.Address.Street, order.Addresses[0].Street} {
+		if !strings.HasPrefix(v, fieldPrefix) {
+			t.Fatalf("field not encrypted: %q", v)
+		}
+	}
+	if order.ID != "o-1" || order.Address.City != "Springfield" || order.Phone != "" {
+		t.Fatalf("untagged or empty fields changed: %+v", order)
+	}
+
+	if err := f.Decrypt(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	want := newTestOrder()
+	if order.Email != want.Email || order.Address.Street != want.Address.Street || order.Addresses[0].Street != want.Addresses[0].Street {
+		t.Fatalf("got %+v", order)
+	}
+}
+
+func TestFieldsEncryptsPrefixedPlaintext(t *testing.T) {
+	ctx := context.Background()
+	f := Fields{KMS: newTestKeyring(t, "k1")}
+
+	for _, input := range []string{"enc:v1:x", fieldPrefix + "a:b:c"} {
+		order := &testOrder{Email: input}
+		if err := f.Encrypt(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+		if order.Email == input {
+			t.Fatalf("%q stored unencrypted", input)
+		}
+		if err := f.Decrypt(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+		if order.Email != input {
+			t.Fatalf("got %q, want %q", order.Email, input)
+		}
+	}
+}
+
+func TestFieldsTamper(t *testing.T) {
+	ctx := context.Background()
+	f := Fields{KMS: newTestKeyring(t, "k1")}
+
+	tests := []struct {
+		name   string
+		tamper func(o *testOrder)
+	}{
+		{"flipped ciphertext", func(o *testOrder) {
+			i := strings.LastIndex(o.Email, ":") + 1
+			ciphertext, _ := decode(o.Email[i:])
+			ciphertext[0] ^= 1
+			o.Email = o.Email[:i] + encode(ciphertext)
+		}},
+		{"moved between fields", func(o *testOrder) {
+			o.Address.Street = o.Email
+		}},
+		{"malformed", func(o *testOrder) {
+			o.Email = fieldPrefix + "x"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := newTestOrder()
+			if err := f.Encrypt(ctx, order); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(order)
+			if err := f.Decrypt(ctx, order); err == nil {
+				t.Fatal("tampered field decrypted")
+			}
+		})
+	}
+}
+
+func TestFieldsWrongKey(t *testing.T) {
+	ctx := context.Background()
+	order := newTestOrder()
+	if err := (Fields{KMS: newTestKeyring(t, "k1")}).Encrypt(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Fields{KMS: newTestKeyring(t, "k1")}).Decrypt(ctx, order); err == nil {
+		t.Fatal("decrypted with a different master key")
+	}
+}
+
+func TestFieldsRejectsNonString(t *testing.T) {
+	type bad struct {
+		N int `encrypt:"true"`
+	}
+	if err := (Fields{KMS: newTestKeyring(t, "k1")}).Encrypt(context.Background(), &bad{N: 1}); err == nil {
+		t.Fatal("expected error for non string field")
+	}
+}
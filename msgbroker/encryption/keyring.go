@@ -0,0 +1,197 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var _ KMS = (*Keyring)(nil)
+
+// Keyring is a KMS backed by master keys in a local json file:
+//
+//	{"current": "2024-06", "keys": {"2024-01": "<base64 32 bytes>", "2024-06": "<base64 32 bytes>"}}
+//
+// meant for development and single host deployments, keep the file readable by the service only.
+type Keyring struct {
+	path string
+
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads the keyring at path
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads the keyring file, e.g. after another instance rotated the key
+func (k *Keyring) Reload() error {
+	raw, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("failed to parse keyring: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		if len(key) != dataKeySize {
+			return fmt.Errorf("invalid key %s: expected %d bytes, got %d", id, dataKeySize, len(key))
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("%w: current key %q not in keyring", ErrUnknownKey, file.Current)
+	}
+
+	k.mu.Lock()
+	k.current, k.keys = file.Current, keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new master key under id, makes it current and saves the keyring.
+// previous keys are kept so messages already in flight can still be decrypted.
+func (k *Keyring) Rotate(id string) error {
+	if id == "" {
+		return errors.New("key id is required")
+	}
+
+	key, err := randomBytes(dataKeySize)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key %s already exists", id)
+	}
+
+	keys := make(map[string][]byte, len(k.keys)+1)
+	for kid, v := range k.keys {
+		keys[kid] = v
+	}
+	keys[id] = key
+
+	if err := writeKeyring(k.path, id, keys); err != nil {
+		return err
+	}
+	k.current, k.keys = id, keys
+	return nil
+}
+
+// Retire removes a key that no in-flight message uses anymore, the current key cannot be retired
+func (k *Keyring) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id == k.current {
+		return errors.New("cannot retire current key")
+	}
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	keys := make(map[string][]byte, len(k.keys))
+	for kid, v := range k.keys {
+		if kid != id {
+			keys[kid] = v
+		}
+	}
+
+	if err := writeKeyring(k.path, k.current, keys); err != nil {
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+// CurrentKeyID returns the id used for new data keys
+func (k *Keyring) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+func (k *Keyring) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	id, master := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	wrapped, err := seal(master, dataKey, []byte(id))
+	if err != nil {
+		return "", nil, err
+	}
+	return id, wrapped, nil
+}
+
+func (k *Keyring) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	master, ok := k.keys[keyID]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(master, wrapped, []byte(keyID))
+}
+
+// writeKeyring replaces the keyring file atomically
+func writeKeyring(path, current string, keys map[string][]byte) error {
+	file := keyringFile{Current: current, Keys: make(map[string]string, len(keys))}
+	for id, key := range keys {
+		file.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keyring: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redacted = "[REDACTED]"
+
+// redaction rules applied by the handler returned from NewHandler
+type RedactRules struct {
+	Keys        []string // attribute keys always masked (case insensitive), e.g. "password", "authorization"
+	ShowPayload bool     // reveal Payload attributes, default keeps them redacted
+	MaxPayload  int      // truncate revealed payloads to this many bytes, 0 means no limit
+}
+
+// DefaultRedactRules masks common credential fields and keeps payloads hidden
+var DefaultRedactRules = RedactRules{
+	Keys: []string{"password", "passwd", "secret", "token", "authorization", "api_key"},
+}
+
+// handler decorates another slog.Handler with redaction and trace/span ids from the record context
+type handler struct {
+	next  slog.Handler
+	rules RedactRules
+	keys  map[string]struct{}
+}
+
+// NewHandler wraps next so that records carry trace_id and span_id of the span in context
+// and attributes are redacted according to rules.
+func NewHandler(next slog.Handler, rules RedactRules) slog.Handler {
+	keys := make(map[string]struct{}, len(rules.Keys))
+	for _, k := range rules.Keys {
+		keys[strings.ToLower(k)] = struct{}{}
+	}
+	return &handler{next: next, rules: rules, keys: keys}
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redact(a))
+		return true
+	})
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		out.AddAttrs(
+			slog.String(KeyTraceID, sc.TraceID().String()),
+			slog.String(KeySpanID, sc.SpanID().String()),
+		)
+	}
+
+	return h.next.Handle(ctx, out)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redact(a))
+	}
+	return &handler{next: h.next.WithAttrs(redactedAttrs), rules: h.rules, keys: h.keys}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), rules: h.rules, keys: h.keys}
+}
+
+func (h *handler) redact(a slog.Attr) slog.Attr {
+	if _, ok := h.keys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		attrs := make([]slog.Attr, 0, len(group))
+		for _, ga := range group {
+			attrs = append(attrs, h.redact(ga))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}
+
+	case slog.KindLogValuer:
+		p, ok := a.Value.Any().(payload)
+		if !ok || !h.rules.ShowPayload {
+			return a
+		}
+		if h.rules.MaxPayload > 0 && len(p) > h.rules.MaxPayload {
+			return slog.String(a.Key, fmt.Sprintf("%s...(%d bytes)", p[:h.rules.MaxPayload], len(p)))
+		}
+		return slog.String(a.Key, string(p))
+	}
+
+	return a
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Logger is the structured logger used by the broker adapters, *slog.Logger satisfies it.
+// fields are passed as alternating key/value pairs or slog.Attr, like slog.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	WarnContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
+}
+
+// common field keys
+const (
+	KeyTopic      = "topic"
+	KeyPartition  = "partition"
+	KeyOffset     = "offset"
+	KeyKey        = "key"
+	KeyQueue      = "queue"
+	KeyRoutingKey = "routing_key"
+	KeyExchange   = "exchange"
+	KeyPayload    = "payload"
+	KeyError      = "error"
+	KeyTraceID    = "trace_id"
+	KeySpanID     = "span_id"
+)
+
+// Default returns the process wide slog.Default logger
+func Default() Logger {
+	return slog.Default()
+}
+
+// OrDefault returns l, or Default when l is nil
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
+
+// Err is a shorthand for the error field
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// Payload wraps message content so it is never logged in clear text by default,
+// only a handler from NewHandler with RedactRules.ShowPayload reveals it.
+func Payload(value []byte) slog.Attr {
+	return slog.Any(KeyPayload, payload(value))
+}
+
+type payload []byte
+
+func (p payload) LogValue() slog.Value {
+	return slog.StringValue(fmt.Sprintf("[REDACTED %d bytes]", len(p)))
+}
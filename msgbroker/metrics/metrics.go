@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "msgbroker"
+
+// broker label values
+const (
+	BrokerKafka        = "kafka"
+	BrokerRabbitMQ     = "rabbitmq"
+	BrokerRedisStreams = "redis-streams"
+)
+
+// error stage label values
+const (
+	StageHandle  = "handle"
+	StageCommit  = "commit"
+	StageProduce = "produce"
+	StageDeliver = "deliver"
+	StageDLQ     = "dlq"
+)
+
+// collectors shared by every adapter, labelled by broker and topic (routing key for rabbitmq).
+// adapters always record into them, they are only exported once registered with Register.
+var (
+	MessagesConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Number of messages received by consumers.",
+	}, []string{"broker", "topic"})
+
+	MessagesProduced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_produced_total",
+		Help:      "Number of messages successfully published.",
+	}, []string{"broker", "topic"})
+
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Latency of message handlers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"broker", "topic"})
+
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Number of errors by stage (handle, commit, produce, deliver, dlq).",
+	}, []string{"broker", "topic", "stage"})
+
+	Retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Number of retried message processing or publish attempts.",
+	}, []string{"broker", "topic"})
+
+	DeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_lettered_total",
+		Help:      "Number of messages moved to a dead letter queue.",
+	}, []string{"broker", "topic"})
+)
+
+// Register registers the shared collectors, registering twice on the same registry is not an error
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		MessagesConsumed,
+		MessagesProduced,
+		HandlerDuration,
+		Errors,
+		Retries,
+		DeadLettered,
+	} {
+		if err := reg.Register(c); err != nil {
+			var are prometheus.AlreadyRegisteredError
+			if errors.As(err, &are) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ObserveHandler records consumption and handler latency, plus a handle error when err is not nil
+func ObserveHandler(broker, topic string, start time.Time, err error) {
+	MessagesConsumed.WithLabelValues(broker, topic).Inc()
+	HandlerDuration.WithLabelValues(broker, topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		Errors.WithLabelValues(broker, topic, StageHandle).Inc()
+	}
+}
+
+// ObservePublish records a produced message or a produce error
+func ObservePublish(broker, topic string, err error) {
+	if err != nil {
+		Errors.WithLabelValues(broker, topic, StageProduce).Inc()
+		return
+	}
+	MessagesProduced.WithLabelValues(broker, topic).Inc()
+}
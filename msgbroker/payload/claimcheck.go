@@ -0,0 +1,135 @@
+package payload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// claim-check headers, the body of an offloaded message is empty
+const (
+	HeaderClaimCheck     = "x-claim-check"      // blob key in the store
+	HeaderClaimCheckSize = "x-claim-check-size" // size of the offloaded body
+)
+
+// ErrBlobNotFound is wrapped by Decode errors for offloaded payloads missing from the store
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps offloaded payloads, storage/mongodb (GridFS) and storage/postgres provide implementations.
+// Get of an unknown key returns an error wrapping ErrBlobNotFound or one with a NotFound() bool method
+// reporting true, as storage/blob.ErrNotFound has. Delete of an unknown key returns nil.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ClaimCheck stores bodies larger than Threshold in Store and sends only a reference header.
+// blobs are not deleted on consume since a message may be consumed by several groups or replayed,
+// expire them in the store instead.
+type ClaimCheck struct {
+	Store     BlobStore
+	Threshold int // bodies above this size in bytes are offloaded, keep it below the broker message limit
+}
+
+func (c ClaimCheck) Encode(ctx context.Context, body []byte, headers Carrier) ([]byte, error) {
+	if len(body) <= c.Threshold {
+		return body, nil
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate claim-check key: %w", err)
+	}
+
+	if err := c.Store.Put(ctx, key, body); err != nil {
+		return nil, fmt.Errorf("failed to store claim-check payload: %w", err)
+	}
+
+	headers.Set(HeaderClaimCheck, key)
+	headers.Set(HeaderClaimCheckSize, strconv.Itoa(len(body)))
+	return []byte{}, nil
+}
+
+func (c ClaimCheck) Decode(ctx context.Context, body []byte, headers Carrier) ([]byte, error) {
+	key := headers.Get(HeaderClaimCheck)
+	if key == "" {
+		return body, nil
+	}
+
+	data, err := c.Store.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrBlobNotFound) && storeNotFound(err) {
+			return nil, fmt.Errorf("failed to load claim-check payload %s: %w: %w", key, ErrBlobNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to load claim-check payload %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// storeNotFound reports whether a store error marks an unknown key by a NotFound() bool method
+func storeNotFound(err error) bool {
+	var nf interface{ NotFound() bool }
+	return errors.As(err, &nf) && nf.NotFound()
+}
+
+// FileStore keeps blobs as files in Dir, suitable for a single host or a shared volume
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) Put(_ context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create blob dir: %w", err)
+	}
+
+	// write then rename so readers never see a partial file
+	tmp, err := os.CreateTemp(s.Dir, key+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write blob file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to close blob file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read blob file %s: %w", key, ErrBlobNotFound)
+	}
+	return data, err
+}
+
+func (s FileStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path keeps keys from escaping Dir
+func (s FileStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.Base(key))
+}
+
+func newBlobKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,166 @@
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// HeaderContentEncoding marks compressed bodies with the algorithm used
+const HeaderContentEncoding = "x-content-encoding"
+
+type Algorithm string
+
+const (
+	Gzip   Algorithm = "gzip"
+	Zstd   Algorithm = "zstd"
+	Snappy Algorithm = "snappy"
+)
+
+const defaultMaxDecodedSize = 64 << 20
+
+// ErrTooLarge is returned when a body decompresses to more than Compressor.MaxDecodedSize
+var ErrTooLarge = errors.New("decompressed payload too large")
+
+// Compressor compresses bodies of at least MinSize bytes and decompresses any body carrying the header marker,
+// whatever algorithm the producer used.
+type Compressor struct {
+	Algorithm      Algorithm
+	MinSize        int // smaller bodies are sent as is, compression rarely pays off on a few hundred bytes
+	MaxDecodedSize int // bodies decompressing to more bytes are rejected with ErrTooLarge, default 64MiB
+}
+
+var (
+	zstdOnce     sync.Once
+	zstdEncoder  *zstd.Encoder
+	zstdErr      error
+	zstdDecoders sync.Map // max decoded size -> *zstd.Decoder
+)
+
+// zstd encoders and decoders are safe for concurrent EncodeAll/DecodeAll and costly to create
+func zstdEncoderShared() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+// zstdDecoderLimited returns the shared decoder refusing to decode more than maxSize bytes
+func zstdDecoderLimited(maxSize int) (*zstd.Decoder, error) {
+	if dec, ok := zstdDecoders.Load(maxSize); ok {
+		return dec.(*zstd.Decoder), nil
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+	if err != nil {
+		return nil, err
+	}
+	if existing, loaded := zstdDecoders.LoadOrStore(maxSize, dec); loaded {
+		dec.Close()
+		return existing.(*zstd.Decoder), nil
+	}
+	return dec, nil
+}
+
+func (c Compressor) Encode(_ context.Context, body []byte, headers Carrier) ([]byte, error) {
+	if len(body) < c.MinSize || headers.Get(HeaderContentEncoding) != "" {
+		return body, nil
+	}
+
+	out, err := compress(c.Algorithm, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress payload with %s: %w", c.Algorithm, err)
+	}
+	headers.Set(HeaderContentEncoding, string(c.Algorithm))
+	return out, nil
+}
+
+func (c Compressor) Decode(_ context.Context, body []byte, headers Carrier) ([]byte, error) {
+	algorithm := Algorithm(headers.Get(HeaderContentEncoding))
+	if algorithm == "" {
+		return body, nil
+	}
+
+	maxSize := c.MaxDecodedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecodedSize
+	}
+
+	out, err := decompress(algorithm, body, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload with %s: %w", algorithm, err)
+	}
+	return out, nil
+}
+
+func compress(algorithm Algorithm, body []byte) ([]byte, error) {
+	switch algorithm {
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, err := zstdEncoderShared()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(body, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, body), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+// decompress refuses to produce more than maxSize bytes, a few compressed bytes can expand to gigabytes
+func decompress(algorithm Algorithm, body []byte, maxSize int) ([]byte, error) {
+	switch algorithm {
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxSize {
+			return nil, ErrTooLarge
+		}
+		return out, nil
+	case Zstd:
+		dec, err := zstdDecoderLimited(maxSize)
+		if err != nil {
+			return nil, err
+		}
+		out, err := dec.DecodeAll(body, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrTooLarge
+		}
+		return out, err
+	case Snappy:
+		n, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxSize {
+			return nil, ErrTooLarge
+		}
+		return snappy.Decode(nil, body)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
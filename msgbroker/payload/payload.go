@@ -0,0 +1,45 @@
+package payload
+
+import "context"
+
+// Carrier gives transformers access to message headers,
+// *kafka.Headers and tracing.TableCarrier (amqp headers) satisfy it.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// Transformer rewrites message bodies on publish and restores them on consume.
+// Encode records whatever Decode needs in headers, Decode must pass through bodies it did not encode.
+type Transformer interface {
+	Encode(ctx context.Context, body []byte, headers Carrier) ([]byte, error)
+	Decode(ctx context.Context, body []byte, headers Carrier) ([]byte, error)
+}
+
+// Chain applies transformers in order on Encode and in reverse order on Decode,
+// e.g. Chain(compressor, claimCheck) compresses first and only offloads what is still too large.
+func Chain(transformers ...Transformer) Transformer {
+	return chain(transformers)
+}
+
+type chain []Transformer
+
+func (c chain) Encode(ctx context.Context, body []byte, headers Carrier) ([]byte, error) {
+	var err error
+	for _, t := range c {
+		if body, err = t.Encode(ctx, body, headers); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+func (c chain) Decode(ctx context.Context, body []byte, headers Carrier) ([]byte, error) {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if body, err = c[i].Decode(ctx, body, headers); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
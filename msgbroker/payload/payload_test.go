@@ -0,0 +1,100 @@
+package payload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type mapCarrier map[string]string
+
+func (c mapCarrier) Get(key string) string { return c[key] }
+func (c mapCarrier) Set(key, value string) { c[key] = value }
+
+func TestCompressorRoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte("order-created "), 1000)
+	for _, algorithm := range []Algorithm{Gzip, Zstd, Snappy} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			c := Compressor{Algorithm: algorithm}
+			headers := mapCarrier{}
+
+			encoded, err := c.Encode(context.Background(), body, headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if headers.Get(HeaderContentEncoding) != string(algorithm) || len(encoded) >= len(body) {
+				t.Fatalf("body not compressed, %d bytes, headers %v", len(encoded), headers)
+			}
+
+			decoded, err := c.Decode(context.Background(), encoded, headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, body) {
+				t.Fatal("round trip changed the body")
+			}
+		})
+	}
+}
+
+func TestCompressorRejectsOversizedBody(t *testing.T) {
+	body := make([]byte, 1<<20)
+	for _, algorithm := range []Algorithm{Gzip, Zstd, Snappy} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			headers := mapCarrier{}
+			encoded, err := Compressor{Algorithm: algorithm}.Encode(context.Background(), body, headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			limited := Compressor{MaxDecodedSize: 64 << 10}
+			if _, err := limited.Decode(context.Background(), encoded, headers); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("got %v, want ErrTooLarge", err)
+			}
+
+			// exactly at the limit is fine
+			exact := Compressor{MaxDecodedSize: len(body)}
+			if _, err := exact.Decode(context.Background(), encoded, headers); err != nil {
+				t.Fatalf("body at the limit: %v", err)
+			}
+		})
+	}
+}
+
+func TestClaimCheckMissingBlob(t *testing.T) {
+	c := ClaimCheck{Store: FileStore{Dir: t.TempDir()}}
+	headers := mapCarrier{HeaderClaimCheck: "missing"}
+
+	if _, err := c.Decode(context.Background(), nil, headers); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("got %v, want ErrBlobNotFound", err)
+	}
+	if err := c.Store.Delete(context.Background(), "missing"); err != nil {
+		t.Fatalf("delete of unknown key: %v", err)
+	}
+}
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string  { return "no such blob" }
+func (notFoundErr) NotFound() bool { return true }
+
+type notFoundStore struct{ FileStore }
+
+func (notFoundStore) Get(context.Context, string) ([]byte, error) {
+	return nil, fmt.Errorf("failed to get blob: %w", notFoundErr{})
+}
+
+func TestClaimCheckStoreNotFound(t *testing.T) {
+	c := ClaimCheck{Store: notFoundStore{}}
+	headers := mapCarrier{HeaderClaimCheck: "missing"}
+
+	_, err := c.Decode(context.Background(), nil, headers)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("got %v, want ErrBlobNotFound", err)
+	}
+	if !errors.Is(err, notFoundErr{}) {
+		t.Fatalf("got %v, want the store error kept", err)
+	}
+}
@@ -0,0 +1,397 @@
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+const (
+	defaultStepTimeout             = 5 * time.Minute
+	defaultPollInterval            = 5 * time.Second
+	defaultBatchSize               = 100
+	defaultMaxCompensationAttempts = 5
+
+	maxConflictRetries = 3
+)
+
+// orchestrator configuration, zero value uses defaults
+type Cfg struct {
+	StepTimeout             time.Duration  // default reply timeout of steps, default 5m
+	PollInterval            time.Duration  // how often timed out and interrupted sagas are looked up, default 5s
+	BatchSize               int            // max sagas recovered per poll, default 100
+	MaxCompensationAttempts int            // tries per compensation before the saga is marked failed, default 5
+	Logger                  logging.Logger // slog.Default when nil
+}
+
+// Orchestrator drives sagas: it runs step actions, advances on replies consumed from the broker
+// (see HandleMessage) and compensates completed steps in reverse order on failure or timeout.
+// every transition is persisted before its side effect, so any number of instances can share the store
+// and Run picks up sagas left behind by a crash once their step deadline passed.
+type Orchestrator struct {
+	store Store
+	cfg   Cfg
+
+	mu   sync.RWMutex
+	defs map[string]Definition
+}
+
+func New(store Store, cfg Cfg) *Orchestrator {
+	if cfg.StepTimeout <= 0 {
+		cfg.StepTimeout = defaultStepTimeout
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.MaxCompensationAttempts <= 0 {
+		cfg.MaxCompensationAttempts = defaultMaxCompensationAttempts
+	}
+	cfg.Logger = logging.OrDefault(cfg.Logger)
+	return &Orchestrator{store: store, cfg: cfg, defs: make(map[string]Definition)}
+}
+
+// Register adds a saga definition, sagas of unregistered definitions cannot start or recover
+func (o *Orchestrator) Register(def Definition) error {
+	if def.Name == "" {
+		return errors.New("saga name cannot be empty")
+	}
+	if len(def.Steps) == 0 {
+		return fmt.Errorf("saga %s has no steps", def.Name)
+	}
+
+	names := make(map[string]struct{}, len(def.Steps))
+	for i, step := range def.Steps {
+		if step.Name == "" || step.Action == nil {
+			return fmt.Errorf("saga %s step %d needs a name and an action", def.Name, i)
+		}
+		if _, ok := names[step.Name]; ok {
+			return fmt.Errorf("saga %s has duplicate step %s", def.Name, step.Name)
+		}
+		names[step.Name] = struct{}{}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.defs[def.Name] = def
+	return nil
+}
+
+// Start creates a saga of the registered definition with data and runs its first step.
+// id makes starting idempotent (ErrExists when it was started already), a random id is used when empty.
+func (o *Orchestrator) Start(ctx context.Context, saga, id string, data any) (*State, error) {
+	def, err := o.definition(saga)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		if id, err = newID(); err != nil {
+			return nil, fmt.Errorf("failed to generate saga id: %w", err)
+		}
+	}
+
+	now := time.Now()
+	state := &State{
+		ID:        id,
+		Saga:      saga,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Deadline:  now.Add(o.timeout(def.Steps[0])),
+	}
+	if err := state.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to marshal saga data: %w", err)
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal saga state: %w", err)
+	}
+	ok, err := o.store.Create(ctx, id, raw, state.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create saga: %w", err)
+	}
+	if !ok {
+		return nil, ErrExists
+	}
+	state.version = 1
+
+	o.cfg.Logger.InfoContext(ctx, "saga started", o.attrs(state)...)
+	if err := o.execute(ctx, def, state); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// Get returns the current state of a saga
+func (o *Orchestrator) Get(ctx context.Context, id string) (*State, error) {
+	return o.load(ctx, id)
+}
+
+// HandleMessage handles a consumed message as a step reply, messages without saga headers are ignored.
+// use it as (part of) the handler of the reply topics or queues.
+func (o *Orchestrator) HandleMessage(ctx context.Context, headers map[string]string, body []byte) error {
+	r, ok := ParseReply(headers, body)
+	if !ok {
+		return nil
+	}
+	return o.HandleReply(ctx, r)
+}
+
+// HandleReply completes the current step on success and runs the next one, or starts compensation on failure.
+// duplicate and late replies of steps that are no longer current are ignored.
+func (o *Orchestrator) HandleReply(ctx context.Context, r Reply) error {
+	var err error
+	for i := 0; i < maxConflictRetries; i++ {
+		if err = o.handleReply(ctx, r); !errors.Is(err, errVersionChange) {
+			return err
+		}
+	}
+	return err
+}
+
+func (o *Orchestrator) handleReply(ctx context.Context, r Reply) error {
+	state, err := o.load(ctx, r.SagaID)
+	if err != nil {
+		return err
+	}
+	def, err := o.definition(state.Saga)
+	if err != nil {
+		return err
+	}
+
+	if state.Status != StatusRunning || state.Step >= len(def.Steps) || def.Steps[state.Step].Name != r.Step {
+		o.cfg.Logger.DebugContext(ctx, "stale saga reply ignored", append(o.attrs(state), "reply_step", r.Step)...)
+		return nil
+	}
+	step := def.Steps[state.Step]
+
+	if !r.Success {
+		// the participant rolled back its own step, undo the ones before it
+		return o.compensate(ctx, def, state, state.Step-1, fmt.Sprintf("step %s failed: %s", step.Name, r.Error))
+	}
+
+	if step.OnReply != nil {
+		if err := step.OnReply(ctx, state, r); err != nil {
+			return o.compensate(ctx, def, state, state.Step, fmt.Sprintf("step %s reply rejected: %v", step.Name, err))
+		}
+	}
+
+	state.Step++
+	state.Attempts = 0
+	return o.execute(ctx, def, state)
+}
+
+// Run recovers sagas whose step deadline passed until ctx is cancelled: timed out steps are retried or
+// compensated, interrupted compensations are resumed.
+func (o *Orchestrator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.recoverDue(ctx); err != nil && ctx.Err() == nil {
+			o.cfg.Logger.ErrorContext(ctx, "failed to recover sagas", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Orchestrator) recoverDue(ctx context.Context) error {
+	ids, err := o.store.Due(ctx, time.Now(), o.cfg.BatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to list due sagas: %w", err)
+	}
+
+	for _, id := range ids {
+		err := o.recover(ctx, id)
+		switch {
+		case errors.Is(err, errVersionChange):
+			// another instance or a reply got there first
+			o.cfg.Logger.DebugContext(ctx, "saga changed concurrently, recovery skipped", "saga_id", id)
+		case err != nil:
+			o.cfg.Logger.ErrorContext(ctx, "failed to recover saga", "saga_id", id, logging.Err(err))
+		}
+	}
+	return nil
+}
+
+func (o *Orchestrator) recover(ctx context.Context, id string) error {
+	state, err := o.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	def, err := o.definition(state.Saga)
+	if err != nil {
+		return err
+	}
+	if state.Status.Done() || state.Deadline.After(time.Now()) {
+		return nil
+	}
+
+	switch state.Status {
+	case StatusRunning:
+		step := def.Steps[state.Step]
+		if state.Attempts <= step.Retries {
+			o.cfg.Logger.WarnContext(ctx, "saga step timed out, sending again", o.attrs(state)...)
+			return o.execute(ctx, def, state)
+		}
+		// the outcome of the step is unknown, it is compensated as well
+		return o.compensate(ctx, def, state, state.Step, fmt.Sprintf("step %s timed out", step.Name))
+	case StatusCompensating:
+		return o.compensate(ctx, def, state, state.Step, state.Error)
+	}
+	return nil
+}
+
+// execute runs the current step and, for local steps, the following ones until a reply must be awaited
+func (o *Orchestrator) execute(ctx context.Context, def Definition, state *State) error {
+	for state.Step < len(def.Steps) {
+		step := def.Steps[state.Step]
+
+		state.Attempts++
+		state.Deadline = time.Now().Add(o.timeout(step))
+		if err := o.save(ctx, state); err != nil {
+			return err
+		}
+
+		if err := step.Action(ctx, state); err != nil {
+			return o.compensate(ctx, def, state, state.Step-1, fmt.Sprintf("step %s action failed: %v", step.Name, err))
+		}
+		if !step.Local {
+			return nil
+		}
+		state.Step++
+		state.Attempts = 0
+	}
+
+	state.Status = StatusCompleted
+	state.Deadline = time.Time{}
+	if err := o.save(ctx, state); err != nil {
+		return err
+	}
+	o.cfg.Logger.InfoContext(ctx, "saga completed", o.attrs(state)...)
+	return nil
+}
+
+// compensate undoes steps from index from down to the first one. a failing compensation is retried
+// by Run after the step timeout, up to Cfg.MaxCompensationAttempts.
+func (o *Orchestrator) compensate(ctx context.Context, def Definition, state *State, from int, cause string) error {
+	if state.Status != StatusCompensating {
+		o.cfg.Logger.WarnContext(ctx, "saga compensating", append(o.attrs(state), "cause", cause)...)
+		state.Status = StatusCompensating
+		state.Step = from
+		state.Attempts = 0
+		state.Error = cause
+	}
+
+	for state.Step >= 0 {
+		step := def.Steps[state.Step]
+		if step.Compensate != nil {
+			state.Attempts++
+			state.Deadline = time.Now().Add(o.timeout(step))
+			if err := o.save(ctx, state); err != nil {
+				return err
+			}
+
+			if err := step.Compensate(ctx, state); err != nil {
+				o.cfg.Logger.ErrorContext(ctx, "saga compensation failed", append(o.attrs(state), logging.Err(err))...)
+				if state.Attempts < o.cfg.MaxCompensationAttempts {
+					return nil
+				}
+				state.Status = StatusFailed
+				state.Error = fmt.Sprintf("%s; compensation of step %s failed: %v", state.Error, step.Name, err)
+				state.Deadline = time.Time{}
+				return o.save(ctx, state)
+			}
+		}
+		state.Step--
+		state.Attempts = 0
+	}
+
+	state.Status = StatusCompensated
+	state.Deadline = time.Time{}
+	if err := o.save(ctx, state); err != nil {
+		return err
+	}
+	o.cfg.Logger.InfoContext(ctx, "saga compensated", o.attrs(state)...)
+	return nil
+}
+
+// save persists state if nobody changed it since it was loaded, errVersionChange otherwise
+func (o *Orchestrator) save(ctx context.Context, state *State) error {
+	state.UpdatedAt = time.Now()
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal saga state: %w", err)
+	}
+
+	ok, err := o.store.Update(ctx, state.ID, state.version, raw, state.Deadline, state.Status.Done())
+	if err != nil {
+		return fmt.Errorf("failed to save saga: %w", err)
+	}
+	if !ok {
+		return errVersionChange
+	}
+	state.version++
+	return nil
+}
+
+func (o *Orchestrator) load(ctx context.Context, id string) (*State, error) {
+	raw, version, found, err := o.store.Load(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saga: %w", err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	var state State
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal saga state: %w", err)
+	}
+	state.version = version
+	return &state, nil
+}
+
+func (o *Orchestrator) definition(name string) (Definition, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	def, ok := o.defs[name]
+	if !ok {
+		return Definition{}, fmt.Errorf("%w: %s", ErrUnknownSaga, name)
+	}
+	return def, nil
+}
+
+func (o *Orchestrator) timeout(step Step) time.Duration {
+	if step.Timeout > 0 {
+		return step.Timeout
+	}
+	return o.cfg.StepTimeout
+}
+
+func (o *Orchestrator) attrs(state *State) []any {
+	return []any{"saga_id", state.ID, "saga", state.Saga, "status", state.Status, "step", state.Step}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,157 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// headers correlating commands and replies, participants copy the saga id and step of
+// a command into their reply and set the status
+const (
+	HeaderSagaID      = "x-saga-id"
+	HeaderSagaStep    = "x-saga-step"
+	HeaderReplyStatus = "x-saga-reply-status" // ReplySuccess or ReplyFailure
+	HeaderReplyError  = "x-saga-reply-error"
+
+	ReplySuccess = "success"
+	ReplyFailure = "failure"
+)
+
+var (
+	ErrNotFound      = errors.New("saga not found")
+	ErrExists        = errors.New("saga already exists")
+	ErrUnknownSaga   = errors.New("saga definition not registered")
+	errVersionChange = errors.New("saga state changed concurrently")
+)
+
+type Status string
+
+const (
+	StatusRunning      Status = "running"      // executing steps forward
+	StatusCompensating Status = "compensating" // undoing completed steps in reverse
+	StatusCompleted    Status = "completed"    // all steps succeeded
+	StatusCompensated  Status = "compensated"  // failed and fully compensated
+	StatusFailed       Status = "failed"       // compensation gave up, needs manual intervention
+)
+
+// Done reports whether the saga reached a final status
+func (s Status) Done() bool {
+	return s == StatusCompleted || s == StatusCompensated || s == StatusFailed
+}
+
+// State is the persisted state of one saga instance
+type State struct {
+	ID        string          `json:"id"`
+	Saga      string          `json:"saga"` // definition name
+	Status    Status          `json:"status"`
+	Step      int             `json:"step"`     // index of the step executing or to compensate next
+	Attempts  int             `json:"attempts"` // sends of the current action or compensation
+	Data      json.RawMessage `json:"data,omitempty"`
+	Error     string          `json:"error,omitempty"` // cause of compensation
+	Deadline  time.Time       `json:"deadline"`        // when the current step times out
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	version int64
+}
+
+// Decode unmarshals the saga data into v
+func (s *State) Decode(v any) error {
+	if len(s.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(s.Data, v)
+}
+
+// Encode replaces the saga data with v, it is persisted with the next transition
+func (s *State) Encode(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.Data = data
+	return nil
+}
+
+// CommandHeaders returns the headers to send with the command of the current step,
+// participants echo them in their reply
+func (s *State) CommandHeaders(step string) map[string]string {
+	return map[string]string{HeaderSagaID: s.ID, HeaderSagaStep: step}
+}
+
+// Step is one local transaction of a saga.
+// Action sends a command to a participant (or does local work when Local), the step completes
+// when a success reply for it arrives. Compensate undoes the step, it must be idempotent as
+// it may run more than once and also for steps whose outcome is unknown after a timeout.
+type Step struct {
+	Name       string
+	Action     func(ctx context.Context, s *State) error
+	Compensate func(ctx context.Context, s *State) error // nil when there is nothing to undo
+	OnReply    func(ctx context.Context, s *State, r Reply) error
+	Local      bool          // step completes when Action returns, no reply is awaited
+	Timeout    time.Duration // time to wait for the reply, Cfg.StepTimeout when zero
+	Retries    int           // times Action is sent again after a timeout before compensating
+}
+
+// Definition is a named sequence of steps
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// Reply is a participant answer to a step command
+type Reply struct {
+	SagaID  string
+	Step    string
+	Success bool
+	Error   string
+	Body    []byte
+}
+
+// ParseReply reads a reply from message headers, false when the message is not a saga reply
+func ParseReply(headers map[string]string, body []byte) (Reply, bool) {
+	id, step := headers[HeaderSagaID], headers[HeaderSagaStep]
+	if id == "" || step == "" {
+		return Reply{}, false
+	}
+	return Reply{
+		SagaID:  id,
+		Step:    step,
+		Success: headers[HeaderReplyStatus] != ReplyFailure,
+		Error:   headers[HeaderReplyError],
+		Body:    body,
+	}, true
+}
+
+// ReplyHeaders returns the headers a participant sends back for the command carrying commandHeaders
+func ReplyHeaders(commandHeaders map[string]string, err error) map[string]string {
+	headers := map[string]string{
+		HeaderSagaID:      commandHeaders[HeaderSagaID],
+		HeaderSagaStep:    commandHeaders[HeaderSagaStep],
+		HeaderReplyStatus: ReplySuccess,
+	}
+	if err != nil {
+		headers[HeaderReplyStatus] = ReplyFailure
+		headers[HeaderReplyError] = err.Error()
+	}
+	return headers
+}
+
+// Store persists saga states as opaque data with optimistic concurrency.
+// implemented by storage/postgres and storage/mongodb.
+type Store interface {
+	// Create inserts a saga at version 1, false when id exists
+	Create(ctx context.Context, id string, data []byte, deadline time.Time) (bool, error)
+
+	// Load returns the saga data and version, found is false when it does not exist
+	Load(ctx context.Context, id string) (data []byte, version int64, found bool, err error)
+
+	// Update replaces the saga when it is still at version and increments the version,
+	// false when it was changed concurrently
+	Update(ctx context.Context, id string, version int64, data []byte, deadline time.Time, done bool) (bool, error)
+
+	// Due returns ids of unfinished sagas with deadline at or before now, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]string, error)
+}
@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/msgbroker/logging"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultLease        = 30 * time.Second
+	defaultMaxAttempts  = 10
+)
+
+var ErrNotFound = errors.New("scheduled message not found")
+
+// Message is a message to publish at DueAt
+type Message struct {
+	ID          string            `json:"id"`          // generated when empty, scheduling an existing id replaces it
+	Destination string            `json:"destination"` // kafka topic or amqp routing key
+	Key         string            `json:"key,omitempty"`
+	Body        []byte            `json:"body"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	DueAt       time.Time         `json:"due_at"`
+}
+
+// Store durably holds scheduled messages as opaque data ordered by due time.
+// implemented by storage/postgres, storage/redis and storage/sqlite.
+type Store interface {
+	// Save inserts or replaces the message with id
+	Save(ctx context.Context, id string, dueAt time.Time, data []byte) error
+
+	// Delete removes the message, false when it does not exist
+	Delete(ctx context.Context, id string) (bool, error)
+
+	// DeleteClaimed removes the message only while its due time still is leaseUntil, the now+lease set by
+	// ClaimDue. false when it was deleted, or saved again under the same id, after it was claimed.
+	DeleteClaimed(ctx context.Context, id string, leaseUntil time.Time) (bool, error)
+
+	// ClaimDue returns up to limit messages due at now and moves their due time to now+lease in the same
+	// atomic step, so concurrent instances never claim the same message while the lease runs.
+	// a claimed message that is not deleted before the lease expires is claimed again.
+	// attempts counts the claims of each message including this one, Save resets it.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) (ids []string, data [][]byte, attempts []int, err error)
+}
+
+// Publisher sends a due message through a broker adapter,
+// see kafka.ScheduledPublisher and rabbitmq.ScheduledPublisher
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+type PublisherFunc func(ctx context.Context, m Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, m Message) error { return f(ctx, m) }
+
+// scheduler configuration, zero value uses defaults
+type Cfg struct {
+	PollInterval time.Duration  // how often the store is polled for due messages, default 1s
+	BatchSize    int            // max messages claimed per poll, default 100
+	Lease        time.Duration  // time to publish a claimed message before another instance may claim it, default 30s
+	MaxAttempts  int            // publish attempts before a message is dead-lettered, default 10
+	DeadLetter   Publisher      // receives messages that failed MaxAttempts times, they are only logged and deleted when nil
+	Logger       logging.Logger // slog.Default when nil
+}
+
+// Scheduler publishes messages at a later time. any number of instances can Run on the same store,
+// dispatch is at least once: a message is deleted only after it was published, an instance crashing
+// in between leaves it to be claimed again once the lease expired.
+// consumers can deduplicate on the message id header set by the publishers.
+type Scheduler struct {
+	store     Store
+	publisher Publisher
+	cfg       Cfg
+}
+
+func New(store Store, publisher Publisher, cfg Cfg) *Scheduler {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaultLease
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	cfg.Logger = logging.OrDefault(cfg.Logger)
+	return &Scheduler{store: store, publisher: publisher, cfg: cfg}
+}
+
+// Schedule stores m for publishing at m.DueAt and returns its id
+func (s *Scheduler) Schedule(ctx context.Context, m Message) (string, error) {
+	if m.Destination == "" {
+		return "", errors.New("scheduled message destination cannot be empty")
+	}
+	if m.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate message id: %w", err)
+		}
+		m.ID = id
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal scheduled message: %w", err)
+	}
+	if err := s.store.Save(ctx, m.ID, m.DueAt, data); err != nil {
+		return "", fmt.Errorf("failed to save scheduled message: %w", err)
+	}
+	return m.ID, nil
+}
+
+// ScheduleAfter stores m for publishing after delay
+func (s *Scheduler) ScheduleAfter(ctx context.Context, m Message, delay time.Duration) (string, error) {
+	m.DueAt = time.Now().Add(delay)
+	return s.Schedule(ctx, m)
+}
+
+// Cancel removes a scheduled message, ErrNotFound when it was already published or never existed.
+// a message claimed by a running dispatch at the same time may still be published.
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	ok, err := s.store.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Run dispatches due messages until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain backlog without waiting for the next tick
+		for {
+			n, err := s.dispatchDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				s.cfg.Logger.ErrorContext(ctx, "failed to dispatch scheduled messages", logging.Err(err))
+			}
+			if err != nil || n < s.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue claims one batch of due messages and publishes them, returns the batch size
+func (s *Scheduler) dispatchDue(ctx context.Context) (int, error) {
+	// whole milliseconds, so leaseUntil matches the due time every store keeps
+	now := time.Now().Truncate(time.Millisecond)
+	leaseUntil := now.Add(s.cfg.Lease)
+
+	ids, data, attempts, err := s.store.ClaimDue(ctx, now, s.cfg.Lease, s.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+
+	for i, id := range ids {
+		var m Message
+		if err := json.Unmarshal(data[i], &m); err != nil {
+			// never publishable, drop it instead of claiming it forever
+			s.cfg.Logger.ErrorContext(ctx, "invalid scheduled message, deleted", "id", id, logging.Err(err))
+			s.deleteClaimed(ctx, id, leaseUntil)
+			continue
+		}
+
+		if err := s.publisher.Publish(ctx, m); err != nil {
+			if attempts[i] >= s.cfg.MaxAttempts {
+				s.deadLetter(ctx, m, leaseUntil, attempts[i], err)
+				continue
+			}
+			// publish failures are retried when the lease expires
+			s.cfg.Logger.ErrorContext(ctx, "failed to publish scheduled message",
+				"id", id, "destination", m.Destination, "attempts", attempts[i], "retry_in", s.cfg.Lease, logging.Err(err))
+			continue
+		}
+
+		if !s.deleteClaimed(ctx, id, leaseUntil) {
+			continue
+		}
+		s.cfg.Logger.DebugContext(ctx, "scheduled message published",
+			"id", id, "destination", m.Destination, "delay", time.Since(m.DueAt))
+	}
+	return len(ids), nil
+}
+
+// deadLetter hands a message that failed its last attempt to Cfg.DeadLetter and deletes it.
+// it stays scheduled when the dead letter publish fails, so it is tried again after the lease.
+func (s *Scheduler) deadLetter(ctx context.Context, m Message, leaseUntil time.Time, attempts int, cause error) {
+	if s.cfg.DeadLetter != nil {
+		if err := s.cfg.DeadLetter.Publish(ctx, m); err != nil {
+			s.cfg.Logger.ErrorContext(ctx, "failed to dead-letter scheduled message",
+				"id", m.ID, "destination", m.Destination, "attempts", attempts, logging.Err(err))
+			return
+		}
+	}
+
+	s.cfg.Logger.ErrorContext(ctx, "scheduled message dead-lettered after max attempts",
+		"id", m.ID, "destination", m.Destination, "attempts", attempts, "dead_letter", s.cfg.DeadLetter != nil, logging.Err(cause))
+	s.deleteClaimed(ctx, m.ID, leaseUntil)
+}
+
+// deleteClaimed removes a message dispatched under the lease ending at leaseUntil, false when it was kept
+func (s *Scheduler) deleteClaimed(ctx context.Context, id string, leaseUntil time.Time) bool {
+	ok, err := s.store.DeleteClaimed(ctx, id, leaseUntil)
+	if err != nil {
+		// it will be dispatched again after the lease
+		s.cfg.Logger.ErrorContext(ctx, "failed to delete dispatched message", "id", id, logging.Err(err))
+		return false
+	}
+	if !ok {
+		// rescheduled or cancelled while it was dispatched, the new version stays
+		s.cfg.Logger.DebugContext(ctx, "scheduled message changed during dispatch, kept", "id", id)
+	}
+	return ok
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
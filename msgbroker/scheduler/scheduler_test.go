@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a Store in memory, due times are kept as unix milliseconds like the real stores
+type memStore struct {
+	mu       sync.Mutex
+	due      map[string]int64
+	data     map[string][]byte
+	attempts map[string]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{due: map[string]int64{}, data: map[string][]byte{}, attempts: map[string]int{}}
+}
+
+func (s *memStore) Save(ctx context.Context, id string, dueAt time.Time, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.due[id], s.data[id], s.attempts[id] = dueAt.UnixMilli(), data, 0
+	return nil
+}
+
+func (s *memStore) Delete(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.due[id]
+	delete(s.due, id)
+	delete(s.data, id)
+	delete(s.attempts, id)
+	return ok, nil
+}
+
+func (s *memStore) DeleteClaimed(ctx context.Context, id string, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	due, ok := s.due[id]
+	s.mu.Unlock()
+	if !ok || due != leaseUntil.UnixMilli() {
+		return false, nil
+	}
+	return s.Delete(ctx, id)
+}
+
+func (s *memStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, [][]byte, []int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		ids      []string
+		data     [][]byte
+		attempts []int
+	)
+	for id, due := range s.due {
+		if due > now.UnixMilli() || len(ids) == limit {
+			continue
+		}
+		s.due[id] = now.Add(lease).UnixMilli()
+		s.attempts[id]++
+		ids = append(ids, id)
+		data = append(data, s.data[id])
+		attempts = append(attempts, s.attempts[id])
+	}
+	return ids, data, attempts, nil
+}
+
+// expire makes every claimed message due again
+func (s *memStore) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.due {
+		s.due[id] = 0
+	}
+}
+
+func TestDispatchDeletesPublished(t *testing.T) {
+	store := newMemStore()
+	var published []Message
+	s := New(store, PublisherFunc(func(ctx context.Context, m Message) error {
+		published = append(published, m)
+		return nil
+	}), Cfg{})
+
+	ctx := context.Background()
+	id, err := s.ScheduleAfter(ctx, Message{Destination: "orders", Body: []byte("x")}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dispatchDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ID != id {
+		t.Fatalf("published %+v", published)
+	}
+	if len(store.due) != 0 {
+		t.Fatal("published message not deleted")
+	}
+}
+
+func TestDispatchDeadLettersAfterMaxAttempts(t *testing.T) {
+	store := newMemStore()
+	var dead []Message
+	s := New(store, PublisherFunc(func(ctx context.Context, m Message) error {
+		return errors.New("broker down")
+	}), Cfg{
+		MaxAttempts: 3,
+		DeadLetter: PublisherFunc(func(ctx context.Context, m Message) error {
+			dead = append(dead, m)
+			return nil
+		}),
+	})
+
+	ctx := context.Background()
+	if _, err := s.ScheduleAfter(ctx, Message{Destination: "orders"}, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := s.dispatchDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		store.expire()
+
+		if i < 3 && (len(dead) != 0 || len(store.due) != 1) {
+			t.Fatalf("attempt %d: dead-lettered too early", i)
+		}
+	}
+	if len(dead) != 1 || dead[0].Destination != "orders" {
+		t.Fatalf("dead letters %+v", dead)
+	}
+	if len(store.due) != 0 {
+		t.Fatal("dead-lettered message not deleted")
+	}
+}
+
+func TestDispatchKeepsMessageRescheduledDuringPublish(t *testing.T) {
+	store := newMemStore()
+	ctx := context.Background()
+	var s *Scheduler
+	s = New(store, PublisherFunc(func(ctx context.Context, m Message) error {
+		// replaced under the same id while this version is published
+		m.DueAt = time.Now().Add(time.Hour)
+		_, err := s.Schedule(ctx, m)
+		return err
+	}), Cfg{})
+
+	id, err := s.ScheduleAfter(ctx, Message{Destination: "orders"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dispatchDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.due[id]; !ok {
+		t.Fatal("rescheduled message deleted")
+	}
+}
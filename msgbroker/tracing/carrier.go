@@ -0,0 +1,53 @@
+package tracing
+
+import "go.opentelemetry.io/otel/propagation"
+
+var (
+	_ propagation.TextMapCarrier = HeaderCarrier(nil)
+	_ propagation.TextMapCarrier = TableCarrier(nil)
+)
+
+// HeaderCarrier adapts string header maps to propagation.TextMapCarrier
+type HeaderCarrier map[string]string
+
+func (c HeaderCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// TableCarrier adapts amqp headers (amqp.Table) to propagation.TextMapCarrier
+type TableCarrier map[string]interface{}
+
+func (c TableCarrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+func (c TableCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c TableCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
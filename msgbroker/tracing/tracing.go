@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/lzf-12/go-example-collections/msgbroker"
+
+// W3C trace context (traceparent, tracestate) and baggage are always used for message headers,
+// independent of the global propagator which defaults to no-op.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// spans are created from the global tracer provider, set it with otel.SetTracerProvider.
+// tests can install an sdk provider backed by tracetest.NewInMemoryExporter.
+func tracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// StartProducerSpan starts a send span for destination and injects its context into carrier.
+// system is a semconv messaging system attribute, e.g. semconv.MessagingSystemKafka.
+func StartProducerSpan(
+	ctx context.Context,
+	system attribute.KeyValue,
+	destination string,
+	carrier propagation.TextMapCarrier,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+
+	attrs = append(attrs,
+		system,
+		semconv.MessagingDestinationName(destination),
+		semconv.MessagingOperationTypeSend,
+		semconv.MessagingOperationName("send"),
+	)
+
+	ctx, span := tracer().Start(ctx, fmt.Sprintf("send %s", destination),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+
+	propagator.Inject(ctx, carrier)
+	return ctx, span
+}
+
+// StartConsumerSpan extracts the producer context from carrier and starts a process span as its child
+func StartConsumerSpan(
+	ctx context.Context,
+	system attribute.KeyValue,
+	destination string,
+	carrier propagation.TextMapCarrier,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+
+	attrs = append(attrs,
+		system,
+		semconv.MessagingDestinationName(destination),
+		semconv.MessagingOperationTypeProcess,
+		semconv.MessagingOperationName("process"),
+	)
+
+	ctx = propagator.Extract(ctx, carrier)
+	return tracer().Start(ctx, fmt.Sprintf("process %s", destination),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// End records err (if any) on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
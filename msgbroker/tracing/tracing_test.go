@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newExporter installs a tracer provider recording ended spans in memory
+func newExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+func attrValue(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestProducerConsumerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		carrier func() propagation.TextMapCarrier
+	}{
+		{"string headers", func() propagation.TextMapCarrier { return HeaderCarrier{} }},
+		{"amqp table", func() propagation.TextMapCarrier { return TableCarrier{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := newExporter(t)
+			carrier := tt.carrier()
+
+			_, producer := StartProducerSpan(context.Background(), semconv.MessagingSystemRabbitmq, "orders", carrier,
+				semconv.MessagingMessageBodySize(3))
+			if carrier.Get("traceparent") == "" {
+				t.Fatal("traceparent not injected")
+			}
+			End(producer, nil)
+
+			// the consumer starts from a fresh context, only the carrier links it to the producer
+			_, consumer := StartConsumerSpan(context.Background(), semconv.MessagingSystemRabbitmq, "orders", carrier)
+			End(consumer, nil)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want 2", len(spans))
+			}
+			send, process := spans[0], spans[1]
+
+			if send.SpanKind != trace.SpanKindProducer || process.SpanKind != trace.SpanKindConsumer {
+				t.Fatalf("got kinds %v, %v", send.SpanKind, process.SpanKind)
+			}
+			if send.Name != "send orders" || process.Name != "process orders" {
+				t.Fatalf("got names %q, %q", send.Name, process.Name)
+			}
+			if process.Parent.SpanID() != send.SpanContext.SpanID() || process.SpanContext.TraceID() != send.SpanContext.TraceID() {
+				t.Fatal("consumer span is not a child of the producer span")
+			}
+			if !process.Parent.IsRemote() {
+				t.Fatal("consumer parent should be remote")
+			}
+
+			want := []struct {
+				span  tracetest.SpanStub
+				key   attribute.Key
+				value string
+			}{
+				{send, semconv.MessagingSystemKey, "rabbitmq"},
+				{send, semconv.MessagingDestinationNameKey, "orders"},
+				{send, semconv.MessagingOperationTypeKey, "send"},
+				{send, semconv.MessagingOperationNameKey, "send"},
+				{process, semconv.MessagingSystemKey, "rabbitmq"},
+				{process, semconv.MessagingDestinationNameKey, "orders"},
+				{process, semconv.MessagingOperationTypeKey, "process"},
+				{process, semconv.MessagingOperationNameKey, "process"},
+			}
+			for _, w := range want {
+				v, ok := attrValue(w.span.Attributes, w.key)
+				if !ok || v.Emit() != w.value {
+					t.Errorf("%s: %s = %q, want %q", w.span.Name, w.key, v.Emit(), w.value)
+				}
+			}
+			if v, ok := attrValue(send.Attributes, semconv.MessagingMessageBodySizeKey); !ok || v.AsInt64() != 3 {
+				t.Errorf("body size = %v", v.Emit())
+			}
+		})
+	}
+}
+
+func TestConsumerWithoutTraceContext(t *testing.T) {
+	exporter := newExporter(t)
+
+	_, span := StartConsumerSpan(context.Background(), semconv.MessagingSystemKafka, "orders", HeaderCarrier{})
+	End(span, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Parent.IsValid() {
+		t.Fatal("expected a root consumer span")
+	}
+}
+
+func TestEndRecordsError(t *testing.T) {
+	exporter := newExporter(t)
+
+	_, span := StartConsumerSpan(context.Background(), semconv.MessagingSystemKafka, "orders", HeaderCarrier{})
+	End(span, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error || spans[0].Status.Description != "boom" {
+		t.Fatalf("got status %+v", spans[0].Status)
+	}
+	if len(spans[0].Events) == 0 {
+		t.Fatal("error event not recorded")
+	}
+}
+
+func TestTableCarrierGet(t *testing.T) {
+	c := TableCarrier{"s": "a", "b": []byte("b"), "n": 1}
+	if c.Get("s") != "a" || c.Get("b") != "b" || c.Get("n") != "" || c.Get("missing") != "" {
+		t.Fatalf("unexpected values %v", c)
+	}
+}
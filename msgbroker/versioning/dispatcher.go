@@ -0,0 +1,66 @@
+package versioning
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Dispatcher decodes incoming payloads, upcasts them to the latest version and calls the handler of the event type.
+// handlers only ever see the latest version regardless of which version arrived on the wire.
+type Dispatcher struct {
+	registry *Registry
+	decode   Decoder
+
+	mu       sync.RWMutex
+	handlers map[string]func(context.Context, any) error
+}
+
+func NewDispatcher(registry *Registry, decode Decoder) *Dispatcher {
+	return &Dispatcher{
+		registry: registry,
+		decode:   decode,
+		handlers: make(map[string]func(context.Context, any) error),
+	}
+}
+
+// Handle registers handler for eventType, it receives the latest version value returned by upcasters
+func (d *Dispatcher) Handle(eventType string, handler func(context.Context, any) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[eventType] = handler
+}
+
+// HandleFunc registers a typed handler for eventType.
+// T must match the type produced by the latest version factory (or the last upcaster).
+func HandleFunc[T any](d *Dispatcher, eventType string, handler func(context.Context, T) error) {
+	d.Handle(eventType, func(ctx context.Context, v any) error {
+		typed, ok := v.(T)
+		if !ok {
+			return fmt.Errorf("unexpected %s payload type %T", eventType, v)
+		}
+		return handler(ctx, typed)
+	})
+}
+
+// Dispatch decodes payload as meta, upcasts it and calls the registered handler
+func (d *Dispatcher) Dispatch(ctx context.Context, meta Meta, payload []byte) error {
+	d.mu.RLock()
+	handler, ok := d.handlers[meta.Type]
+	d.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, meta.Type)
+	}
+
+	v, err := d.registry.Decode(meta, payload, d.decode)
+	if err != nil {
+		return err
+	}
+
+	return handler(ctx, v)
+}
+
+// DispatchHeaders resolves event meta from headers (see MetaFromHeaders) and dispatches payload
+func (d *Dispatcher) DispatchHeaders(ctx context.Context, headers map[string]string, payload []byte, fallback Meta) error {
+	return d.Dispatch(ctx, MetaFromHeaders(headers, fallback), payload)
+}
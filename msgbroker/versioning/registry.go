@@ -0,0 +1,130 @@
+package versioning
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Upcaster transforms a decoded event from version N into version N+1
+type Upcaster func(from any) (any, error)
+
+// Decoder unmarshals raw payload into v, e.g. json.Unmarshal or xml.Unmarshal
+type Decoder func(data []byte, v any) error
+
+type eventSchema struct {
+	factories map[int]func() any // version -> new empty value (pointer) to decode into
+	upcasters map[int]Upcaster   // from version -> upcaster to version+1
+	latest    int
+}
+
+// Registry keeps known versions of each event type and the upcasters chaining them
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*eventSchema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: make(map[string]*eventSchema),
+	}
+}
+
+// RegisterVersion registers a version of eventType, newFn must return a pointer to decode into
+func (r *Registry) RegisterVersion(eventType string, version int, newFn func() any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.schema(eventType)
+	s.factories[version] = newFn
+	if version > s.latest {
+		s.latest = version
+	}
+}
+
+// RegisterUpcaster registers the transform from version `from` to `from+1` of eventType
+func (r *Registry) RegisterUpcaster(eventType string, from int, up Upcaster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.schema(eventType).upcasters[from] = up
+}
+
+// Latest returns the latest registered version of eventType
+func (r *Registry) Latest(eventType string) (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.schemas[eventType]
+	if !ok || s.latest == 0 {
+		return 0, false
+	}
+	return s.latest, true
+}
+
+// Decode decodes payload as meta.Version of meta.Type and upcasts it to the latest version
+func (r *Registry) Decode(meta Meta, payload []byte, decode Decoder) (any, error) {
+	r.mu.RLock()
+	s, ok := r.schemas[meta.Type]
+	var newFn func() any
+	if ok {
+		newFn = s.factories[meta.Version]
+	}
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, meta.Type)
+	}
+	if newFn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventVersion, meta)
+	}
+
+	v := newFn()
+	if err := decode(payload, v); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", meta, err)
+	}
+
+	return r.Upcast(meta, v)
+}
+
+// Upcast applies upcasters starting at meta.Version until the latest version of meta.Type is reached
+func (r *Registry) Upcast(meta Meta, v any) (any, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.schemas[meta.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, meta.Type)
+	}
+
+	if meta.Version > s.latest {
+		return nil, fmt.Errorf("%w: %s is newer than latest v%d", ErrUnknownEventVersion, meta, s.latest)
+	}
+
+	for version := meta.Version; version < s.latest; version++ {
+		up, ok := s.upcasters[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s/v%d -> v%d", ErrMissingUpcaster, meta.Type, version, version+1)
+		}
+
+		next, err := up(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upcast %s/v%d -> v%d: %w", meta.Type, version, version+1, err)
+		}
+		v = next
+	}
+
+	return v, nil
+}
+
+// schema must be called with write lock held
+func (r *Registry) schema(eventType string) *eventSchema {
+	s, ok := r.schemas[eventType]
+	if !ok {
+		s = &eventSchema{
+			factories: make(map[int]func() any),
+			upcasters: make(map[int]Upcaster),
+		}
+		r.schemas[eventType] = s
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// header convention for versioned events, shared by every broker adapter.
+// producers set both headers, consumers fall back to a per topic default when absent.
+const (
+	HeaderEventType    = "x-event-type"
+	HeaderEventVersion = "x-event-version"
+)
+
+var (
+	ErrUnknownEventType    = errors.New("unknown event type")
+	ErrUnknownEventVersion = errors.New("unknown event version")
+	ErrMissingUpcaster     = errors.New("missing upcaster")
+	ErrNoHandler           = errors.New("no handler registered for event type")
+)
+
+// Meta identifies the type and schema version of an event payload
+type Meta struct {
+	Type    string
+	Version int
+}
+
+func (m Meta) String() string {
+	return fmt.Sprintf("%s/v%d", m.Type, m.Version)
+}
+
+// MetaFromHeaders reads event type and version headers, any missing or invalid value is taken from fallback
+func MetaFromHeaders(headers map[string]string, fallback Meta) Meta {
+	meta := fallback
+
+	if t, ok := headers[HeaderEventType]; ok && t != "" {
+		meta.Type = t
+	}
+
+	if v, ok := headers[HeaderEventVersion]; ok {
+		if version, err := strconv.Atoi(v); err == nil && version > 0 {
+			meta.Version = version
+		}
+	}
+
+	return meta
+}
+
+// SetHeaders writes event type and version into headers, allocating the map if nil
+func SetHeaders(headers map[string]string, meta Meta) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string, 2)
+	}
+	headers[HeaderEventType] = meta.Type
+	headers[HeaderEventVersion] = strconv.Itoa(meta.Version)
+	return headers
+}
+
+// StringHeaders converts amqp style headers (map[string]interface{}) into string headers
+func StringHeaders(headers map[string]interface{}) map[string]string {
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		switch val := v.(type) {
+		case string:
+			out[k] = val
+		case []byte:
+			out[k] = string(val)
+		default:
+			out[k] = fmt.Sprint(val)
+		}
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package versioning
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+)
+
+type userV1 struct {
+	Name string `json:"name" xml:"name"`
+}
+
+type userV2 struct {
+	First string `json:"first" xml:"first"`
+	Last  string `json:"last" xml:"last"`
+}
+
+type userV3 struct {
+	First  string `json:"first" xml:"first"`
+	Last   string `json:"last" xml:"last"`
+	Active bool   `json:"active" xml:"active"`
+}
+
+const eventUser = "user.created"
+
+func newUserRegistry() *Registry {
+	reg := NewRegistry()
+	reg.RegisterVersion(eventUser, 1, func() any { return &userV1{} })
+	reg.RegisterVersion(eventUser, 2, func() any { return &userV2{} })
+	reg.RegisterVersion(eventUser, 3, func() any { return &userV3{} })
+	reg.RegisterUpcaster(eventUser, 1, func(from any) (any, error) {
+		v1 := from.(*userV1)
+		return &userV2{First: v1.Name, Last: "-"}, nil
+	})
+	reg.RegisterUpcaster(eventUser, 2, func(from any) (any, error) {
+		v2 := from.(*userV2)
+		return &userV3{First: v2.First, Last: v2.Last, Active: true}, nil
+	})
+	return reg
+}
+
+func TestMetaFromHeaders(t *testing.T) {
+	fallback := Meta{Type: "default", Version: 1}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    Meta
+	}{
+		{"both headers", map[string]string{HeaderEventType: "t", HeaderEventVersion: "3"}, Meta{"t", 3}},
+		{"missing headers", nil, fallback},
+		{"missing version", map[string]string{HeaderEventType: "t"}, Meta{"t", 1}},
+		{"empty type", map[string]string{HeaderEventType: "", HeaderEventVersion: "2"}, Meta{"default", 2}},
+		{"invalid version", map[string]string{HeaderEventVersion: "v2"}, fallback},
+		{"zero version", map[string]string{HeaderEventVersion: "0"}, fallback},
+		{"negative version", map[string]string{HeaderEventVersion: "-1"}, fallback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MetaFromHeaders(tt.headers, fallback); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetHeadersRoundTrip(t *testing.T) {
+	meta := Meta{Type: eventUser, Version: 2}
+	headers := SetHeaders(nil, meta)
+	if got := MetaFromHeaders(headers, Meta{}); got != meta {
+		t.Fatalf("got %v, want %v", got, meta)
+	}
+}
+
+func TestRegistryDecodeChain(t *testing.T) {
+	reg := newUserRegistry()
+
+	tests := []struct {
+		name    string
+		meta    Meta
+		payload string
+		want    userV3
+		wantErr error
+	}{
+		{"v1 upcast twice", Meta{eventUser, 1}, `{"name":"ada"}`, userV3{First: "ada", Last: "-", Active: true}, nil},
+		{"v2 upcast once", Meta{eventUser, 2}, `{"first":"ada","last":"l"}`, userV3{First: "ada", Last: "l", Active: true}, nil},
+		{"v3 as is", Meta{eventUser, 3}, `{"first":"ada","last":"l"}`, userV3{First: "ada", Last: "l"}, nil},
+		{"unknown type", Meta{"other", 1}, `{}`, userV3{}, ErrUnknownEventType},
+		{"unknown version", Meta{eventUser, 4}, `{}`, userV3{}, ErrUnknownEventVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reg.Decode(tt.meta, []byte(tt.payload), json.Unmarshal)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			v3, ok := got.(*userV3)
+			if !ok {
+				t.Fatalf("got %T, want *userV3", got)
+			}
+			if *v3 != tt.want {
+				t.Fatalf("got %+v, want %+v", *v3, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryMissingUpcaster(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterVersion(eventUser, 1, func() any { return &userV1{} })
+	reg.RegisterVersion(eventUser, 2, func() any { return &userV2{} })
+
+	_, err := reg.Decode(Meta{eventUser, 1}, []byte(`{"name":"ada"}`), json.Unmarshal)
+	if !errors.Is(err, ErrMissingUpcaster) {
+		t.Fatalf("got %v, want ErrMissingUpcaster", err)
+	}
+}
+
+func TestRegistryUpcasterError(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterVersion(eventUser, 1, func() any { return &userV1{} })
+	reg.RegisterVersion(eventUser, 2, func() any { return &userV2{} })
+	boom := errors.New("boom")
+	reg.RegisterUpcaster(eventUser, 1, func(any) (any, error) { return nil, boom })
+
+	if _, err := reg.Decode(Meta{eventUser, 1}, []byte(`{}`), json.Unmarshal); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	reg := newUserRegistry()
+	fallback := Meta{Type: eventUser, Version: 1}
+
+	tests := []struct {
+		name    string
+		decode  Decoder
+		headers map[string]string
+		payload string
+		want    userV3
+		wantErr error
+	}{
+		{"json v1", json.Unmarshal, SetHeaders(nil, Meta{eventUser, 1}), `{"name":"ada"}`, userV3{"ada", "-", true}, nil},
+		{"json v2", json.Unmarshal, SetHeaders(nil, Meta{eventUser, 2}), `{"first":"ada","last":"l"}`, userV3{"ada", "l", true}, nil},
+		{"xml v1", xml.Unmarshal, SetHeaders(nil, Meta{eventUser, 1}), `<user><name>ada</name></user>`, userV3{"ada", "-", true}, nil},
+		{"xml v2", xml.Unmarshal, SetHeaders(nil, Meta{eventUser, 2}), `<user><first>ada</first><last>l</last></user>`, userV3{"ada", "l", true}, nil},
+		{"missing headers use fallback", json.Unmarshal, nil, `{"name":"ada"}`, userV3{"ada", "-", true}, nil},
+		{"unknown version", json.Unmarshal, map[string]string{HeaderEventVersion: "9"}, `{}`, userV3{}, ErrUnknownEventVersion},
+		{"unknown type", json.Unmarshal, map[string]string{HeaderEventType: "other"}, `{}`, userV3{}, ErrNoHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *userV3
+			d := NewDispatcher(reg, tt.decode)
+			HandleFunc(d, eventUser, func(_ context.Context, v *userV3) error {
+				got = v
+				return nil
+			})
+
+			err := d.DispatchHeaders(context.Background(), tt.headers, []byte(tt.payload), fallback)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				if got != nil {
+					t.Fatal("handler called on error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || *got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherHandlerTypeMismatch(t *testing.T) {
+	d := NewDispatcher(newUserRegistry(), json.Unmarshal)
+	HandleFunc(d, eventUser, func(context.Context, *userV1) error { return nil })
+
+	if err := d.Dispatch(context.Background(), Meta{eventUser, 3}, []byte(`{}`)); err == nil {
+		t.Fatal("expected type mismatch error")
+	}
+}
+
+func TestDispatcherDecodeError(t *testing.T) {
+	d := NewDispatcher(newUserRegistry(), json.Unmarshal)
+	HandleFunc(d, eventUser, func(context.Context, *userV3) error { return nil })
+
+	if err := d.Dispatch(context.Background(), Meta{eventUser, 1}, []byte(`{`)); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestStringHeaders(t *testing.T) {
+	got := StringHeaders(map[string]interface{}{"a": "x", "b": []byte("y"), "c": 3})
+	want := map[string]string{"a": "x", "b": "y", "c": "3"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
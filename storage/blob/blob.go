@@ -0,0 +1,12 @@
+package blob
+
+// ErrNotFound is wrapped by blob store Get errors for unknown keys.
+// its NotFound method lets msgbroker payload match it as payload.ErrBlobNotFound without importing this package.
+var ErrNotFound error = notFoundError{}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "blob not found" }
+
+// NotFound reports that the key is unknown to the store
+func (notFoundError) NotFound() bool { return true }
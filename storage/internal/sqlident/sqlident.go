@@ -0,0 +1,11 @@
+package sqlident
+
+import "regexp"
+
+var identifierRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Valid reports whether name is safe to interpolate into sql as a table, column or index name,
+// identifiers cannot be bound as query parameters
+func Valid(name string) bool {
+	return identifierRe.MatchString(name)
+}
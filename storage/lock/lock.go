@@ -0,0 +1,113 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+var (
+	ErrNotAcquired = errors.New("lock held by another owner")
+	ErrLockLost    = errors.New("lock lost")
+)
+
+const (
+	defaultRetryInterval = 5 * time.Second
+	unlockTimeout        = 5 * time.Second
+)
+
+// Locker hands out named distributed locks, implemented by postgres.AdvisoryLocker and redis.Locker
+type Locker interface {
+	// TryLock acquires name without waiting, ErrNotAcquired when it is held elsewhere.
+	// the lock is kept alive in the background until Unlock or until it is lost.
+	TryLock(ctx context.Context, name string) (Lock, error)
+}
+
+// Lock is a held lock
+type Lock interface {
+	// Context is cancelled when the lock is released or lost, context.Cause returns ErrLockLost
+	// for the latter. work protected by the lock should run under it.
+	Context() context.Context
+
+	// Unlock releases the lock, calling it more than once is a no-op
+	Unlock(ctx context.Context) error
+}
+
+// Acquire waits for name, trying every retryInterval until ctx is cancelled
+func Acquire(ctx context.Context, l Locker, name string, retryInterval time.Duration) (Lock, error) {
+	if retryInterval <= 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	for {
+		lk, err := l.TryLock(ctx, name)
+		if !errors.Is(err, ErrNotAcquired) {
+			return lk, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// ElectionCfg configures Lead, zero value uses defaults
+type ElectionCfg struct {
+	RetryInterval time.Duration  // wait between campaigns while another instance leads, default 5s
+	Logger        logging.Logger // slog.Default when nil
+}
+
+// Lead campaigns for leadership of name until ctx is cancelled, e.g. to run a singleton job on one of
+// many instances. while leader fn runs with a context that is cancelled when leadership is lost;
+// when fn returns leadership is released and the instance campaigns again.
+func Lead(ctx context.Context, l Locker, name string, cfg ElectionCfg, fn func(ctx context.Context) error) error {
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	logger := logging.OrDefault(cfg.Logger)
+
+	for {
+		lk, err := Acquire(ctx, l, name, cfg.RetryInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.ErrorContext(ctx, "leader campaign failed", "election", name, logging.Err(err))
+		} else {
+			logger.InfoContext(ctx, "elected leader", "election", name)
+			lead(ctx, lk, name, logger, fn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cfg.RetryInterval):
+		}
+	}
+}
+
+// lead runs fn as leader and releases leadership afterwards
+func lead(ctx context.Context, lk Lock, name string, logger logging.Logger, fn func(ctx context.Context) error) {
+	leaderCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(lk.Context(), func() { cancel(context.Cause(lk.Context())) })
+	defer stop()
+
+	if err := fn(leaderCtx); err != nil && leaderCtx.Err() == nil {
+		logger.ErrorContext(ctx, "leader task failed", "election", name, logging.Err(err))
+	}
+	if errors.Is(context.Cause(leaderCtx), ErrLockLost) {
+		logger.WarnContext(ctx, "leadership lost", "election", name)
+	}
+
+	// a fresh context, ctx may be cancelled already
+	unlockCtx, cancelUnlock := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+	defer cancelUnlock()
+	if err := lk.Unlock(unlockCtx); err != nil {
+		logger.ErrorContext(ctx, "failed to release leadership", "election", name, logging.Err(err))
+	}
+}
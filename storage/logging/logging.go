@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger is the structured logger used by storage clients, *slog.Logger satisfies it.
+// it has the same method set as msgbroker/logging.Logger so one logger can be shared by both.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	WarnContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
+}
+
+// common field keys
+const (
+	KeyStorage = "storage"
+	KeyError   = "error"
+)
+
+// OrDefault returns l, or slog.Default when l is nil
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// Err is a shorthand for the error field
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
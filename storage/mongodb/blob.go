@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lzf-12/go-example-collections/storage/blob"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlobStore keeps binary blobs in a GridFS bucket, keyed by caller chosen string ids.
+// it satisfies msgbroker payload.BlobStore for claim-check payloads, Get of an unknown key wraps blob.ErrNotFound.
+type BlobStore struct {
+	m      *Mongo
+	db     string
+	bucket string
+}
+
+// NewBlobStore returns a store on GridFS bucket in db, "fs" when bucket is empty
+func (m *Mongo) NewBlobStore(db, bucket string) *BlobStore {
+	if bucket == "" {
+		bucket = options.DefaultName
+	}
+	return &BlobStore{m: m, db: db, bucket: bucket}
+}
+
+// gridfs.Bucket deadlines are per instance, a bucket per call keeps ctx deadlines isolated
+func (s *BlobStore) open(ctx context.Context, write bool) (*gridfs.Bucket, error) {
+	b, err := gridfs.NewBucket(s.m.client.Database(s.db), options.GridFSBucket().SetName(s.bucket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gridfs bucket: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if write {
+			err = b.SetWriteDeadline(deadline)
+		} else {
+			err = b.SetReadDeadline(deadline)
+		}
+	}
+	return b, err
+}
+
+func (s *BlobStore) Put(ctx context.Context, key string, data []byte) error {
+	b, err := s.open(ctx, true)
+	if err != nil {
+		return err
+	}
+	if err := b.UploadFromStreamWithID(key, key, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.open(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := b.DownloadToStream(key, &buf); err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, fmt.Errorf("failed to get blob %s: %w", key, blob.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to download blob %s: %w", key, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *BlobStore) Delete(ctx context.Context, key string) error {
+	b, err := s.open(ctx, true)
+	if err != nil {
+		return err
+	}
+	if err := b.DeleteContext(ctx, key); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
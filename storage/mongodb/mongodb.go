@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/lzf-12/go-example-collections/storage/logging"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -14,6 +15,7 @@ import (
 // Mongo wraps a *mongo.Client and exposes a few quality-of-life helpers.
 type Mongo struct {
 	client *mongo.Client
+	logger logging.Logger
 }
 
 // Default connection-pool & timeout parameters.
@@ -74,14 +76,24 @@ func NewMongo(
 func (m *Mongo) Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultPingTimeout)
 	defer cancel()
-	return m.client.Ping(ctx, readpref.Primary())
+	if err := m.client.Ping(ctx, readpref.Primary()); err != nil {
+		m.log().WarnContext(ctx, "mongo ping failed", logging.KeyStorage, "mongodb", logging.Err(err))
+		return err
+	}
+	return nil
 }
 
+// SetLogger sets the structured logger, slog.Default is used when not set
+func (m *Mongo) SetLogger(l logging.Logger) { m.logger = l }
+
+func (m *Mongo) log() logging.Logger { return logging.OrDefault(m.logger) }
+
 // IsReady() alias for Ping()
 func (m *Mongo) IsReady() error { return m.Ping() }
 
 // Disconnect() closes every pooled connection.
 func (m *Mongo) Disconnect(ctx context.Context) error {
+	m.log().InfoContext(ctx, "disconnecting mongo client", logging.KeyStorage, "mongodb")
 	return m.client.Disconnect(ctx)
 }
 
@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SagaStore persists saga states with optimistic concurrency on a version field,
+// it satisfies msgbroker saga.Store
+type SagaStore struct {
+	coll *mongo.Collection
+}
+
+type sagaDoc struct {
+	ID        string    `bson:"_id"`
+	State     []byte    `bson:"state"`
+	Version   int64     `bson:"version"`
+	Deadline  time.Time `bson:"deadline"`
+	Done      bool      `bson:"done"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// NewSagaStore returns a store on collection coll of db, see CreateIndexes
+func (m *Mongo) NewSagaStore(db, coll string) *SagaStore {
+	return &SagaStore{coll: m.Collection(db, coll)}
+}
+
+// CreateIndexes creates the index used for timeout lookups
+func (s *SagaStore) CreateIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "done", Value: 1}, {Key: "deadline", Value: 1}},
+		Options: options.Index().SetName("done_deadline"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create saga index: %w", err)
+	}
+	return nil
+}
+
+func (s *SagaStore) Create(ctx context.Context, id string, data []byte, deadline time.Time) (bool, error) {
+	now := time.Now()
+	_, err := s.coll.InsertOne(ctx, sagaDoc{ID: id, State: data, Version: 1, Deadline: deadline, CreatedAt: now, UpdatedAt: now})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create saga: %w", err)
+	}
+	return true, nil
+}
+
+func (s *SagaStore) Load(ctx context.Context, id string) ([]byte, int64, bool, error) {
+	var doc sagaDoc
+	err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to load saga: %w", err)
+	}
+	return doc.State, doc.Version, true, nil
+}
+
+func (s *SagaStore) Update(ctx context.Context, id string, version int64, data []byte, deadline time.Time, done bool) (bool, error) {
+	res, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "version": version},
+		bson.M{
+			"$set": bson.M{"state": data, "deadline": deadline, "done": done, "updated_at": time.Now()},
+			"$inc": bson.M{"version": 1},
+		})
+	if err != nil {
+		return false, fmt.Errorf("failed to update saga: %w", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *SagaStore) Due(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	cur, err := s.coll.Find(ctx,
+		bson.M{"done": false, "deadline": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "deadline", Value: 1}}).SetLimit(int64(limit)).SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due sagas: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var ids []string
+	for cur.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode saga id: %w", err)
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cur.Err()
+}
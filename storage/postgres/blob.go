@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lzf-12/go-example-collections/storage/blob"
+)
+
+// BlobStore keeps binary blobs in a bytea table, keyed by caller chosen string ids.
+// it satisfies msgbroker payload.BlobStore for claim-check payloads, Get of an unknown key wraps blob.ErrNotFound.
+// created_at allows expiring old blobs with a periodic delete.
+type BlobStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewBlobStore returns a store on table, see CreateTable
+func (p *Postgres) NewBlobStore(table string) (*BlobStore, error) {
+	if !ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &BlobStore{db: p.db, table: table}, nil
+}
+
+// CreateTable creates the blob table if it does not exist
+func (s *BlobStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		key        TEXT PRIMARY KEY,
+		data       BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create blob table: %w", err)
+	}
+	return nil
+}
+
+func (s *BlobStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (key, data) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data`, s.table),
+		key, data)
+	if err != nil {
+		return fmt.Errorf("failed to put blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT data FROM %s WHERE key = $1`, s.table), key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get blob %s: %w", key, blob.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *BlobStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, s.table), key); err != nil {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
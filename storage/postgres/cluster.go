@@ -0,0 +1,326 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+// Balancer picks the replica serving a read
+type Balancer string
+
+const (
+	BalanceRoundRobin Balancer = "round-robin"
+	BalanceLeastConn  Balancer = "least-conn" // fewest in-use connections
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	healthCheckTimeout         = 2 * time.Second
+)
+
+// ClusterCfg configures NewCluster
+type ClusterCfg struct {
+	Primary             *Postgres
+	Replicas            []*Postgres
+	Balancer            Balancer      // default round-robin
+	HealthCheckInterval time.Duration // how often failed replicas are checked for recovery, default 5s
+	Logger              logging.Logger
+}
+
+// Cluster routes writes to the primary and read-only queries to healthy replicas.
+// a replica failing with a connection error is taken out of rotation until its health check passes
+// and the query is retried on another replica or the primary. it satisfies Querier, so Select, Get
+// and the named helpers route automatically.
+type Cluster struct {
+	primary  *Postgres
+	replicas []*replica
+	balancer Balancer
+	logger   logging.Logger
+
+	next   atomic.Uint64
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type replica struct {
+	pg      *Postgres
+	healthy atomic.Bool
+	probe   atomic.Bool // recovered recently, single-row reads ping it first
+}
+
+var _ Querier = (*Cluster)(nil)
+
+func NewCluster(cfg ClusterCfg) (*Cluster, error) {
+	if cfg.Primary == nil {
+		return nil, errors.New("cluster primary cannot be nil")
+	}
+	switch cfg.Balancer {
+	case "":
+		cfg.Balancer = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceLeastConn:
+	default:
+		return nil, fmt.Errorf("unknown balancer %q", cfg.Balancer)
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	c := &Cluster{primary: cfg.Primary, balancer: cfg.Balancer, logger: logging.OrDefault(cfg.Logger)}
+	for _, pg := range cfg.Replicas {
+		r := &replica{pg: pg}
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, r)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	if len(c.replicas) > 0 {
+		c.wg.Add(1)
+		go c.healthLoop(ctx, cfg.HealthCheckInterval)
+	}
+	return c, nil
+}
+
+// Primary returns the primary, for writes and reads that must see them
+func (c *Cluster) Primary() *Postgres {
+	return c.primary
+}
+
+// Reader returns the database a read in ctx goes to: a healthy replica, or the primary when ctx is
+// pinned (see WithPrimary and WithReadYourWrites) or no replica is healthy
+func (c *Cluster) Reader(ctx context.Context) *Postgres {
+	if r := c.pick(ctx, nil); r != nil {
+		return r.pg
+	}
+	return c.primary
+}
+
+// WithTx runs fn in a transaction on the primary, see Postgres.WithTx
+func (c *Cluster) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	markWrite(ctx)
+	return c.primary.WithTx(ctx, fn)
+}
+
+// ExecContext runs on the primary and pins later reads of a WithReadYourWrites ctx to it
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	markWrite(ctx)
+	return c.primary.db.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs read-only queries (SELECT, SHOW, EXPLAIN without locking clauses, INTO or writing
+// built-in functions) on a replica, anything else on the primary
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if !isReadOnly(query) {
+		markWrite(ctx)
+		return c.primary.db.QueryContext(ctx, query, args...)
+	}
+
+	var tried []*replica
+	for {
+		r := c.pick(ctx, tried)
+		if r == nil {
+			return c.primary.db.QueryContext(ctx, query, args...)
+		}
+		rows, err := r.pg.db.QueryContext(ctx, query, args...)
+		if err == nil || !c.replicaFailed(ctx, r, err) {
+			return rows, err
+		}
+		tried = append(tried, r)
+	}
+}
+
+// QueryRowContext is QueryContext for a single row. the error surfaces on Scan, so a replica that recently
+// came back into rotation is pinged first, others fail the query and are taken out for the next reads.
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if !isReadOnly(query) {
+		markWrite(ctx)
+		return c.primary.db.QueryRowContext(ctx, query, args...)
+	}
+
+	var tried []*replica
+	for {
+		r := c.pick(ctx, tried)
+		if r == nil {
+			return c.primary.db.QueryRowContext(ctx, query, args...)
+		}
+		if r.probe.Load() {
+			if err := r.pg.db.PingContext(ctx); err != nil && c.replicaFailed(ctx, r, err) {
+				tried = append(tried, r)
+				continue
+			}
+			r.probe.Store(false)
+		}
+
+		row := r.pg.db.QueryRowContext(ctx, query, args...)
+		if err := row.Err(); err != nil && c.replicaFailed(ctx, r, err) {
+			tried = append(tried, r)
+			continue
+		}
+		return row
+	}
+}
+
+// Close stops health checks, it does not close the member databases
+func (c *Cluster) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// pick returns a healthy replica not in skip, nil when reads must go to the primary
+func (c *Cluster) pick(ctx context.Context, skip []*replica) *replica {
+	if pinned(ctx) {
+		return nil
+	}
+
+	var candidates []*replica
+	for _, r := range c.replicas {
+		if r.healthy.Load() && !containsReplica(skip, r) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if c.balancer == BalanceLeastConn {
+		best := candidates[0]
+		bestInUse := best.pg.Stats().InUseConns
+		for _, r := range candidates[1:] {
+			if inUse := r.pg.Stats().InUseConns; inUse < bestInUse {
+				best, bestInUse = r, inUse
+			}
+		}
+		return best
+	}
+	return candidates[c.next.Add(1)%uint64(len(candidates))]
+}
+
+// replicaFailed takes r out of rotation when err is a connection failure rather than a query or client error,
+// true when the query should be retried elsewhere
+func (c *Cluster) replicaFailed(ctx context.Context, r *replica, err error) bool {
+	if ctx.Err() != nil || !isConnError(err) {
+		return false
+	}
+	if r.healthy.CompareAndSwap(true, false) {
+		c.logger.WarnContext(ctx, "postgres replica unhealthy, removed from rotation", logging.KeyStorage, "postgres", logging.Err(err))
+	}
+	return true
+}
+
+// healthLoop puts recovered replicas back into rotation
+func (c *Cluster) healthLoop(ctx context.Context, interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range c.replicas {
+			if r.healthy.Load() {
+				continue
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			err := r.pg.IsReadyContext(checkCtx)
+			cancel()
+			if err == nil {
+				r.probe.Store(true)
+				r.healthy.Store(true)
+				c.logger.InfoContext(ctx, "postgres replica healthy again, back in rotation", logging.KeyStorage, "postgres")
+			}
+		}
+	}
+}
+
+// isConnError reports whether err means the connection or server is unusable, as opposed to a server side
+// query error (with a SQLSTATE) or a client error such as a failed argument conversion
+func isConnError(err error) bool {
+	if SQLState(err) != "" {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return pgconn.SafeToRetry(err)
+}
+
+func containsReplica(list []*replica, r *replica) bool {
+	for _, x := range list {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	readStatement = regexp.MustCompile(`^(select|show|explain)\b`)
+	// locking clauses, SELECT ... INTO (creates a table) and built-in functions that write or need the session of a write
+	writeClause = regexp.MustCompile(`\bfor\s+(update|no\s+key\s+update|share|key\s+share)\b|\binto\b|` +
+		`\b(nextval|setval|currval|lastval|txid_current|pg_current_xact_id)\s*\(`)
+)
+
+// isReadOnly reports whether query can run on a replica. user-defined functions that write cannot be told
+// apart from reads, queries calling them must use WithPrimary
+func isReadOnly(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if !readStatement.MatchString(q) {
+		return false
+	}
+	// explain analyze executes the statement
+	if strings.HasPrefix(q, "explain") && strings.Contains(q, "analyze") {
+		return false
+	}
+	return !writeClause.MatchString(q)
+}
+
+type pinKey struct{}
+
+// pin routes reads of a context to the primary, forced or after a write when readYourWrites
+type pin struct {
+	forced bool
+	wrote  atomic.Bool
+}
+
+// WithPrimary routes every read made with the returned context to the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinKey{}, &pin{forced: true})
+}
+
+// WithReadYourWrites routes reads made with the returned context to the primary once a write was made
+// through the cluster with it, e.g. for the rest of a request that created a record it then reads back
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinKey{}, &pin{})
+}
+
+func pinned(ctx context.Context) bool {
+	p, ok := ctx.Value(pinKey{}).(*pin)
+	return ok && (p.forced || p.wrote.Load())
+}
+
+func markWrite(ctx context.Context) {
+	if p, ok := ctx.Value(pinKey{}).(*pin); ok {
+		p.wrote.Store(true)
+	}
+}
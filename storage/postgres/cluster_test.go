@@ -0,0 +1,38 @@
+package postgres
+
+import "testing"
+
+func TestIsReadOnly(t *testing.T) {
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM users WHERE id = $1", true},
+		{"  select 1", true},
+		{"SHOW server_version", true},
+		{"EXPLAIN SELECT * FROM users", true},
+		{"SELECT * FROM orders WHERE note = $1 -- for a user", true},
+		{"SELECT information FROM t", true},
+		{"SELECT * FROM t WHERE nextval_col = 1", true},
+
+		{"EXPLAIN ANALYZE SELECT * FROM users", false},
+		{"SELECT * FROM users FOR UPDATE", false},
+		{"SELECT * FROM users\nFOR UPDATE", false},
+		{"SELECT * FROM users\tfor\tshare", false},
+		{"SELECT * FROM users FOR NO KEY UPDATE SKIP LOCKED", false},
+		{"SELECT * FROM users FOR  KEY\nSHARE", false},
+		{"SELECT * INTO archive FROM users", false},
+		{"SELECT nextval('orders_id_seq')", false},
+		{"SELECT setval ('orders_id_seq', 10)", false},
+		{"SELECT txid_current()", false},
+		{"selectx FROM t", false},
+		{"INSERT INTO users (name) VALUES ($1)", false},
+		{"WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", false},
+		{"UPDATE users SET name = $1", false},
+	}
+	for _, c := range cases {
+		if got := isReadOnly(c.query); got != c.want {
+			t.Errorf("isReadOnly(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/logging"
+	"github.com/lzf-12/go-example-collections/storage/postgres"
+)
+
+// expected versions with special meaning for Append
+const (
+	AnyVersion int64 = -1 // no concurrency check
+	NoStream   int64 = 0  // the stream must not exist yet
+)
+
+// appendLockKey is the transaction advisory lock serializing appends, so global positions
+// become visible in order and subscriptions never skip an event committed late
+const appendLockKey = 0x65767473 // "evts"
+
+var (
+	ErrConcurrency = errors.New("stream version does not match expected version")
+	ErrEmptyAppend = errors.New("no events to append")
+)
+
+// EventData is an event to append
+type EventData struct {
+	Type     string
+	Data     []byte
+	Metadata map[string]string
+}
+
+// Event is a stored event
+type Event struct {
+	Position  int64             `json:"position"` // global position, ordered across all streams
+	StreamID  string            `json:"stream_id"`
+	Version   int64             `json:"version"` // position in the stream, starting at 1
+	Type      string            `json:"type"`
+	Data      []byte            `json:"data"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Store is an append only event store in the tables <prefix>_streams, <prefix>_events,
+// <prefix>_snapshots and <prefix>_checkpoints, see CreateTables
+type Store struct {
+	db          *sql.DB
+	logger      logging.Logger
+	streams     string
+	events      string
+	snapshots   string
+	checkpoints string
+}
+
+func New(p *postgres.Postgres, prefix string) (*Store, error) {
+	if !postgres.ValidIdentifier(prefix) {
+		return nil, fmt.Errorf("invalid table prefix %q", prefix)
+	}
+	return &Store{
+		db:          p.DB(),
+		logger:      p.Logger(),
+		streams:     prefix + "_streams",
+		events:      prefix + "_events",
+		snapshots:   prefix + "_snapshots",
+		checkpoints: prefix + "_checkpoints",
+	}, nil
+}
+
+// CreateTables creates the event store tables if they do not exist
+func (s *Store) CreateTables(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			stream_id TEXT PRIMARY KEY,
+			version   BIGINT NOT NULL
+		)`, s.streams),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			position   BIGSERIAL PRIMARY KEY,
+			stream_id  TEXT NOT NULL,
+			version    BIGINT NOT NULL,
+			type       TEXT NOT NULL,
+			data       BYTEA NOT NULL,
+			metadata   JSONB,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			UNIQUE (stream_id, version)
+		)`, s.events),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			stream_id  TEXT PRIMARY KEY,
+			version    BIGINT NOT NULL,
+			data       BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, s.snapshots),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			name       TEXT PRIMARY KEY,
+			position   BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, s.checkpoints),
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create event store tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// Append adds events to the end of stream and returns the new stream version.
+// expectedVersion is the version the caller based its decision on, ErrConcurrency when the stream moved on;
+// NoStream requires a new stream, AnyVersion skips the check.
+func (s *Store) Append(ctx context.Context, streamID string, expectedVersion int64, events ...EventData) (int64, error) {
+	if len(events) == 0 {
+		return 0, ErrEmptyAppend
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin append: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, appendLockKey); err != nil {
+		return 0, fmt.Errorf("failed to lock event store: %w", err)
+	}
+
+	n := int64(len(events))
+	var version int64
+	switch expectedVersion {
+	case AnyVersion:
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s (stream_id, version) VALUES ($1, $2)
+			ON CONFLICT (stream_id) DO UPDATE SET version = %s.version + EXCLUDED.version
+			RETURNING version`, s.streams, s.streams), streamID, n).Scan(&version)
+	case NoStream:
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s (stream_id, version) VALUES ($1, $2)
+			ON CONFLICT (stream_id) DO NOTHING
+			RETURNING version`, s.streams), streamID, n).Scan(&version)
+	default:
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(`UPDATE %s SET version = version + $3
+			WHERE stream_id = $1 AND version = $2
+			RETURNING version`, s.streams), streamID, expectedVersion, n).Scan(&version)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrConcurrency
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update stream version: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO %s (stream_id, version, type, data, metadata)
+		VALUES ($1, $2, $3, $4, $5)`, s.events))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare append: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, e := range events {
+		metadata, err := marshalMetadata(e.Metadata)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.ExecContext(ctx, streamID, version-n+int64(i)+1, e.Type, e.Data, metadata); err != nil {
+			return 0, fmt.Errorf("failed to append event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit append: %w", err)
+	}
+	return version, nil
+}
+
+// StreamVersion returns the current version of stream, 0 when it does not exist
+func (s *Store) StreamVersion(ctx context.Context, streamID string) (int64, error) {
+	var version int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT version FROM %s WHERE stream_id = $1`, s.streams), streamID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read stream version: %w", err)
+	}
+	return version, nil
+}
+
+// ReadStream returns up to limit events of stream from version onwards, oldest first
+func (s *Store) ReadStream(ctx context.Context, streamID string, fromVersion int64, limit int) ([]Event, error) {
+	return s.query(ctx, fmt.Sprintf(`SELECT position, stream_id, version, type, data, metadata, created_at FROM %s
+		WHERE stream_id = $1 AND version >= $2 ORDER BY version LIMIT $3`, s.events), streamID, fromVersion, limit)
+}
+
+// ReadStreamBackward returns up to limit events of stream from version down, newest first.
+// fromVersion AnyVersion starts at the end of the stream.
+func (s *Store) ReadStreamBackward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]Event, error) {
+	if fromVersion == AnyVersion {
+		return s.query(ctx, fmt.Sprintf(`SELECT position, stream_id, version, type, data, metadata, created_at FROM %s
+			WHERE stream_id = $1 ORDER BY version DESC LIMIT $2`, s.events), streamID, limit)
+	}
+	return s.query(ctx, fmt.Sprintf(`SELECT position, stream_id, version, type, data, metadata, created_at FROM %s
+		WHERE stream_id = $1 AND version <= $2 ORDER BY version DESC LIMIT $3`, s.events), streamID, fromVersion, limit)
+}
+
+// ReadAll returns up to limit events of all streams after global position, in append order
+func (s *Store) ReadAll(ctx context.Context, afterPosition int64, limit int) ([]Event, error) {
+	return s.query(ctx, fmt.Sprintf(`SELECT position, stream_id, version, type, data, metadata, created_at FROM %s
+		WHERE position > $1 ORDER BY position LIMIT $2`, s.events), afterPosition, limit)
+}
+
+// SaveSnapshot stores the state of stream at version, replacing an older snapshot
+func (s *Store) SaveSnapshot(ctx context.Context, streamID string, version int64, data []byte) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (stream_id, version, data) VALUES ($1, $2, $3)
+		ON CONFLICT (stream_id) DO UPDATE SET version = EXCLUDED.version, data = EXCLUDED.data, created_at = now()
+		WHERE %s.version < EXCLUDED.version`, s.snapshots, s.snapshots), streamID, version, data)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot of stream and its version, continue with ReadStream(version+1).
+// found is false when there is none.
+func (s *Store) LoadSnapshot(ctx context.Context, streamID string) (data []byte, version int64, found bool, err error) {
+	err = s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT data, version FROM %s WHERE stream_id = $1`, s.snapshots), streamID).
+		Scan(&data, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	return data, version, true, nil
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...any) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var (
+			e        Event
+			metadata []byte
+		)
+		if err := rows.Scan(&e.Position, &e.StreamID, &e.Version, &e.Type, &e.Data, &metadata, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal event metadata: %w", err)
+			}
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return events, nil
+}
+
+// marshalMetadata returns nil (SQL NULL) for empty metadata
+func marshalMetadata(metadata map[string]string) (any, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event metadata: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,162 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultMaxBackoff   = time.Minute
+)
+
+// headers of projected events
+const (
+	HeaderEventType     = "x-event-type" // same key msgbroker versioning dispatches on
+	HeaderStreamID      = "x-stream-id"
+	HeaderStreamVersion = "x-stream-version"
+	HeaderPosition      = "x-event-position"
+)
+
+// Handler processes one event of a subscription
+type Handler func(ctx context.Context, e Event) error
+
+// subscription configuration, zero value uses defaults
+type SubscriptionCfg struct {
+	PollInterval time.Duration // wait between polls once caught up, default 1s
+	BatchSize    int           // events read per poll, default 100
+	MaxBackoff   time.Duration // cap of the doubling wait after consecutive failures, default 1m
+}
+
+// Publisher publishes projected events, msgbroker kafka.EventPublisher satisfies it
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, value []byte, headers map[string]string) error
+}
+
+// Subscribe delivers all events in global order to handler, starting after the checkpoint stored under name,
+// and blocks until ctx is cancelled. the checkpoint advances after each handled event, delivery is at least
+// once: a failing event is logged and retried after PollInterval, doubled per consecutive failure up to MaxBackoff.
+// run one instance per name.
+func (s *Store) Subscribe(ctx context.Context, name string, cfg SubscriptionCfg, handler Handler) error {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.MaxBackoff < cfg.PollInterval {
+		cfg.MaxBackoff = max(defaultMaxBackoff, cfg.PollInterval)
+	}
+
+	position, err := s.LoadCheckpoint(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	backoff := cfg.PollInterval
+	for {
+		failed := false
+		events, err := s.ReadAll(ctx, position, cfg.BatchSize)
+		if err != nil {
+			failed = true
+			if ctx.Err() == nil {
+				s.log().ErrorContext(ctx, "subscription read failed", "subscription", name, logging.Err(err))
+			}
+		}
+
+		for _, e := range events {
+			if err := handler(ctx, e); err != nil {
+				failed = true
+				s.log().ErrorContext(ctx, "subscription handler failed",
+					"subscription", name, "position", e.Position, "stream_id", e.StreamID, "retry_in", backoff, logging.Err(err))
+				break
+			}
+			if err := s.SaveCheckpoint(ctx, name, e.Position); err != nil {
+				failed = true
+				s.log().ErrorContext(ctx, "failed to save subscription checkpoint", "subscription", name, logging.Err(err))
+				break
+			}
+			position = e.Position
+		}
+
+		var wait time.Duration
+		switch {
+		case failed:
+			// a poison event must not spin the database, back off until it passes
+			wait = backoff
+			backoff = min(backoff*2, cfg.MaxBackoff)
+		case len(events) < cfg.BatchSize:
+			// caught up
+			wait = cfg.PollInterval
+			backoff = cfg.PollInterval
+		default:
+			backoff = cfg.PollInterval
+		}
+
+		if wait == 0 {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Project publishes every event to topic keyed by stream id, preserving per stream order in partitions.
+// it is a subscription named name, see Subscribe.
+func (s *Store) Project(ctx context.Context, name, topic string, cfg SubscriptionCfg, pub Publisher) error {
+	return s.Subscribe(ctx, name, cfg, func(ctx context.Context, e Event) error {
+		headers := make(map[string]string, len(e.Metadata)+4)
+		for k, v := range e.Metadata {
+			headers[k] = v
+		}
+		headers[HeaderEventType] = e.Type
+		headers[HeaderStreamID] = e.StreamID
+		headers[HeaderStreamVersion] = strconv.FormatInt(e.Version, 10)
+		headers[HeaderPosition] = strconv.FormatInt(e.Position, 10)
+
+		if err := pub.Publish(ctx, topic, e.StreamID, e.Data, headers); err != nil {
+			return fmt.Errorf("failed to publish event: %w", err)
+		}
+		return nil
+	})
+}
+
+// LoadCheckpoint returns the last handled global position of subscription name, 0 when it never ran
+func (s *Store) LoadCheckpoint(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT position FROM %s WHERE name = $1`, s.checkpoints), name).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	return position, nil
+}
+
+// SaveCheckpoint stores the last handled global position of subscription name
+func (s *Store) SaveCheckpoint(ctx context.Context, name string, position int64) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (name, position) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position, updated_at = now()`, s.checkpoints), name, position)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) log() logging.Logger {
+	return logging.OrDefault(s.logger)
+}
@@ -0,0 +1,9 @@
+package postgres
+
+import "github.com/lzf-12/go-example-collections/storage/internal/sqlident"
+
+// ValidIdentifier reports whether name may be used as a table, column or prefix name in generated sql:
+// letters, digits and underscores, not starting with a digit. stores built on this package validate with it.
+func ValidIdentifier(name string) bool {
+	return sqlident.Valid(name)
+}
@@ -0,0 +1,24 @@
+package postgres
+
+import "testing"
+
+func TestValidIdentifier(t *testing.T) {
+	cases := map[string]bool{
+		"events":          true,
+		"_outbox":         true,
+		"order_events_v2": true,
+		"Orders":          true,
+		"":                false,
+		"2events":         false,
+		"events;drop":     false,
+		"public.events":   false,
+		`"events"`:        false,
+		"events ":         false,
+		"évents":          false,
+	}
+	for name, want := range cases {
+		if got := ValidIdentifier(name); got != want {
+			t.Errorf("ValidIdentifier(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
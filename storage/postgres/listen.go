@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+const (
+	listenMinBackoff = 100 * time.Millisecond
+	listenMaxBackoff = 30 * time.Second
+	notificationBuf  = 64
+)
+
+// Notification is a NOTIFY received by Listen
+type Notification struct {
+	Channel string
+	Payload string
+	PID     uint32 // backend process that sent it
+
+	// Reconnected marks the notification sent after the listener reconnected, Channel and Payload are empty.
+	// notifications sent while disconnected are lost, subscribers should resync their state.
+	Reconnected bool
+}
+
+// Listen subscribes to channels on a dedicated connection (outside the pool, for either driver) and
+// delivers notifications until ctx is cancelled, then the returned channel is closed.
+// a dropped connection is re-established with exponential backoff and the channels listened again.
+func (p *Postgres) Listen(ctx context.Context, channels ...string) (<-chan Notification, error) {
+	if len(channels) == 0 {
+		return nil, errors.New("no channels to listen on")
+	}
+
+	// fail fast on bad credentials or channel names, later failures are retried
+	conn, err := p.listenConn(ctx, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Notification, notificationBuf)
+	go p.listenLoop(ctx, conn, channels, out)
+	return out, nil
+}
+
+// Notify sends payload on channel, delivered to listeners when the current transaction (if any) commits
+func (p *Postgres) Notify(ctx context.Context, q Querier, channel, payload string) error {
+	if q == nil {
+		q = p.db
+	}
+	if _, err := q.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, payload); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", channel, err)
+	}
+	return nil
+}
+
+func (p *Postgres) listenConn(ctx context.Context, channels []string) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, p.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect listener: %w", err)
+	}
+	for _, ch := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{ch}.Sanitize()); err != nil {
+			_ = conn.Close(context.Background())
+			return nil, fmt.Errorf("failed to listen on %s: %w", ch, err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *Postgres) listenLoop(ctx context.Context, conn *pgx.Conn, channels []string, out chan<- Notification) {
+	defer close(out)
+	defer func() {
+		if conn != nil {
+			_ = conn.Close(context.Background())
+		}
+	}()
+
+	backoff := listenMinBackoff
+	for {
+		if conn == nil {
+			var err error
+			if conn, err = p.listenConn(ctx, channels); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				p.log().WarnContext(ctx, "postgres listener reconnect failed",
+					logging.KeyStorage, "postgres", "retry_in", backoff, logging.Err(err))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, listenMaxBackoff)
+				continue
+			}
+
+			backoff = listenMinBackoff
+			p.log().InfoContext(ctx, "postgres listener reconnected", logging.KeyStorage, "postgres")
+			select {
+			case out <- Notification{Reconnected: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.log().WarnContext(ctx, "postgres listener connection lost", logging.KeyStorage, "postgres", logging.Err(err))
+			_ = conn.Close(context.Background())
+			conn = nil
+			continue
+		}
+
+		select {
+		case out <- Notification{Channel: n.Channel, Payload: n.Payload, PID: n.PID}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/lock"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+const defaultLockCheckInterval = 5 * time.Second
+
+var _ lock.Locker = (*AdvisoryLocker)(nil)
+
+// AdvisoryLocker hands out locks backed by session advisory locks. each held lock pins one pool
+// connection: the lock lives exactly as long as that session, so a crashed holder releases it
+// as soon as postgres notices the dropped connection.
+type AdvisoryLocker struct {
+	db            *sql.DB
+	checkInterval time.Duration
+	logger        logging.Logger
+}
+
+// NewLocker returns a locker whose locks check their session every checkInterval (default 5s)
+// and report loss through the lock context
+func (p *Postgres) NewLocker(checkInterval time.Duration) *AdvisoryLocker {
+	if checkInterval <= 0 {
+		checkInterval = defaultLockCheckInterval
+	}
+	return &AdvisoryLocker{db: p.db, checkInterval: checkInterval, logger: p.logger}
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context, name string) (lock.Lock, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lock connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, name).Scan(&acquired); err != nil {
+		discardConn(conn)
+		return nil, fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, lock.ErrNotAcquired
+	}
+
+	lctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	lk := &advisoryLock{
+		conn:   conn,
+		name:   name,
+		ctx:    lctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		logger: logging.OrDefault(l.logger),
+	}
+	go lk.keepAlive(l.checkInterval)
+	return lk, nil
+}
+
+type advisoryLock struct {
+	conn   *sql.Conn
+	name   string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	logger logging.Logger
+}
+
+func (a *advisoryLock) Context() context.Context {
+	return a.ctx
+}
+
+// keepAlive checks the session holding the lock, a failed check means the lock may be taken over
+func (a *advisoryLock) keepAlive(interval time.Duration) {
+	defer close(a.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		_, err := a.conn.ExecContext(ctx, `SELECT 1`)
+		cancel()
+		if err != nil {
+			a.logger.WarnContext(a.ctx, "advisory lock session lost", logging.KeyStorage, "postgres", "lock", a.name, logging.Err(err))
+			a.cancel(lock.ErrLockLost)
+			return
+		}
+	}
+}
+
+func (a *advisoryLock) Unlock(ctx context.Context) error {
+	var err error
+	a.once.Do(func() {
+		close(a.stop)
+		<-a.done
+
+		if errors.Is(context.Cause(a.ctx), lock.ErrLockLost) {
+			discardConn(a.conn)
+			return
+		}
+		defer a.cancel(nil)
+
+		var released bool
+		if err = a.conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, a.name).Scan(&released); err != nil {
+			// never return a session that may still hold the lock to the pool
+			discardConn(a.conn)
+			err = fmt.Errorf("failed to release advisory lock: %w", err)
+			return
+		}
+		a.conn.Close()
+	})
+	return err
+}
+
+// discardConn closes the underlying session instead of returning it to the pool
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Named rewrites :name parameters of query to $n placeholders and returns the matching arguments.
+// arg is a map[string]any or a struct (fields named by their db tag or snake_case name).
+// "::" casts, quoted strings and identifiers, $$ bodies and comments are left alone, a name used twice is bound once.
+func Named(query string, arg any) (string, []any, error) {
+	lookup, err := namedLookup(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		out   strings.Builder
+		args  []any
+		bound = make(map[string]int)
+	)
+	out.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// a doubled quote inside closes and reopens, which copies the same bytes
+			end := quotedEnd(query, i+1, query[i:i+1])
+			out.WriteString(query[i:end])
+			i = end - 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := quotedEnd(query, i+2, "\n")
+			out.WriteString(query[i:end])
+			i = end - 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := commentEnd(query, i+2)
+			out.WriteString(query[i:end])
+			i = end - 1
+		case c == '$':
+			// "$" inside an identifier such as col$1 does not start a dollar quote
+			tag, ok := dollarTag(query[i:])
+			if !ok || i > 0 && (isNameChar(query[i-1]) || query[i-1] == '$') {
+				out.WriteByte(c)
+				continue
+			}
+			end := quotedEnd(query, i+len(tag), tag)
+			out.WriteString(query[i:end])
+			i = end - 1
+		case c != ':':
+			out.WriteByte(c)
+		case i+1 < len(query) && query[i+1] == ':':
+			// cast, copy both colons
+			out.WriteString("::")
+			i++
+		default:
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			if j == i+1 {
+				out.WriteByte(c)
+				continue
+			}
+
+			name := query[i+1 : j]
+			n, ok := bound[name]
+			if !ok {
+				v, found := lookup(name)
+				if !found {
+					return "", nil, fmt.Errorf("missing named parameter %q", name)
+				}
+				args = append(args, v)
+				n = len(args)
+				bound[name] = n
+			}
+			out.WriteString("$" + strconv.Itoa(n))
+			i = j - 1
+		}
+	}
+	return out.String(), args, nil
+}
+
+// NamedExec runs a query with :name parameters, see Named
+func NamedExec(ctx context.Context, q Querier, query string, arg any) (sql.Result, error) {
+	query, args, err := Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return q.ExecContext(ctx, query, args...)
+}
+
+// NamedSelect runs a query with :name parameters and scans all rows into T, see Named and Select
+func NamedSelect[T any](ctx context.Context, q Querier, query string, arg any) ([]T, error) {
+	query, args, err := Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return Select[T](ctx, q, query, args...)
+}
+
+// quotedEnd returns the index after the closing quote searched from start, len(query) when it is unterminated
+func quotedEnd(query string, start int, quote string) int {
+	end := strings.Index(query[start:], quote)
+	if end < 0 {
+		return len(query)
+	}
+	return start + end + len(quote)
+}
+
+// commentEnd returns the index after the "*/" closing a block comment opened before start,
+// comments nest as in postgres. len(query) when it is unterminated
+func commentEnd(query string, start int) int {
+	depth := 1
+	for i := start; i+1 < len(query); i++ {
+		switch query[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(query)
+}
+
+// dollarTag returns the opening "$tag$" of a dollar-quoted body at the start of s.
+// the tag cannot start with a digit, so $1 placeholders are not mistaken for one.
+func dollarTag(s string) (string, bool) {
+	j := 1
+	if j < len(s) && isNameChar(s[j]) && (s[j] < '0' || s[j] > '9') {
+		for j < len(s) && isNameChar(s[j]) {
+			j++
+		}
+	}
+	if j < len(s) && s[j] == '$' {
+		return s[:j+1], true
+	}
+	return "", false
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func namedLookup(arg any) (func(name string) (any, bool), error) {
+	if m, ok := arg.(map[string]any); ok {
+		return func(name string) (any, bool) {
+			v, ok := m[name]
+			return v, ok
+		}, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, fmt.Errorf("named argument is a nil pointer")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("named argument must be a map[string]any or a struct, got %T", arg)
+	}
+
+	fields := structFields(v.Type())
+	return func(name string) (any, bool) {
+		index, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+		// a field of a nil embedded struct pointer has no value, it is reported missing
+		f, ok := fieldByIndexNil(v, index)
+		if !ok {
+			return nil, false
+		}
+		return f.Interface(), true
+	}, nil
+}
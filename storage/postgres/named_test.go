@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamed(t *testing.T) {
+	arg := map[string]any{"id": 7, "name": "bob"}
+	cases := []struct {
+		query string
+		want  string
+		args  []any
+	}{
+		{`SELECT * FROM users WHERE id = :id`, `SELECT * FROM users WHERE id = $1`, []any{7}},
+		{`SELECT :id::text, :name, :id`, `SELECT $1::text, $2, $1`, []any{7, "bob"}},
+		{`SELECT ':id', 'it''s :name', :id`, `SELECT ':id', 'it''s :name', $1`, []any{7}},
+		{`SELECT "col:id", "a""b:name" FROM t WHERE id = :id`, `SELECT "col:id", "a""b:name" FROM t WHERE id = $1`, []any{7}},
+		{`DO $$ BEGIN PERFORM :id; END $$; SELECT :name`, `DO $$ BEGIN PERFORM :id; END $$; SELECT $1`, []any{"bob"}},
+		{`SELECT $fn$ :id $$ :name $fn$, :id`, `SELECT $fn$ :id $$ :name $fn$, $1`, []any{7}},
+		{`SELECT col$a$ FROM t WHERE id = :id`, `SELECT col$a$ FROM t WHERE id = $1`, []any{7}},
+		{`SELECT $1, :name`, `SELECT $1, $1`, []any{"bob"}},
+		{"SELECT * FROM users -- user's row\nWHERE id = :id", "SELECT * FROM users -- user's row\nWHERE id = $1", []any{7}},
+		{`SELECT :id -- :name`, `SELECT $1 -- :name`, []any{7}},
+		{`SELECT /* it's :name /* nested :name */ still */ :id`, `SELECT /* it's :name /* nested :name */ still */ $1`, []any{7}},
+		{`SELECT 5-:id, 10/:id`, `SELECT 5-$1, 10/$1`, []any{7}},
+		{`SELECT /* unterminated :id`, `SELECT /* unterminated :id`, nil},
+		{`SELECT 'unterminated :id`, `SELECT 'unterminated :id`, nil},
+		{`SELECT $$ unterminated :id`, `SELECT $$ unterminated :id`, nil},
+	}
+	for _, c := range cases {
+		got, args, err := Named(c.query, arg)
+		if err != nil {
+			t.Errorf("Named(%q): %v", c.query, err)
+			continue
+		}
+		if got != c.want || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("Named(%q) = %q %v, want %q %v", c.query, got, args, c.want, c.args)
+		}
+	}
+}
+
+type namedAudit struct {
+	CreatedBy string
+}
+
+type namedUser struct {
+	*namedAudit
+	ID   int
+	Name string `db:"user_name"`
+}
+
+func TestNamedStruct(t *testing.T) {
+	u := namedUser{namedAudit: &namedAudit{CreatedBy: "admin"}, ID: 1, Name: "bob"}
+	got, args, err := Named(`INSERT INTO users VALUES (:id, :user_name, :created_by)`, &u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `INSERT INTO users VALUES ($1, $2, $3)` || !reflect.DeepEqual(args, []any{1, "bob", "admin"}) {
+		t.Fatalf("got %q %v", got, args)
+	}
+
+	// fields of a nil embedded pointer are missing instead of panicking
+	u.namedAudit = nil
+	if _, _, err := Named(`SELECT :created_by`, u); err == nil {
+		t.Fatal("expected missing parameter error")
+	}
+	if _, _, err := Named(`SELECT :id`, u); err != nil {
+		t.Fatalf("other fields: %v", err)
+	}
+}
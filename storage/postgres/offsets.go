@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// OffsetStore keeps kafka consumer offsets (next offset to consume) per group, topic and partition.
+// it satisfies msgbroker kafka.OffsetStore, StoreOffsetTx lets a handler save its data and offset atomically.
+type OffsetStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewOffsetStore returns a store on table, see CreateTable
+func (p *Postgres) NewOffsetStore(table string) (*OffsetStore, error) {
+	if !ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &OffsetStore{db: p.db, table: table}, nil
+}
+
+// CreateTable creates the offset table if it does not exist
+func (s *OffsetStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		group_id    TEXT NOT NULL,
+		topic       TEXT NOT NULL,
+		partition   INTEGER NOT NULL,
+		next_offset BIGINT NOT NULL,
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (group_id, topic, partition)
+	)`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create offset table: %w", err)
+	}
+	return nil
+}
+
+func (s *OffsetStore) LoadOffset(ctx context.Context, group, topic string, partition int32) (int64, bool, error) {
+	var offset int64
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT next_offset FROM %s WHERE group_id = $1 AND topic = $2 AND partition = $3`, s.table),
+		group, topic, partition).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load offset: %w", err)
+	}
+	return offset, true, nil
+}
+
+func (s *OffsetStore) StoreOffset(ctx context.Context, group, topic string, partition int32, offset int64) error {
+	return s.store(ctx, s.db, group, topic, partition, offset)
+}
+
+// StoreOffsetTx saves the offset within tx, commit it together with the data derived from the message
+func (s *OffsetStore) StoreOffsetTx(ctx context.Context, tx *sql.Tx, group, topic string, partition int32, offset int64) error {
+	return s.store(ctx, tx, group, topic, partition, offset)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *OffsetStore) store(ctx context.Context, db execer, group, topic string, partition int32, offset int64) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (group_id, topic, partition, next_offset)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, topic, partition) DO UPDATE SET next_offset = EXCLUDED.next_offset, updated_at = now()`, s.table),
+		group, topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("failed to store offset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+// Driver selects the client library behind Postgres
+type Driver string
+
+const (
+	DriverPQ  Driver = "pq"  // lib/pq through database/sql, the default
+	DriverPgx Driver = "pgx" // pgx with a pgxpool, database/sql runs on top of the pool
+)
+
+const defaultStatementCacheCapacity = 512
+
+// Cfg configures New, zero values use the NewPostgres defaults
+type Cfg struct {
+	// DSN as postgres:// or postgresql:// URL or keyword/value string ("host=localhost dbname=app sslmode=disable")
+	DSN    string
+	Driver Driver
+
+	MaxOpenConns    int           // default 20, pgx: max pool size
+	MaxIdleConns    int           // default 10, pgx: min pool size kept open
+	ConnMaxLifetime time.Duration // default 1 hour
+	ConnMaxIdleTime time.Duration // pgx only, idle connections above MaxIdleConns are closed after it, default 30m
+
+	// StatementCacheCapacity is the number of prepared statements cached per connection (pgx only), default 512.
+	// negative disables preparing entirely, required behind pgbouncer in transaction pooling mode.
+	StatementCacheCapacity int
+
+	Logger logging.Logger // structured logger, slog.Default when nil
+}
+
+// New connects with cfg.Driver. with DriverPgx every helper of this package (transactions, stores, scanning)
+// keeps working through database/sql while Pool exposes the native pgx API.
+func New(ctx context.Context, cfg Cfg) (*Postgres, error) {
+	if err := validateDSN(cfg.DSN); err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = defaultmaxopen
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultmaxidle
+	}
+	if cfg.ConnMaxLifetime <= 0 {
+		cfg.ConnMaxLifetime = defaultmaxlifetime
+	}
+
+	switch cfg.Driver {
+	case DriverPQ, "":
+		p, err := NewPostgres(cfg.DSN, &cfg.MaxOpenConns, &cfg.MaxIdleConns, &cfg.ConnMaxLifetime)
+		if err != nil {
+			return nil, err
+		}
+		p.logger = cfg.Logger
+		return p, nil
+	case DriverPgx:
+		return newPgx(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unknown postgres driver %q", cfg.Driver)
+	}
+}
+
+func newPgx(ctx context.Context, cfg Cfg) (*Postgres, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN format: %w", err)
+	}
+
+	poolCfg.MaxConns = int32(cfg.MaxOpenConns)
+	poolCfg.MinConns = int32(min(cfg.MaxIdleConns, cfg.MaxOpenConns))
+	poolCfg.MaxConnLifetime = cfg.ConnMaxLifetime
+	if cfg.ConnMaxIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	}
+
+	switch {
+	case cfg.StatementCacheCapacity < 0:
+		poolCfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	case cfg.StatementCacheCapacity > 0:
+		poolCfg.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	default:
+		poolCfg.ConnConfig.StatementCacheCapacity = defaultStatementCacheCapacity
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pgx pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("postgres connection failed: %w", err)
+	}
+
+	return &Postgres{db: stdlib.OpenDBFromPool(pool), pool: pool, dsn: cfg.DSN, logger: cfg.Logger}, nil
+}
+
+// Pool returns the pgx pool, nil unless created with DriverPgx
+func (p *Postgres) Pool() *pgxpool.Pool {
+	return p.pool
+}
+
+// PoolStats is a snapshot of connection pool usage, for either driver
+type PoolStats struct {
+	MaxConns      int           `json:"max_conns"`
+	TotalConns    int           `json:"total_conns"`
+	IdleConns     int           `json:"idle_conns"`
+	InUseConns    int           `json:"in_use_conns"`
+	WaitCount     int64         `json:"wait_count"`    // acquisitions that had to wait for a connection
+	WaitDuration  time.Duration `json:"wait_duration"` // total time spent waiting
+	ClosedMaxIdle int64         `json:"closed_max_idle"`
+	ClosedMaxLife int64         `json:"closed_max_lifetime"`
+}
+
+// Stats returns the current pool statistics
+func (p *Postgres) Stats() PoolStats {
+	if p.pool != nil {
+		s := p.pool.Stat()
+		return PoolStats{
+			MaxConns:      int(s.MaxConns()),
+			TotalConns:    int(s.TotalConns()),
+			IdleConns:     int(s.IdleConns()),
+			InUseConns:    int(s.AcquiredConns()),
+			WaitCount:     s.EmptyAcquireCount(),
+			WaitDuration:  s.AcquireDuration(),
+			ClosedMaxIdle: s.MaxIdleDestroyCount(),
+			ClosedMaxLife: s.MaxLifetimeDestroyCount(),
+		}
+	}
+	return statsFromDB(p.db.Stats())
+}
+
+func statsFromDB(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxConns:      s.MaxOpenConnections,
+		TotalConns:    s.OpenConnections,
+		IdleConns:     s.Idle,
+		InUseConns:    s.InUse,
+		WaitCount:     s.WaitCount,
+		WaitDuration:  s.WaitDuration,
+		ClosedMaxIdle: s.MaxIdleClosed + s.MaxIdleTimeClosed,
+		ClosedMaxLife: s.MaxLifetimeClosed,
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"net/url"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
+	"github.com/lzf-12/go-example-collections/storage/logging"
 )
 
 type Postgres struct {
-	db *sql.DB
+	db     *sql.DB
+	pool   *pgxpool.Pool // set when created with DriverPgx, db then runs on top of it
+	dsn    string
+	logger logging.Logger
 }
 
 const (
@@ -55,37 +60,70 @@ func NewPostgres(dsn string, maxopen, maxidle *int, maxlifetime *time.Duration)
 	db.SetMaxIdleConns(iddleConns)
 	db.SetConnMaxLifetime(lifetimeConns)
 
-	return &Postgres{db: db}, nil
+	return &Postgres{db: db, dsn: dsn}, nil
 }
 
 func (p *Postgres) Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return p.db.PingContext(ctx)
+	return p.PingContext(ctx)
 }
 
-func validateDSN(dsn string) error {
-	parsed, err := url.Parse(dsn)
-	if err != nil {
-		return fmt.Errorf("invalid DSN format: %w", err)
+// PingContext verifies a connection can be established within ctx
+func (p *Postgres) PingContext(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		p.log().WarnContext(ctx, "postgres ping failed", logging.KeyStorage, "postgres", logging.Err(err))
+		return err
 	}
-	if parsed.Scheme != "postgres" {
-		return errors.New("DSN must use postgres scheme")
+	return nil
+}
+
+// SetLogger sets the structured logger, slog.Default is used when not set
+func (p *Postgres) SetLogger(l logging.Logger) {
+	p.logger = l
+}
+
+// Logger returns the structured logger, for packages built on Postgres
+func (p *Postgres) Logger() logging.Logger {
+	return p.log()
+}
+
+func (p *Postgres) log() logging.Logger {
+	return logging.OrDefault(p.logger)
+}
+
+// validateDSN accepts postgres:// and postgresql:// URLs as well as keyword/value DSNs ("host=... dbname=...")
+func validateDSN(dsn string) error {
+	if dsn == "" {
+		return errors.New("DSN cannot be empty")
 	}
-	if parsed.Host == "" {
-		return errors.New("DSN must include host")
+	if _, err := pgconn.ParseConfig(dsn); err != nil {
+		return fmt.Errorf("invalid DSN format: %w", err)
 	}
 	return nil
 }
 
 func (p *Postgres) Close() error {
-	return p.db.Close()
+	p.log().InfoContext(context.Background(), "closing postgres connection pool", logging.KeyStorage, "postgres")
+	err := p.db.Close()
+	if p.pool != nil {
+		p.pool.Close()
+	}
+	return err
 }
 
 func (p *Postgres) IsReady() error {
-	row := p.db.QueryRow("SELECT 1")
+	return p.IsReadyContext(context.Background())
+}
+
+// IsReadyContext runs a trivial query within ctx, unlike a ping it fails when the server accepts
+// connections but cannot execute queries (e.g. still in recovery)
+func (p *Postgres) IsReadyContext(ctx context.Context) error {
 	var dummy int
-	return row.Scan(&dummy)
+	if err := p.db.QueryRowContext(ctx, "SELECT 1").Scan(&dummy); err != nil {
+		return fmt.Errorf("postgres not ready: %w", err)
+	}
+	return nil
 }
 
 func (p *Postgres) DB() *sql.DB {
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SagaStore persists saga states with optimistic concurrency on a version column,
+// it satisfies msgbroker saga.Store. state is kept as JSONB so it can be queried for operations.
+type SagaStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSagaStore returns a store on table, see CreateTable
+func (p *Postgres) NewSagaStore(table string) (*SagaStore, error) {
+	if !ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SagaStore{db: p.db, table: table}, nil
+}
+
+// CreateTable creates the saga table and the index used for timeout lookups if they do not exist
+func (s *SagaStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id         TEXT PRIMARY KEY,
+		state      JSONB NOT NULL,
+		version    BIGINT NOT NULL,
+		deadline   TIMESTAMPTZ NOT NULL,
+		done       BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create saga table: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_deadline_idx ON %s (deadline) WHERE NOT done`, s.table, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create saga index: %w", err)
+	}
+	return nil
+}
+
+func (s *SagaStore) Create(ctx context.Context, id string, data []byte, deadline time.Time) (bool, error) {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, state, version, deadline) VALUES ($1, $2, 1, $3)`, s.table),
+		id, string(data), deadline)
+	if IsUniqueViolation(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create saga: %w", err)
+	}
+	return true, nil
+}
+
+func (s *SagaStore) Load(ctx context.Context, id string) ([]byte, int64, bool, error) {
+	var (
+		data    []byte
+		version int64
+	)
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT state, version FROM %s WHERE id = $1`, s.table), id).Scan(&data, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to load saga: %w", err)
+	}
+	return data, version, true, nil
+}
+
+func (s *SagaStore) Update(ctx context.Context, id string, version int64, data []byte, deadline time.Time, done bool) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET state = $3, version = version + 1, deadline = $4, done = $5, updated_at = now()
+		WHERE id = $1 AND version = $2`, s.table),
+		id, version, string(data), deadline, done)
+	if err != nil {
+		return false, fmt.Errorf("failed to update saga: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update saga: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *SagaStore) Due(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id FROM %s WHERE NOT done AND deadline <= $1 ORDER BY deadline LIMIT $2`, s.table),
+		now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due sagas: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan saga id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
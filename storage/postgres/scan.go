@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	fieldCache  sync.Map // reflect.Type -> map[string][]int
+)
+
+// Select runs query and scans all rows into a slice of T.
+// T is a struct whose fields match columns by db tag or snake_case name (embedded structs included),
+// or a single column type such as int64, string or time.Time.
+func Select[T any](ctx context.Context, q Querier, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ScanAll[T](rows)
+}
+
+// Get runs query and scans the first row into T, sql.ErrNoRows when there is none
+func Get[T any](ctx context.Context, q Querier, query string, args ...any) (T, error) {
+	var zero T
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return zero, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return zero, err
+		}
+		return zero, sql.ErrNoRows
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return zero, err
+	}
+	var v T
+	if err := scanRow(rows, columns, &v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// ScanAll scans and closes rows
+func ScanAll[T any](rows *sql.Rows) ([]T, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []T
+	for rows.Next() {
+		var v T
+		if err := scanRow(rows, columns, &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func scanRow(rows *sql.Rows, columns []string, dest any) error {
+	v := reflect.ValueOf(dest).Elem()
+	if !isStructDest(v.Type()) {
+		if len(columns) != 1 {
+			return fmt.Errorf("cannot scan %d columns into %s", len(columns), v.Type())
+		}
+		return rows.Scan(dest)
+	}
+
+	fields := structFields(v.Type())
+	targets := make([]any, len(columns))
+	for i, col := range columns {
+		index, ok := fields[col]
+		if !ok {
+			return fmt.Errorf("column %q has no matching field in %s", col, v.Type())
+		}
+		targets[i] = fieldByIndexAlloc(v, index).Addr().Interface()
+	}
+	return rows.Scan(targets...)
+}
+
+// isStructDest reports whether t is scanned field by field rather than as one value
+func isStructDest(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(scannerType) {
+		return false
+	}
+	return t.PkgPath() != "time" // time.Time scans as a value
+}
+
+// structFields maps column names to field indexes of struct type t
+func structFields(t reflect.Type) map[string][]int {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+
+			idx := append(append([]int(nil), index...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && isStructDest(ft) {
+				walk(ft, idx)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+
+			name := tag
+			if name == "" {
+				name = snakeCase(f.Name)
+			}
+			// outer fields win over embedded ones
+			if _, exists := fields[name]; !exists || len(idx) < len(fields[name]) {
+				fields[name] = idx
+			}
+		}
+	}
+	walk(t, nil)
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// fieldByIndexAlloc is FieldByIndex allocating nil embedded pointers on the way
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// fieldByIndexNil is v.FieldByIndex without the panic, false when an embedded struct pointer on the way is nil
+func fieldByIndexNil(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// snakeCase converts CreatedAt to created_at and UserID to user_id
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
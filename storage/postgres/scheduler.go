@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SchedulerStore holds scheduled messages until they are due, it satisfies msgbroker scheduler.Store.
+// claims use FOR UPDATE SKIP LOCKED so instances polling concurrently never block on or share rows.
+type SchedulerStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSchedulerStore returns a store on table, see CreateTable
+func (p *Postgres) NewSchedulerStore(table string) (*SchedulerStore, error) {
+	if !ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SchedulerStore{db: p.db, table: table}, nil
+}
+
+// CreateTable creates the scheduled message table and its due time index if they do not exist
+func (s *SchedulerStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id         TEXT PRIMARY KEY,
+		due_at     TIMESTAMPTZ NOT NULL,
+		data       BYTEA NOT NULL,
+		attempts   INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler table: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_due_at_idx ON %s (due_at)`, s.table, s.table))
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler index: %w", err)
+	}
+	return nil
+}
+
+func (s *SchedulerStore) Save(ctx context.Context, id string, dueAt time.Time, data []byte) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, due_at, data) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET due_at = EXCLUDED.due_at, data = EXCLUDED.data, attempts = 0`, s.table),
+		id, dueAt, data)
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled message: %w", err)
+	}
+	return nil
+}
+
+func (s *SchedulerStore) Delete(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, s.table), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteClaimed removes the message only while due_at still is the lease set when it was claimed
+func (s *SchedulerStore) DeleteClaimed(ctx context.Context, id string, leaseUntil time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND due_at = $2`, s.table), id, leaseUntil)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete claimed message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete claimed message: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *SchedulerStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, [][]byte, []int, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`UPDATE %s SET due_at = $2, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM %s WHERE due_at <= $1 ORDER BY due_at LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, data, attempts`, s.table, s.table),
+		now, now.Add(lease), limit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		ids      []string
+		data     [][]byte
+		attempts []int
+	)
+	for rows.Next() {
+		var (
+			id string
+			d  []byte
+			n  int
+		)
+		if err := rows.Scan(&id, &d, &n); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to scan claimed message: %w", err)
+		}
+		ids = append(ids, id)
+		data = append(data, d)
+		attempts = append(attempts, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+	return ids, data, attempts, nil
+}
@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+)
+
+const (
+	defaultTxRetries = 3
+	txRetryBaseDelay = 20 * time.Millisecond
+)
+
+// postgres error codes
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeUniqueViolation      = "23505"
+)
+
+// Querier is implemented by *sql.DB, *sql.Tx and *Tx, so helpers work in and outside transactions
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var (
+	_ Querier = (*sql.DB)(nil)
+	_ Querier = (*Tx)(nil)
+)
+
+// Tx is a transaction started by WithTx, Savepoint nests transactions inside it
+type Tx struct {
+	*sql.Tx
+	conn       *sql.Conn // connection of the tx, gives CopyIn access to the native pgx connection
+	savepoints int
+}
+
+// TxOptions configure WithTxOptions, zero value is a read committed read/write transaction retried 3 times
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	ReadOnly   bool
+	MaxRetries int // runs after a serialization failure or deadlock, -1 disables retries
+}
+
+// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise.
+// fn is run again on serialization failures and deadlocks, so it must not have side effects outside the tx.
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	return p.WithTxOptions(ctx, TxOptions{}, fn)
+}
+
+// WithTxOptions is WithTx with isolation level, read only mode and retry count
+func (p *Postgres) WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx *Tx) error) error {
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := p.runTx(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) || attempt >= retries {
+			return err
+		}
+
+		// jittered backoff so conflicting transactions do not collide again
+		delay := txRetryBaseDelay * time.Duration(1<<attempt)
+		delay += time.Duration(rand.Int63n(int64(delay)))
+		p.log().WarnContext(ctx, "retrying postgres transaction", "attempt", attempt+1, "delay", delay, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p *Postgres) runTx(ctx context.Context, opts TxOptions, fn func(tx *Tx) error) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	sqlTx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	tx := &Tx{Tx: sqlTx, conn: conn}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = sqlTx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := sqlTx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Savepoint runs fn in a nested transaction: on error only the work done by fn is rolled back
+// and the error is returned, the outer transaction stays usable
+func (t *Tx) Savepoint(ctx context.Context, fn func(tx *Tx) error) error {
+	t.savepoints++
+	name := fmt.Sprintf("sp_%d", t.savepoints)
+
+	if _, err := t.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	if err := fn(t); err != nil {
+		if _, rbErr := t.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to rollback to savepoint: %w", rbErr))
+		}
+		return err
+	}
+
+	if _, err := t.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock, the transaction can be run again
+func IsRetryable(err error) bool {
+	code := SQLState(err)
+	return code == codeSerializationFailure || code == codeDeadlockDetected
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	return SQLState(err) == codeUniqueViolation
+}
+
+// SQLState returns the postgres error code of err from either driver, empty when err is not a server error
+func SQLState(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
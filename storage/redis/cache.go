@@ -0,0 +1,334 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/logging"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultNegativeTTL = time.Minute
+	defaultL1TTL       = 10 * time.Second
+	entryHeaderLen     = 17 // flags, load duration ms, expiry unix ms
+	entryNotFound      = 1
+)
+
+// ErrNotFound is returned by a loader for a missing value, it is cached as such (negative caching)
+// and returned by GetOrLoad until it expires
+var ErrNotFound = errors.New("not found")
+
+// Codec serializes cached values
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is the default codec
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// GobCodec is more compact than JSON for Go-only readers
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// CacheCfg configures NewCache, zero value uses defaults
+type CacheCfg struct {
+	Prefix string // keys are stored as "<prefix>:<key>"
+	Codec  Codec  // default JSONCodec
+
+	NegativeTTL time.Duration    // how long a not found result is cached, default 1m, negative disables
+	IsNotFound  func(error) bool // marks loader errors cached as not found, default errors.Is(err, ErrNotFound)
+
+	// EarlyRefreshBeta scales probabilistic early refresh: a hit reloads in the background with a probability
+	// rising towards expiry and with the load duration, so hot keys are refreshed before they expire instead of
+	// all callers missing at once. default 1, higher refreshes earlier, negative disables.
+	EarlyRefreshBeta float64
+
+	// L1Size enables an in-process LRU of that many entries in front of redis. Set and Delete broadcast
+	// invalidations to other instances over pub/sub, L1TTL (default 10s) bounds staleness when one is missed.
+	L1Size int
+	L1TTL  time.Duration
+
+	Logger logging.Logger // defaults to the Redis logger
+}
+
+// Cache is a typed cache-aside layer. concurrent loads of a key are de-duplicated within the process,
+// and redis errors degrade to calling the loader rather than failing.
+type Cache[T any] struct {
+	client *redis.Client
+	cfg    CacheCfg
+	group  singleflight.Group
+	logger logging.Logger
+
+	l1      *lru[T]
+	id      string // tells our own invalidations apart
+	channel string
+	pubsub  *redis.PubSub
+	done    chan struct{}
+}
+
+// NewCache returns a cache of T values, call Close to stop the invalidation subscription of the L1
+func NewCache[T any](r *Redis, cfg CacheCfg) *Cache[T] {
+	if cfg.Codec == nil {
+		cfg.Codec = JSONCodec{}
+	}
+	if cfg.NegativeTTL == 0 {
+		cfg.NegativeTTL = defaultNegativeTTL
+	}
+	if cfg.IsNotFound == nil {
+		cfg.IsNotFound = func(err error) bool { return errors.Is(err, ErrNotFound) }
+	}
+	if cfg.EarlyRefreshBeta == 0 {
+		cfg.EarlyRefreshBeta = 1
+	}
+	if cfg.L1TTL <= 0 {
+		cfg.L1TTL = defaultL1TTL
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = r.logger
+	}
+
+	c := &Cache[T]{client: r.client, cfg: cfg, logger: logging.OrDefault(cfg.Logger)}
+	if cfg.L1Size > 0 {
+		c.l1 = newLRU[T](cfg.L1Size)
+		c.id, _ = newToken()
+		c.channel = cfg.Prefix + ":invalidate"
+		c.pubsub = r.client.Subscribe(context.Background(), c.channel)
+		c.done = make(chan struct{})
+		go c.invalidations()
+	}
+	return c
+}
+
+// GetOrLoad returns the cached value of key or calls loader and caches its result for ttl.
+// a loader error for which IsNotFound holds is cached for NegativeTTL and returned as ErrNotFound.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	if c.l1 != nil {
+		if e, ok := c.l1.get(key); ok {
+			if e.notFound {
+				var zero T
+				return zero, ErrNotFound
+			}
+			return e.value, nil
+		}
+	}
+
+	raw, err := c.client.Get(ctx, c.key(key)).Bytes()
+	switch {
+	case err == nil:
+		v, notFound, expires, delta, decErr := c.decode(raw)
+		if decErr == nil {
+			if c.refreshEarly(expires, delta) {
+				c.refresh(ctx, key, ttl, loader)
+			}
+			c.addL1(key, v, notFound, expires)
+			if notFound {
+				return v, ErrNotFound
+			}
+			return v, nil
+		}
+		c.logger.WarnContext(ctx, "failed to decode cached value, reloading", logging.KeyStorage, "redis", "key", key, logging.Err(decErr))
+	case !errors.Is(err, redis.Nil):
+		c.logger.WarnContext(ctx, "cache read failed, loading directly", logging.KeyStorage, "redis", "key", key, logging.Err(err))
+	}
+
+	// callers stop waiting when ctx ends, the shared load continues for the others
+	ch := c.group.DoChan(key, func() (any, error) {
+		return c.load(context.WithoutCancel(ctx), key, ttl, loader)
+	})
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		v, _ := res.Val.(T)
+		return v, res.Err
+	}
+}
+
+// Set stores v under key for ttl and evicts key from the L1 of other instances
+func (c *Cache[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	if err := c.store(ctx, key, v, false, ttl, 0); err != nil {
+		return err
+	}
+	c.addL1(key, v, false, time.Now().Add(ttl))
+	c.broadcast(ctx, key)
+	return nil
+}
+
+// Delete removes key from redis and from the L1 of every instance
+func (c *Cache[T]) Delete(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, c.key(key)).Err(); err != nil {
+		return fmt.Errorf("failed to delete cache key: %w", err)
+	}
+	if c.l1 != nil {
+		c.l1.remove(key)
+	}
+	c.broadcast(ctx, key)
+	return nil
+}
+
+// Close stops the invalidation subscription
+func (c *Cache[T]) Close() error {
+	if c.pubsub == nil {
+		return nil
+	}
+	err := c.pubsub.Close()
+	<-c.done
+	return err
+}
+
+func (c *Cache[T]) key(key string) string {
+	if c.cfg.Prefix == "" {
+		return key
+	}
+	return c.cfg.Prefix + ":" + key
+}
+
+func (c *Cache[T]) load(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	v, err := loader(ctx)
+	delta := time.Since(start)
+
+	if err != nil {
+		if !c.cfg.IsNotFound(err) {
+			return v, err
+		}
+		var zero T
+		if c.cfg.NegativeTTL > 0 {
+			if err := c.store(ctx, key, zero, true, c.cfg.NegativeTTL, delta); err != nil {
+				c.logger.WarnContext(ctx, "failed to cache not found result", logging.KeyStorage, "redis", "key", key, logging.Err(err))
+			}
+			c.addL1(key, zero, true, time.Now().Add(c.cfg.NegativeTTL))
+		}
+		return zero, ErrNotFound
+	}
+
+	if err := c.store(ctx, key, v, false, ttl, delta); err != nil {
+		c.logger.WarnContext(ctx, "failed to cache loaded value", logging.KeyStorage, "redis", "key", key, logging.Err(err))
+	}
+	c.addL1(key, v, false, time.Now().Add(ttl))
+	return v, nil
+}
+
+// refresh reloads key in the background, skipped while a load of key is running
+func (c *Cache[T]) refresh(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) {
+	c.group.DoChan(key, func() (any, error) {
+		v, err := c.load(context.WithoutCancel(ctx), key, ttl, loader)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			c.logger.WarnContext(ctx, "early cache refresh failed", logging.KeyStorage, "redis", "key", key, logging.Err(err))
+		}
+		return v, err
+	})
+}
+
+// refreshEarly implements XFetch: refresh when now - delta * beta * ln(rand) passes the expiry
+func (c *Cache[T]) refreshEarly(expires time.Time, delta time.Duration) bool {
+	if c.cfg.EarlyRefreshBeta < 0 || delta <= 0 {
+		return false
+	}
+	gap := -float64(delta) * c.cfg.EarlyRefreshBeta * math.Log(1-rand.Float64())
+	return !time.Now().Add(time.Duration(gap)).Before(expires)
+}
+
+func (c *Cache[T]) store(ctx context.Context, key string, v T, notFound bool, ttl time.Duration, delta time.Duration) error {
+	raw, err := c.encode(v, notFound, time.Now().Add(ttl), delta)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.key(key), raw, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write cache key: %w", err)
+	}
+	return nil
+}
+
+// encode prefixes the payload with the header read by early refresh
+func (c *Cache[T]) encode(v T, notFound bool, expires time.Time, delta time.Duration) ([]byte, error) {
+	header := make([]byte, entryHeaderLen)
+	if notFound {
+		header[0] = entryNotFound
+	} else {
+		payload, err := c.cfg.Codec.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cache value: %w", err)
+		}
+		header = append(header, payload...)
+	}
+	binary.BigEndian.PutUint64(header[1:9], uint64(delta.Milliseconds()))
+	binary.BigEndian.PutUint64(header[9:17], uint64(expires.UnixMilli()))
+	return header, nil
+}
+
+func (c *Cache[T]) decode(raw []byte) (v T, notFound bool, expires time.Time, delta time.Duration, err error) {
+	if len(raw) < entryHeaderLen {
+		return v, false, expires, 0, errors.New("cache entry too short")
+	}
+	delta = time.Duration(binary.BigEndian.Uint64(raw[1:9])) * time.Millisecond
+	expires = time.UnixMilli(int64(binary.BigEndian.Uint64(raw[9:17])))
+	if raw[0]&entryNotFound != 0 {
+		return v, true, expires, delta, nil
+	}
+	if err := c.cfg.Codec.Unmarshal(raw[entryHeaderLen:], &v); err != nil {
+		return v, false, expires, delta, err
+	}
+	return v, false, expires, delta, nil
+}
+
+func (c *Cache[T]) addL1(key string, v T, notFound bool, expires time.Time) {
+	if c.l1 == nil {
+		return
+	}
+	if l1Expires := time.Now().Add(c.cfg.L1TTL); l1Expires.Before(expires) {
+		expires = l1Expires
+	}
+	c.l1.add(lruEntry[T]{key: key, value: v, notFound: notFound, expires: expires})
+}
+
+func (c *Cache[T]) broadcast(ctx context.Context, key string) {
+	if c.pubsub == nil {
+		return
+	}
+	if err := c.client.Publish(ctx, c.channel, c.id+" "+key).Err(); err != nil {
+		c.logger.WarnContext(ctx, "failed to broadcast cache invalidation", logging.KeyStorage, "redis", "key", key, logging.Err(err))
+	}
+}
+
+// invalidations evicts keys changed by other instances from the L1
+func (c *Cache[T]) invalidations() {
+	defer close(c.done)
+	for msg := range c.pubsub.Channel() {
+		id, key, ok := strings.Cut(msg.Payload, " ")
+		if !ok {
+			c.l1.purge()
+			continue
+		}
+		if id != c.id {
+			c.l1.remove(key)
+		}
+	}
+}
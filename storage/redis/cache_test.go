@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheNegativeCaching(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	c := NewCache[string](r, CacheCfg{Prefix: "users", NegativeTTL: 30 * time.Second, EarlyRefreshBeta: -1})
+
+	var calls atomic.Int32
+	loader := func(context.Context) (string, error) {
+		calls.Add(1)
+		return "", ErrNotFound
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad(ctx, "42", time.Hour, loader); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v, want ErrNotFound", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	if ttl := m.TTL("users:42"); ttl != 30*time.Second {
+		t.Fatalf("not found cached for %s, want NegativeTTL", ttl)
+	}
+
+	m.FastForward(31 * time.Second)
+	if _, err := c.GetOrLoad(ctx, "42", time.Hour, loader); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("loader called %d times after NegativeTTL, want 2", n)
+	}
+}
+
+func TestCacheCustomNotFound(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	errMissing := errors.New("no rows")
+	c := NewCache[string](r, CacheCfg{IsNotFound: func(err error) bool { return errors.Is(err, errMissing) }})
+
+	if _, err := c.GetOrLoad(ctx, "k", time.Hour, func(context.Context) (string, error) { return "", errMissing }); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	// other loader errors are returned as they are and not cached
+	errDown := errors.New("db down")
+	if _, err := c.GetOrLoad(ctx, "other", time.Hour, func(context.Context) (string, error) { return "", errDown }); !errors.Is(err, errDown) {
+		t.Fatalf("got %v, want the loader error", err)
+	}
+	v, err := c.GetOrLoad(ctx, "other", time.Hour, func(context.Context) (string, error) { return "back", nil })
+	if err != nil || v != "back" {
+		t.Fatalf("got %q %v after a failed load", v, err)
+	}
+}
+
+func TestCacheL1InvalidationAcrossInstances(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	cfg := CacheCfg{Prefix: "users", L1Size: 10, L1TTL: time.Hour, EarlyRefreshBeta: -1}
+	a := NewCache[string](r, cfg)
+	defer a.Close()
+	b := NewCache[string](r, cfg)
+	defer b.Close()
+
+	load := func(v string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) { return v, nil }
+	}
+	if v, err := a.GetOrLoad(ctx, "1", time.Hour, load("alice")); err != nil || v != "alice" {
+		t.Fatalf("got %q %v", v, err)
+	}
+
+	// a serves its L1 without going to redis
+	m.Del("users:1")
+	if v, _ := a.GetOrLoad(ctx, "1", time.Hour, load("reloaded")); v != "alice" {
+		t.Fatalf("got %q, want the L1 value", v)
+	}
+
+	if err := b.Set(ctx, "1", "bob", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		v, _ := a.GetOrLoad(ctx, "1", time.Hour, load("reloaded"))
+		return v == "bob"
+	})
+
+	// b's own write stays in its L1
+	m.Del("users:1")
+	if v, _ := b.GetOrLoad(ctx, "1", time.Hour, load("reloaded")); v != "bob" {
+		t.Fatalf("got %q, want b's L1 value", v)
+	}
+
+	if err := b.Delete(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		v, _ := a.GetOrLoad(ctx, "1", time.Hour, load("carol"))
+		return v == "carol"
+	})
+}
+
+func TestCacheLoadDeduplicated(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	c := NewCache[int](r, CacheCfg{EarlyRefreshBeta: -1})
+
+	const callers = 10
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 7, nil
+	}
+
+	base := m.CommandCount()
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = c.GetOrLoad(ctx, "k", time.Hour, loader)
+		}()
+	}
+
+	// every caller has missed redis before the load finishes
+	waitFor(t, func() bool { return m.CommandCount()-base >= callers })
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	for i, v := range results {
+		if v != 7 {
+			t.Fatalf("caller %d got %d", i, v)
+		}
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/lock"
+	"github.com/lzf-12/go-example-collections/storage/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultLockTTL = 30 * time.Second
+
+// acquireScript sets the lock when free and returns the next fencing token, 0 when held
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// renewScript extends the lock only while it still holds our token
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// unlockScript deletes the lock only while it still holds our token
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+var _ lock.Locker = (*Locker)(nil)
+
+// Locker hands out locks stored as keys with a random owner token and a ttl. a held lock is extended
+// every ttl/3, so a crashed holder releases it at the latest after ttl.
+// lock name is held under the key name and its fencing token counter under "<name>:fence".
+// on redis cluster both keys must share a slot, give name a hash tag such as "{jobs}".
+type Locker struct {
+	client *redis.Client
+	ttl    time.Duration
+	logger logging.Logger
+}
+
+// NewLocker returns a locker whose locks expire ttl (default 30s) after their last extension
+func (r *Redis) NewLocker(ttl time.Duration) *Locker {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &Locker{client: r.client, ttl: ttl, logger: r.logger}
+}
+
+// Lock is a held lock with its fencing token
+type Lock struct {
+	*lease
+	fence int64
+}
+
+// Fence returns the fencing token, increasing with every acquisition of the lock name.
+// storage written under the lock should reject writes carrying a lower token than the last seen,
+// which stops a holder that was paused past its ttl from overwriting its successor.
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+func (l *Locker) TryLock(ctx context.Context, name string) (lock.Lock, error) {
+	lk, err := l.Obtain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return lk, nil
+}
+
+// Obtain is TryLock returning the lock with its fencing token
+func (l *Locker) Obtain(ctx context.Context, name string) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	fence, err := acquireScript.Run(ctx, l.client, []string{name, name + ":fence"}, token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	if fence == 0 {
+		return nil, lock.ErrNotAcquired
+	}
+
+	ls := newLease(ctx, l.ttl, l.logger, name,
+		func(ctx context.Context) (bool, error) {
+			n, err := renewScript.Run(ctx, l.client, []string{name}, token, l.ttl.Milliseconds()).Int()
+			return n == 1, err
+		},
+		func(ctx context.Context) error {
+			return unlockScript.Run(ctx, l.client, []string{name}, token).Err()
+		},
+	)
+	return &Lock{lease: ls, fence: fence}, nil
+}
+
+// lease is a ttl based hold on a key, extended every ttl/3 until released or lost
+type lease struct {
+	name    string
+	ttl     time.Duration
+	renew   func(ctx context.Context) (bool, error) // false when the key is no longer ours
+	release func(ctx context.Context) error
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	logger logging.Logger
+}
+
+func newLease(ctx context.Context, ttl time.Duration, logger logging.Logger, name string,
+	renew func(ctx context.Context) (bool, error), release func(ctx context.Context) error) *lease {
+	lctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	l := &lease{
+		name:    name,
+		ttl:     ttl,
+		renew:   renew,
+		release: release,
+		ctx:     lctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		logger:  logging.OrDefault(logger),
+	}
+	go l.keepAlive()
+	return l
+}
+
+// Context is cancelled when the lease is released or lost, context.Cause returns lock.ErrLockLost for the latter
+func (l *lease) Context() context.Context {
+	return l.ctx
+}
+
+// keepAlive extends the lease every ttl/3. it is lost when another owner holds the key or when
+// extensions keep failing until the ttl would have run out.
+func (l *lease) keepAlive() {
+	defer close(l.done)
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ok, err := l.renew(ctx)
+		cancel()
+
+		switch {
+		case err == nil && ok:
+			renewed = time.Now()
+			continue
+		case err == nil:
+			l.logger.WarnContext(l.ctx, "redis lease taken over", logging.KeyStorage, "redis", "lease", l.name)
+		case time.Since(renewed) < l.ttl-interval:
+			l.logger.WarnContext(l.ctx, "failed to extend redis lease", logging.KeyStorage, "redis", "lease", l.name, logging.Err(err))
+			continue
+		default:
+			l.logger.WarnContext(l.ctx, "redis lease expired", logging.KeyStorage, "redis", "lease", l.name, logging.Err(err))
+		}
+		l.cancel(lock.ErrLockLost)
+		return
+	}
+}
+
+// Unlock releases the lease, calling it more than once is a no-op
+func (l *lease) Unlock(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		defer l.cancel(nil)
+
+		if errors.Is(context.Cause(l.ctx), lock.ErrLockLost) {
+			return
+		}
+		if err = l.release(ctx); err != nil {
+			err = fmt.Errorf("failed to release %s: %w", l.name, err)
+		}
+	})
+	return err
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/lock"
+)
+
+func TestLockFencingTokens(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	locker := r.NewLocker(time.Minute)
+
+	var last int64
+	for i := 0; i < 5; i++ {
+		lk, err := locker.Obtain(ctx, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lk.Fence() <= last {
+			t.Fatalf("fence %d not greater than previous %d", lk.Fence(), last)
+		}
+		last = lk.Fence()
+		if err := lk.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// tokens are per lock name
+	other, err := locker.Obtain(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlock(ctx)
+	if other.Fence() != 1 {
+		t.Fatalf("got fence %d for a new name, want 1", other.Fence())
+	}
+}
+
+func TestLockExclusive(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	locker := r.NewLocker(time.Minute)
+
+	lk, err := locker.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.TryLock(ctx, "job"); !errors.Is(err, lock.ErrNotAcquired) {
+		t.Fatalf("got %v, want ErrNotAcquired", err)
+	}
+	if !m.Exists("job") {
+		t.Fatal("lock not stored under its name")
+	}
+
+	if err := lk.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lk.Unlock(ctx); err != nil {
+		t.Fatalf("second unlock: %v", err)
+	}
+	if lk.Context().Err() == nil {
+		t.Fatal("lock context not cancelled on unlock")
+	}
+
+	lk2, err := locker.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk2.Unlock(ctx)
+}
+
+func TestLockExpiresAfterTTL(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	locker := r.NewLocker(time.Minute)
+
+	lk, err := locker.Obtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lk.Unlock(ctx)
+
+	// a crashed holder stops extending, the key expires
+	m.FastForward(time.Minute)
+	lk2, err := locker.Obtain(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lk2.Unlock(ctx)
+	if lk2.Fence() <= lk.Fence() {
+		t.Fatal("fence did not increase after expiry")
+	}
+}
+
+func TestLockLostOnTakeover(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	locker := r.NewLocker(150 * time.Millisecond)
+
+	lk, err := locker.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another owner holds the key now, the next extension notices
+	if err := m.Set("job", "someone-else"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-lk.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock loss not reported")
+	}
+	if !errors.Is(context.Cause(lk.Context()), lock.ErrLockLost) {
+		t.Fatalf("got cause %v, want ErrLockLost", context.Cause(lk.Context()))
+	}
+
+	// unlock must not delete the new owner's key
+	if err := lk.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get("job"); v != "someone-else" {
+		t.Fatalf("new owner's lock was removed, got %q", v)
+	}
+}
+
+func TestLockKeepAlive(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	locker := r.NewLocker(150 * time.Millisecond)
+
+	lk, err := locker.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lk.Unlock(ctx)
+
+	// extensions reset the ttl while held
+	time.Sleep(200 * time.Millisecond)
+	if ttl := m.TTL("job"); ttl <= 0 || ttl > 150*time.Millisecond {
+		t.Fatalf("unexpected ttl %v", ttl)
+	}
+	if lk.Context().Err() != nil {
+		t.Fatal("held lock reported lost")
+	}
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a size bounded in-process cache with per entry expiry
+type lru[T any] struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[T any] struct {
+	key      string
+	value    T
+	notFound bool
+	expires  time.Time
+}
+
+func newLRU[T any](size int) *lru[T] {
+	return &lru[T]{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru[T]) get(key string) (lruEntry[T], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return lruEntry[T]{}, false
+	}
+	e := el.Value.(*lruEntry[T])
+	if time.Now().After(e.expires) {
+		c.removeElement(el)
+		return lruEntry[T]{}, false
+	}
+	c.ll.MoveToFront(el)
+	return *e, true
+}
+
+func (c *lru[T]) add(e lruEntry[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[e.key]; ok {
+		*el.Value.(*lruEntry[T]) = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[e.key] = c.ll.PushFront(&e)
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lru[T]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lru[T]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+}
+
+func (c *lru[T]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[T]).key)
+}
@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictionOrder(t *testing.T) {
+	c := newLRU[int](2)
+	expires := time.Now().Add(time.Hour)
+
+	c.add(lruEntry[int]{key: "a", value: 1, expires: expires})
+	c.add(lruEntry[int]{key: "b", value: 2, expires: expires})
+	if _, ok := c.get("a"); !ok { // a is now the most recently used
+		t.Fatal("a missing")
+	}
+	c.add(lruEntry[int]{key: "c", value: 3, expires: expires})
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("least recently used b not evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if e, ok := c.get(key); !ok || e.value != want {
+			t.Fatalf("%s: got %v %v, want %d", key, e.value, ok, want)
+		}
+	}
+
+	// replacing an entry refreshes it without growing the cache
+	c.add(lruEntry[int]{key: "a", value: 10, expires: expires})
+	c.add(lruEntry[int]{key: "d", value: 4, expires: expires})
+	if _, ok := c.get("c"); ok {
+		t.Fatal("c not evicted after a was replaced")
+	}
+	if e, ok := c.get("a"); !ok || e.value != 10 {
+		t.Fatalf("got %v %v, want the replaced 10", e.value, ok)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := newLRU[int](2)
+	c.add(lruEntry[int]{key: "old", value: 1, expires: time.Now().Add(-time.Second)})
+
+	if _, ok := c.get("old"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if len(c.items) != 0 || c.ll.Len() != 0 {
+		t.Fatal("expired entry not removed")
+	}
+}
@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scriptNow reads the server clock in ms, so clients with skewed clocks agree on time
+const scriptNow = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// slidingWindowScript keeps a log of request times in a sorted set, returns allowed, remaining, retry after ms
+var slidingWindowScript = redis.NewScript(scriptNow + `
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n <= limit then
+	for i = 1, n do
+		redis.call('ZADD', KEYS[1], now, ARGV[4] .. ':' .. i)
+	end
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {1, limit - count - n, 0}
+end
+
+-- wait until enough of the oldest requests left the window
+local oldest = redis.call('ZRANGE', KEYS[1], count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+local retry = window
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, limit - count, retry}
+`)
+
+// tokenBucketScript refills the bucket for the elapsed time and takes n tokens,
+// returns allowed, remaining, retry after ms
+var tokenBucketScript = redis.NewScript(scriptNow + `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	allowed = 1
+	tokens = tokens - n
+else
+	retry = math.ceil((n - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// RateResult is the outcome of a rate limiter check
+type RateResult struct {
+	Allowed    bool
+	Remaining  int           // requests left in the window or tokens left in the bucket
+	RetryAfter time.Duration // when not allowed, wait before the request can succeed
+}
+
+// SlidingWindowLimiter allows limit requests per key within any window, exact but storing one entry per request.
+// each check runs as one Lua script, so concurrent clients never exceed the limit.
+type SlidingWindowLimiter struct {
+	client *redis.Client
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewSlidingWindowLimiter returns a limiter storing its log of key in "<prefix>:<key>"
+func (r *Redis) NewSlidingWindowLimiter(prefix string, limit int, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{client: r.client, prefix: prefix, limit: limit, window: window}
+}
+
+// Allow records one request for key if it is within the limit
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (RateResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN records n requests for key if all of them are within the limit, none otherwise
+func (l *SlidingWindowLimiter) AllowN(ctx context.Context, key string, n int) (RateResult, error) {
+	if l.limit <= 0 || l.window <= 0 {
+		return RateResult{}, errors.New("sliding window limiter needs a positive limit and window")
+	}
+	if n <= 0 || n > l.limit {
+		return RateResult{}, fmt.Errorf("cannot take %d of limit %d", n, l.limit)
+	}
+
+	member, err := newToken()
+	if err != nil {
+		return RateResult{}, err
+	}
+	res, err := slidingWindowScript.Run(ctx, l.client, []string{l.prefix + ":" + key},
+		l.window.Milliseconds(), l.limit, n, member).Int64Slice()
+	if err != nil {
+		return RateResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	return rateResult(res), nil
+}
+
+// Wait blocks until a request for key is allowed or ctx is cancelled
+func (l *SlidingWindowLimiter) Wait(ctx context.Context, key string) error {
+	return waitAllowed(ctx, func() (RateResult, error) { return l.Allow(ctx, key) })
+}
+
+// TokenBucketLimiter refills rate tokens per second up to burst per key, each request takes tokens.
+// it allows bursts while bounding the average rate, with constant storage per key.
+type TokenBucketLimiter struct {
+	client *redis.Client
+	prefix string
+	rate   float64
+	burst  int
+}
+
+// NewTokenBucketLimiter returns a limiter storing the bucket of key in "<prefix>:<key>"
+func (r *Redis) NewTokenBucketLimiter(prefix string, rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{client: r.client, prefix: prefix, rate: rate, burst: burst}
+}
+
+// Allow takes one token for key if available
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string) (RateResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN takes n tokens for key if all are available, none otherwise
+func (l *TokenBucketLimiter) AllowN(ctx context.Context, key string, n int) (RateResult, error) {
+	if l.rate <= 0 || l.burst <= 0 {
+		return RateResult{}, errors.New("token bucket limiter needs a positive rate and burst")
+	}
+	if n <= 0 || n > l.burst {
+		return RateResult{}, fmt.Errorf("cannot take %d of burst %d", n, l.burst)
+	}
+
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + ":" + key},
+		l.rate, l.burst, n).Int64Slice()
+	if err != nil {
+		return RateResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	return rateResult(res), nil
+}
+
+// Wait blocks until a token for key is taken or ctx is cancelled
+func (l *TokenBucketLimiter) Wait(ctx context.Context, key string) error {
+	return waitAllowed(ctx, func() (RateResult, error) { return l.Allow(ctx, key) })
+}
+
+func rateResult(res []int64) RateResult {
+	if len(res) < 3 {
+		return RateResult{}
+	}
+	return RateResult{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}
+}
+
+func waitAllowed(ctx context.Context, allow func() (RateResult, error)) error {
+	for {
+		res, err := allow()
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(max(res.RetryAfter, time.Millisecond)):
+		}
+	}
+}
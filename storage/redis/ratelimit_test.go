@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := r.NewSlidingWindowLimiter("rl", 3, time.Second)
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: got %+v", i, res)
+		}
+		m.SetTime(start.Add(time.Duration(i+1) * 100 * time.Millisecond))
+	}
+
+	// the oldest request at +0ms leaves the window at +1000ms
+	m.SetTime(start.Add(400 * time.Millisecond))
+	res, err := limiter.Allow(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 600*time.Millisecond {
+		t.Fatalf("over limit: got %+v", res)
+	}
+
+	// other keys have their own window
+	if res, _ := limiter.Allow(ctx, "user-2"); !res.Allowed {
+		t.Fatal("other key limited")
+	}
+
+	// two slots only free once the second oldest left too
+	res, err = limiter.AllowN(ctx, "user-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != 700*time.Millisecond {
+		t.Fatalf("AllowN over limit: got %+v", res)
+	}
+
+	m.SetTime(start.Add(time.Second))
+	if res, _ := limiter.Allow(ctx, "user-1"); !res.Allowed {
+		t.Fatalf("after window: got %+v", res)
+	}
+
+	if _, err := limiter.AllowN(ctx, "user-1", 4); err == nil {
+		t.Fatal("expected error for n above limit")
+	}
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := r.NewTokenBucketLimiter("tb", 10, 2)
+
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("burst %d: got %+v", i, res)
+		}
+	}
+
+	res, err := limiter.Allow(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("empty bucket: got %+v", res)
+	}
+
+	// 10 tokens per second, one token after 100ms
+	m.SetTime(start.Add(100 * time.Millisecond))
+	if res, _ := limiter.Allow(ctx, "user-1"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill: got %+v", res)
+	}
+
+	// refill is capped at burst
+	m.SetTime(start.Add(time.Hour))
+	res, err = limiter.AllowN(ctx, "user-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after long idle: got %+v", res)
+	}
+
+	if _, err := limiter.AllowN(ctx, "user-1", 3); err == nil {
+		t.Fatal("expected error for n above burst")
+	}
+}
+
+func TestLimiterWaitHonorsContext(t *testing.T) {
+	r, _ := newTestRedis(t)
+	limiter := r.NewSlidingWindowLimiter("rl", 1, time.Hour)
+
+	if err := limiter.Wait(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lzf-12/go-example-collections/storage/logging"
 	"github.com/redis/go-redis/v9"
 )
 
 type Redis struct {
 	client *redis.Client
 	ctx    context.Context
+	logger logging.Logger
 }
 
 type RedisCfg struct {
@@ -27,6 +29,7 @@ type RedisCfg struct {
 	MinIdleConns int
 	PoolTimeout  time.Duration
 	UseTLS       bool
+	Logger       logging.Logger // structured logger, slog.Default when nil
 }
 
 const pingTimeout = 5 * time.Second
@@ -68,7 +71,7 @@ func NewRedis(rc RedisCfg) (*Redis, error) {
 		return nil, fmt.Errorf("redis connection failed: %w", err)
 	}
 
-	return &Redis{client: rdb, ctx: context.Background()}, nil
+	return &Redis{client: rdb, ctx: context.Background(), logger: rc.Logger}, nil
 }
 
 // test connection
@@ -76,9 +79,16 @@ func (r *Redis) Ping() error {
 	ctx, cancel := context.WithTimeout(r.ctx, pingTimeout)
 	defer cancel()
 	_, err := r.client.Ping(ctx).Result()
+	if err != nil {
+		r.log().WarnContext(ctx, "redis ping failed", logging.KeyStorage, "redis", logging.Err(err))
+	}
 	return err
 }
 
+func (r *Redis) log() logging.Logger {
+	return logging.OrDefault(r.logger)
+}
+
 func validateAddr(dsn string) error {
 	if strings.HasPrefix(dsn, "redis://") {
 		u, err := url.Parse(dsn)
@@ -117,6 +127,7 @@ func (r *Redis) IsReady() error {
 }
 
 func (r *Redis) Close() error {
+	r.log().InfoContext(r.ctx, "closing redis client", logging.KeyStorage, "redis")
 	return r.client.Close()
 }
 
@@ -128,6 +139,7 @@ func (r *Redis) WithContext(ctx context.Context) *Redis {
 	return &Redis{
 		client: r.client,
 		ctx:    ctx,
+		logger: r.logger,
 	}
 }
 
@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedis connects to an in-process miniredis with its clock frozen at a fixed time,
+// advance it with SetTime to move the server clock seen by Lua scripts
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	m.SetTime(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	r, err := NewRedis(RedisCfg{Addr: m.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, m
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// claimScript moves due ids to now+lease, counts the attempt and returns id, data, attempts triples.
+// ids without data (half written or deleted concurrently) are dropped.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+local out = {}
+for _, id in ipairs(ids) do
+	local data = redis.call('HGET', KEYS[2], id)
+	if data then
+		redis.call('ZADD', KEYS[1], ARGV[2], id)
+		table.insert(out, id)
+		table.insert(out, data)
+		table.insert(out, redis.call('HINCRBY', KEYS[3], id, 1))
+	else
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('HDEL', KEYS[3], id)
+	end
+end
+return out
+`)
+
+// deleteClaimedScript removes id only while its due time is still the lease ARGV[2]
+var deleteClaimedScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// SchedulerStore holds scheduled messages in a sorted set scored by due time (unix ms) and a hash of
+// message data, it satisfies msgbroker scheduler.Store. claims run as one Lua script and are atomic.
+type SchedulerStore struct {
+	client      *redis.Client
+	dueKey      string
+	dataKey     string
+	attemptsKey string
+}
+
+// NewSchedulerStore returns a store using the keys "{<key>}:due", "{<key>}:data" and "{<key>}:attempts",
+// the hash tag keeps them in one cluster slot as the scripts require
+func (r *Redis) NewSchedulerStore(key string) *SchedulerStore {
+	tag := "{" + key + "}"
+	return &SchedulerStore{client: r.client, dueKey: tag + ":due", dataKey: tag + ":data", attemptsKey: tag + ":attempts"}
+}
+
+func (s *SchedulerStore) Save(ctx context.Context, id string, dueAt time.Time, data []byte) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.dataKey, id, data)
+		pipe.HDel(ctx, s.attemptsKey, id)
+		pipe.ZAdd(ctx, s.dueKey, redis.Z{Score: float64(dueAt.UnixMilli()), Member: id})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled message: %w", err)
+	}
+	return nil
+}
+
+func (s *SchedulerStore) Delete(ctx context.Context, id string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, s.dueKey, id)
+		pipe.HDel(ctx, s.dataKey, id)
+		pipe.HDel(ctx, s.attemptsKey, id)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+	return removed.Val() > 0, nil
+}
+
+// DeleteClaimed removes the message only while its due time still is the lease set when it was claimed
+func (s *SchedulerStore) DeleteClaimed(ctx context.Context, id string, leaseUntil time.Time) (bool, error) {
+	n, err := deleteClaimedScript.Run(ctx, s.client, []string{s.dueKey, s.dataKey, s.attemptsKey},
+		id, strconv.FormatInt(leaseUntil.UnixMilli(), 10)).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete claimed message: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *SchedulerStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, [][]byte, []int, error) {
+	res, err := claimScript.Run(ctx, s.client, []string{s.dueKey, s.dataKey, s.attemptsKey},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+		limit,
+	).Slice()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+
+	ids := make([]string, 0, len(res)/3)
+	data := make([][]byte, 0, len(res)/3)
+	attempts := make([]int, 0, len(res)/3)
+	for i := 0; i+2 < len(res); i += 3 {
+		id, _ := res[i].(string)
+		d, _ := res[i+1].(string)
+		n, _ := res[i+2].(int64)
+		ids = append(ids, id)
+		data = append(data, []byte(d))
+		attempts = append(attempts, int(n))
+	}
+	return ids, data, attempts, nil
+}
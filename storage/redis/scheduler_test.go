@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerStoreClaimAndDelete(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	s := r.NewSchedulerStore("sched")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := s.Save(ctx, "a", now.Add(-time.Second), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, "later", now.Add(time.Hour), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, data, attempts, err := s.ClaimDue(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "a" || string(data[0]) != "v1" || attempts[0] != 1 {
+		t.Fatalf("got %v %q %v", ids, data, attempts)
+	}
+
+	// claimed again after the lease, the attempt is counted
+	ids, _, attempts, err = s.ClaimDue(ctx, now.Add(time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || attempts[0] != 2 {
+		t.Fatalf("second claim: got %v %v", ids, attempts)
+	}
+	lease := now.Add(2 * time.Minute)
+
+	if ok, err := s.DeleteClaimed(ctx, "a", now.Add(time.Minute)); err != nil || ok {
+		t.Fatalf("delete with a stale lease: %v, %v", ok, err)
+	}
+	if ok, err := s.DeleteClaimed(ctx, "a", lease); err != nil || !ok {
+		t.Fatalf("delete with the current lease: %v, %v", ok, err)
+	}
+	if ok, _ := s.Delete(ctx, "a"); ok {
+		t.Fatal("message still stored")
+	}
+}
+
+func TestSchedulerStoreRescheduledWhileClaimed(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	s := r.NewSchedulerStore("sched")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := s.Save(ctx, "a", now, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.ClaimDue(ctx, now, time.Minute, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// saved again under the same id while v1 was being published
+	if err := s.Save(ctx, "a", now.Add(time.Hour), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.DeleteClaimed(ctx, "a", now.Add(time.Minute)); err != nil || ok {
+		t.Fatalf("rescheduled message deleted: %v, %v", ok, err)
+	}
+
+	ids, data, attempts, err := s.ClaimDue(ctx, now.Add(time.Hour), time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || string(data[0]) != "v2" || attempts[0] != 1 {
+		t.Fatalf("got %v %q %v", ids, data, attempts)
+	}
+}
@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultSemaphoreTTL  = 30 * time.Second
+	semaphoreRetryMin    = 10 * time.Millisecond
+	semaphoreRetryMax    = time.Second
+	semaphoreRetryFactor = 2
+)
+
+// ErrNoPermit is returned by TryAcquire when every permit is held
+var ErrNoPermit = errors.New("no semaphore permit available")
+
+// semAcquireScript drops expired holders and adds ours when a permit is free.
+// expiries are taken from the server clock, a client clock running ahead cannot evict valid permits.
+var semAcquireScript = redis.NewScript(scriptNow + `
+local ttl = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('ZADD', KEYS[1], now + ttl, ARGV[2])
+	redis.call('PEXPIRE', KEYS[1], ttl)
+	return 1
+end
+return 0
+`)
+
+// semRenewScript extends our permit only while we still hold it
+var semRenewScript = redis.NewScript(scriptNow + `
+local ttl = tonumber(ARGV[2])
+local expires = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if expires and tonumber(expires) > now then
+	redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ttl)
+	return 1
+end
+return 0
+`)
+
+// semHeldScript counts permits not yet expired
+var semHeldScript = redis.NewScript(scriptNow + `
+return redis.call('ZCOUNT', KEYS[1], '(' .. now, '+inf')
+`)
+
+// Semaphore limits concurrent holders of a key to size, e.g. calls to a rate limited partner API across
+// all instances. holders live in a sorted set scored by expiry, a crashed holder frees its permit after ttl.
+type Semaphore struct {
+	client *redis.Client
+	key    string
+	size   int
+	ttl    time.Duration
+	logger logging.Logger
+}
+
+// NewSemaphore returns a semaphore of size permits at key, held permits expire ttl (default 30s)
+// after their last extension and are extended every ttl/3 while held
+func (r *Redis) NewSemaphore(key string, size int, ttl time.Duration) *Semaphore {
+	if ttl <= 0 {
+		ttl = defaultSemaphoreTTL
+	}
+	return &Semaphore{client: r.client, key: key, size: size, ttl: ttl, logger: r.logger}
+}
+
+// Permit is a held semaphore permit, Context and Unlock behave as for a lock
+type Permit struct {
+	*lease
+}
+
+// Release returns the permit, same as Unlock
+func (p *Permit) Release(ctx context.Context) error {
+	return p.Unlock(ctx)
+}
+
+// TryAcquire takes a permit without waiting, ErrNoPermit when all are held
+func (s *Semaphore) TryAcquire(ctx context.Context) (*Permit, error) {
+	if s.size <= 0 {
+		return nil, errors.New("semaphore size must be positive")
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := semAcquireScript.Run(ctx, s.client, []string{s.key}, s.size, token, s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire semaphore: %w", err)
+	}
+	if ok == 0 {
+		return nil, ErrNoPermit
+	}
+
+	ls := newLease(ctx, s.ttl, s.logger, s.key,
+		func(ctx context.Context) (bool, error) {
+			n, err := semRenewScript.Run(ctx, s.client, []string{s.key}, token, s.ttl.Milliseconds()).Int()
+			return n == 1, err
+		},
+		func(ctx context.Context) error {
+			return s.client.ZRem(ctx, s.key, token).Err()
+		},
+	)
+	return &Permit{lease: ls}, nil
+}
+
+// Acquire waits for a permit until ctx is cancelled, polling with backoff
+func (s *Semaphore) Acquire(ctx context.Context) (*Permit, error) {
+	wait := semaphoreRetryMin
+	for {
+		p, err := s.TryAcquire(ctx)
+		if !errors.Is(err, ErrNoPermit) {
+			return p, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*semaphoreRetryFactor, semaphoreRetryMax)
+	}
+}
+
+// Held returns the number of permits currently held
+func (s *Semaphore) Held(ctx context.Context) (int, error) {
+	n, err := semHeldScript.Run(ctx, s.client, []string{s.key}).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count semaphore holders: %w", err)
+	}
+	return int(n), nil
+}
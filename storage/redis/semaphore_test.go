@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreLimit(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	sem := r.NewSemaphore("sem", 2, time.Minute)
+
+	p1, err := sem.TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := sem.TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Release(ctx)
+
+	if _, err := sem.TryAcquire(ctx); !errors.Is(err, ErrNoPermit) {
+		t.Fatalf("got %v, want ErrNoPermit", err)
+	}
+	if held, err := sem.Held(ctx); err != nil || held != 2 {
+		t.Fatalf("held = %d, %v", held, err)
+	}
+
+	if err := p1.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p1.Context().Err() == nil {
+		t.Fatal("permit context not cancelled on release")
+	}
+
+	p3, err := sem.TryAcquire(ctx)
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	defer p3.Release(ctx)
+}
+
+func TestSemaphoreExpiredPermitsFreed(t *testing.T) {
+	r, m := newTestRedis(t)
+	ctx := context.Background()
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	sem := r.NewSemaphore("sem", 1, time.Minute)
+
+	p1, err := sem.TryAcquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Release(ctx)
+
+	// expiry follows the server clock only
+	m.SetTime(start.Add(59 * time.Second))
+	if _, err := sem.TryAcquire(ctx); !errors.Is(err, ErrNoPermit) {
+		t.Fatalf("before expiry: got %v", err)
+	}
+
+	// the holder crashed and stopped extending
+	m.SetTime(start.Add(61 * time.Second))
+	if held, _ := sem.Held(ctx); held != 0 {
+		t.Fatalf("held = %d after expiry", held)
+	}
+	p2, err := sem.TryAcquire(ctx)
+	if err != nil {
+		t.Fatalf("after expiry: %v", err)
+	}
+	defer p2.Release(ctx)
+}
+
+func TestSemaphoreAcquireWaits(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+	sem := r.NewSemaphore("sem", 1, time.Minute)
+
+	p1, err := sem.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p1.Release(ctx)
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	p2, err := sem.Acquire(waitCtx)
+	if err != nil {
+		t.Fatalf("waiting acquire: %v", err)
+	}
+	defer p2.Release(ctx)
+
+	shortCtx, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := sem.Acquire(shortCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lzf-12/go-example-collections/storage/internal/sqlident"
+)
+
+// OffsetStore keeps kafka consumer offsets (next offset to consume) per group, topic and partition.
+// it satisfies msgbroker kafka.OffsetStore, StoreOffsetTx lets a handler save its data and offset atomically.
+type OffsetStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewOffsetStore returns a store on table, see CreateTable
+func (s *SQLite) NewOffsetStore(table string) (*OffsetStore, error) {
+	if !sqlident.Valid(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &OffsetStore{db: s.db, table: table}, nil
+}
+
+// CreateTable creates the offset table if it does not exist
+func (o *OffsetStore) CreateTable(ctx context.Context) error {
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		group_id    TEXT NOT NULL,
+		topic       TEXT NOT NULL,
+		partition   INTEGER NOT NULL,
+		next_offset INTEGER NOT NULL,
+		updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (group_id, topic, partition)
+	)`, o.table))
+	if err != nil {
+		return fmt.Errorf("failed to create offset table: %w", err)
+	}
+	return nil
+}
+
+func (o *OffsetStore) LoadOffset(ctx context.Context, group, topic string, partition int32) (int64, bool, error) {
+	var offset int64
+	err := o.db.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT next_offset FROM %s WHERE group_id = ? AND topic = ? AND partition = ?`, o.table),
+		group, topic, partition).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load offset: %w", err)
+	}
+	return offset, true, nil
+}
+
+func (o *OffsetStore) StoreOffset(ctx context.Context, group, topic string, partition int32, offset int64) error {
+	return o.store(ctx, o.db, group, topic, partition, offset)
+}
+
+// StoreOffsetTx saves the offset within tx, commit it together with the data derived from the message
+func (o *OffsetStore) StoreOffsetTx(ctx context.Context, tx *sql.Tx, group, topic string, partition int32, offset int64) error {
+	return o.store(ctx, tx, group, topic, partition, offset)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (o *OffsetStore) store(ctx context.Context, db execer, group, topic string, partition int32, offset int64) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (group_id, topic, partition, next_offset)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (group_id, topic, partition) DO UPDATE SET next_offset = excluded.next_offset, updated_at = CURRENT_TIMESTAMP`, o.table),
+		group, topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("failed to store offset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lzf-12/go-example-collections/storage/internal/sqlident"
+)
+
+// SchedulerStore holds scheduled messages until they are due, it satisfies msgbroker scheduler.Store.
+// sqlite serializes writers, so the claiming UPDATE is atomic across processes sharing the file.
+// due times are stored as unix milliseconds.
+type SchedulerStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSchedulerStore returns a store on table, see CreateTable
+func (s *SQLite) NewSchedulerStore(table string) (*SchedulerStore, error) {
+	if !sqlident.Valid(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SchedulerStore{db: s.db, table: table}, nil
+}
+
+// CreateTable creates the scheduled message table and its due time index if they do not exist
+func (ss *SchedulerStore) CreateTable(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id         TEXT PRIMARY KEY,
+		due_at     INTEGER NOT NULL,
+		data       BLOB NOT NULL,
+		attempts   INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`, ss.table))
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler table: %w", err)
+	}
+
+	_, err = ss.db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_due_at_idx ON %s (due_at)`, ss.table, ss.table))
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler index: %w", err)
+	}
+	return nil
+}
+
+func (ss *SchedulerStore) Save(ctx context.Context, id string, dueAt time.Time, data []byte) error {
+	_, err := ss.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, due_at, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET due_at = excluded.due_at, data = excluded.data, attempts = 0`, ss.table),
+		id, dueAt.UnixMilli(), data)
+	if err != nil {
+		return fmt.Errorf("failed to save scheduled message: %w", err)
+	}
+	return nil
+}
+
+func (ss *SchedulerStore) Delete(ctx context.Context, id string) (bool, error) {
+	res, err := ss.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, ss.table), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteClaimed removes the message only while due_at still is the lease set when it was claimed
+func (ss *SchedulerStore) DeleteClaimed(ctx context.Context, id string, leaseUntil time.Time) (bool, error) {
+	res, err := ss.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND due_at = ?`, ss.table), id, leaseUntil.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to delete claimed message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete claimed message: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (ss *SchedulerStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, [][]byte, []int, error) {
+	rows, err := ss.db.QueryContext(ctx, fmt.Sprintf(`UPDATE %s SET due_at = ?, attempts = attempts + 1
+		WHERE id IN (SELECT id FROM %s WHERE due_at <= ? ORDER BY due_at LIMIT ?)
+		RETURNING id, data, attempts`, ss.table, ss.table),
+		now.Add(lease).UnixMilli(), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		ids      []string
+		data     [][]byte
+		attempts []int
+	)
+	for rows.Next() {
+		var (
+			id string
+			d  []byte
+			n  int
+		)
+		if err := rows.Scan(&id, &d, &n); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to scan claimed message: %w", err)
+		}
+		ids = append(ids, id)
+		data = append(data, d)
+		attempts = append(attempts, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to claim due messages: %w", err)
+	}
+	return ids, data, attempts, nil
+}
@@ -1,21 +1,25 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/lzf-12/go-example-collections/storage/logging"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SQLite struct {
-	db *sql.DB
+	db     *sql.DB
+	logger logging.Logger
 }
 
 type SQLiteConfig struct {
 	Filepath   string
 	AutoCreate bool
+	Logger     logging.Logger // structured logger, slog.Default when nil
 }
 
 func New(sc SQLiteConfig) (*SQLite, error) {
@@ -44,7 +48,7 @@ func New(sc SQLiteConfig) (*SQLite, error) {
 		}
 	}
 
-	return &SQLite{db: db}, nil
+	return &SQLite{db: db, logger: sc.Logger}, nil
 }
 
 func validateFilepath(path string) error {
@@ -56,7 +60,15 @@ func validateFilepath(path string) error {
 }
 
 func (s *SQLite) Ping() error {
-	return s.db.Ping()
+	if err := s.db.Ping(); err != nil {
+		s.log().WarnContext(context.Background(), "sqlite ping failed", logging.KeyStorage, "sqlite", logging.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLite) log() logging.Logger {
+	return logging.OrDefault(s.logger)
 }
 
 func (s *SQLite) IsReady() error {
@@ -66,6 +78,7 @@ func (s *SQLite) IsReady() error {
 }
 
 func (s *SQLite) Close() error {
+	s.log().InfoContext(context.Background(), "closing sqlite database", logging.KeyStorage, "sqlite")
 	return s.db.Close()
 }
 